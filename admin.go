@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequireAdmin is middleware that only allows requests carrying the admin token, either as a
+// bearer token or as the password of HTTP basic auth so the admin pages work in a browser
+func RequireAdmin(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if _, password, ok := r.BasicAuth(); ok {
+				token = password
+			}
+			if len(cfg.AdminToken) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="twilio-voice"`)
+				http.Error(w, http.StatusText(401), 401)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SameOrigin is middleware that refuses changes made from other sites.  Browsers send the
+// basic auth of the admin pages with any request to the server, so without it another site
+// could post a form that deletes voicemails or unblocks callers.  Requests that only read are
+// let through, as are requests without an Origin or Referer, like those from curl.
+func SameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !sameOrigin(r) {
+			requestLog(r).Warn("Refused admin request from another site", "origin", r.Header.Get("Origin"), "referer", r.Referer())
+			http.Error(w, http.StatusText(403), 403)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin returns true if the request came from a page on this server, or doesn't say where
+// it came from
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	from := r.Header.Get("Origin")
+	if len(from) == 0 {
+		from = r.Referer()
+	}
+	if len(from) == 0 {
+		return true
+	}
+	u, err := url.Parse(from)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); len(forwarded) > 0 {
+		host = forwarded
+	}
+	return strings.EqualFold(u.Host, host)
+}
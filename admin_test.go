@@ -0,0 +1,38 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin", func() {
+	DescribeTable("SameOrigin",
+		func(method string, headers map[string]string, status int) {
+			handler := SameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(204)
+			}))
+			req := httptest.NewRequest(method, "http://voice.example.com/admin/voicemail/RE1/delete", nil)
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(status))
+		},
+		Entry("a form on the inbox", "POST", map[string]string{"Origin": "http://voice.example.com"}, 204),
+		Entry("a form on another site", "POST", map[string]string{"Origin": "https://evil.example.com"}, 403),
+		Entry("a referer from the inbox", "POST", map[string]string{"Referer": "http://voice.example.com/admin/voicemail/"}, 204),
+		Entry("a referer from another site", "POST", map[string]string{"Referer": "https://evil.example.com/page"}, 403),
+		Entry("a sandboxed page", "POST", map[string]string{"Origin": "null"}, 403),
+		Entry("a browser marking the request cross-site", "DELETE", map[string]string{"Sec-Fetch-Site": "cross-site"}, 403),
+		Entry("a proxy forwarding the public host", "POST", map[string]string{"Origin": "https://abc123.ngrok.io", "X-Forwarded-Host": "abc123.ngrok.io"}, 204),
+		Entry("a client that doesn't say where it came from", "DELETE", map[string]string{}, 204),
+		Entry("reading from another site", "GET", map[string]string{"Origin": "https://evil.example.com"}, 204),
+	)
+})
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/middleware"
+)
+
+// App is everything the server needs to answer calls and messages, built from a validated
+// config
+type App struct {
+	Blocklist *Blocklist
+	Store     VoicemailStore
+	Archiver  *Archiver
+	Calls     *CallLog
+	Outbox    *Outbox
+	Missed    *MissedCalls
+
+	cfg       Config
+	bus       *EventBus
+	states    *CallStates
+	screening *Screening
+	pins      *PINAttempts
+}
+
+// NewApp opens the blocklist, voicemail store, call log and outbox of the config.  Call Start
+// to begin archiving voicemails and sending notifications.
+func NewApp(cfg Config) (*App, error) {
+	blocklist, err := OpenBlocklist(cfg, cfg.BlocklistPath())
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewFileStore(cfg.VoicemailDir)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := OpenCallLog(cfg, cfg.CallLogPath())
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := NewOutbox(cfg, cfg.OutboxPath())
+	if err != nil {
+		calls.Close()
+		return nil, err
+	}
+	outbox.Store = store
+	a := &App{
+		Blocklist: blocklist,
+		Store:     store,
+		Archiver:  NewArchiver(cfg, store),
+		Calls:     calls,
+		Outbox:    outbox,
+		Missed:    NewMissedCalls(cfg, calls, outbox),
+		cfg:       cfg,
+		bus:       NewEventBus(),
+		screening: NewScreening(cfg),
+		pins:      NewPINAttempts(cfg),
+	}
+	a.Calls.Subscribe(a.bus)
+	a.Missed.Subscribe(a.bus)
+	a.states = NewCallStates(cfg, a.bus)
+	return a, nil
+}
+
+// Start archives voicemails, sends notifications, saves the counts of blocked calls and checks
+// calls that ended before the last restart for missed calls in the background
+func (a *App) Start() {
+	a.Blocklist.Start()
+	a.Archiver.Start()
+	a.Outbox.Start()
+	a.Missed.Start()
+}
+
+// Stop cancels the missed call checks still waiting, to be checked again on the next start,
+// waits for the notification being sent, stops archiving, saves the counts of blocked calls and
+// closes the call log.  The webhooks must have finished first so nothing more is queued.
+func (a *App) Stop() {
+	a.Missed.Stop()
+	a.Outbox.Stop()
+	a.Archiver.Stop()
+	a.Blocklist.Stop()
+	a.Calls.Close()
+}
+
+// Handler returns the router for the Twilio webhooks, the admin pages and voicemail prompts
+func (a *App) Handler() http.Handler {
+	cfg := a.cfg
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(LogRequests(logger))
+	r.Use(InstrumentRoutes)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.CloseNotify)
+	r.Use(middleware.Timeout(10 * time.Second))
+
+	r.Group(func(r chi.Router) {
+		r.Use(LogCalls(cfg))
+		r.Use(VerifySignature(cfg))
+		r.Post("/call/", CallRequest(cfg, a.Blocklist, a.Calls))
+		r.Post("/call/action/", DialAction(cfg, a.screening, a.Calls))
+		r.Post("/call/menu", MenuChoice(cfg))
+		r.Post("/call/screen", Screen(cfg))
+		r.Post("/call/screen/answer", ScreenAnswer(cfg, a.screening))
+		r.Post("/call/outbound/pin", OutboundPIN(cfg, a.pins))
+		r.Post("/call/outbound/dial", OutboundDial(cfg))
+		r.Post("/voicemail", Voicemail(cfg, a.Archiver, a.Calls, a.Outbox))
+		r.Post("/voicemail/recording", RecordingStatus(cfg, a.Archiver, a.Calls))
+		r.Post("/status", Status(cfg, a.states))
+		r.Post("/sms", Message(cfg, NewCorrespondents(), a.Outbox))
+	})
+	if len(cfg.AdminToken) > 0 {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(RequireAdmin(cfg))
+			r.Use(SameOrigin)
+			r.Mount("/blocklist", BlocklistAPI(a.Blocklist))
+			r.Mount("/voicemail", Inbox(a.Store))
+			r.Get("/calls.csv", CallsExport(a.Calls, "csv"))
+			r.Get("/calls.jsonl", CallsExport(a.Calls, "jsonl"))
+		})
+	}
+	if cfg.EnableCustomPrompt {
+		logger.Info("Serving custom voicemail prompt", "file", cfg.VoicemailFile)
+		r.FileServer("/prompt", http.Dir(cfg.ServeDirectory))
+	}
+	for url, file := range cfg.Prompts() {
+		logger.Info("Serving custom voicemail prompt", "file", file)
+		r.Get(url, servePrompt(file))
+	}
+	return r
+}
+
+// servePrompt serves a voicemail prompt file for a profile
+func servePrompt(file string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, file)
+	}
+}
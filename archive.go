@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// Archiver saves voicemails to a store as their callbacks arrive, and downloads the audio of
+// each one from Twilio in the background so the message survives the recording being deleted
+type Archiver struct {
+	// Attempts is the number of times to try each download
+	Attempts int
+	// Backoff is the wait before the first retry, doubling after each attempt
+	Backoff time.Duration
+
+	store      VoicemailStore
+	client     *http.Client
+	accountSid string
+	authToken  string
+	apiHosts   []string
+	now        func() time.Time
+	wake       chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewArchiver returns an archiver that saves voicemails to the store.  Call Start to begin
+// downloading audio.
+func NewArchiver(cfg Config, store VoicemailStore) *Archiver {
+	return &Archiver{
+		Attempts:   5,
+		Backoff:    2 * time.Second,
+		store:      store,
+		client:     &http.Client{Timeout: time.Minute},
+		accountSid: cfg.TwilioAccountSid,
+		authToken:  cfg.TwilioAuthToken,
+		apiHosts:   cfg.TwilioAPIHosts,
+		now:        cfg.now,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start downloads audio in the background, beginning with any voicemails left without audio
+// when the server last stopped
+func (a *Archiver) Start() {
+	a.wg.Add(1)
+	go a.run()
+}
+
+// Stop stops downloading audio once the download in progress is finished
+func (a *Archiver) Stop() {
+	close(a.done)
+	a.wg.Wait()
+}
+
+// Archive merges the details of a voicemail from a callback into the store, and queues the
+// audio to be downloaded if it hasn't been already.  It returns the voicemail with everything
+// known about it so far.
+func (a *Archiver) Archive(update VoicemailRecord) (VoicemailRecord, error) {
+	update.ReceivedAt = a.now()
+	v, err := a.store.Update(update.ID, func(v *VoicemailRecord) {
+		v.merge(update)
+	})
+	if err != nil {
+		return update, err
+	}
+	if len(v.Audio) == 0 && len(v.RecordingURL) > 0 {
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+	return v, nil
+}
+
+// run downloads the audio of every voicemail in the store without it, then waits to be woken
+// by a new voicemail and looks again.  A voicemail whose download failed isn't tried again until
+// the server restarts.
+func (a *Archiver) run() {
+	defer a.wg.Done()
+	failed := make(map[string]bool)
+	for {
+		all, err := a.store.List()
+		if err != nil {
+			logger.Error("Unable to list voicemails", "error", err)
+		}
+		for _, v := range all {
+			if len(v.Audio) > 0 || len(v.RecordingURL) == 0 || failed[v.ID] {
+				continue
+			}
+			select {
+			case <-a.done:
+				return
+			default:
+			}
+			if !a.archive(v.ID) {
+				failed[v.ID] = true
+			}
+		}
+		select {
+		case <-a.done:
+			return
+		case <-a.wake:
+		}
+	}
+}
+
+// archive downloads the audio of a voicemail, retrying with backoff, and records the outcome.  It
+// returns false if the audio couldn't be saved.
+func (a *Archiver) archive(id string) bool {
+	v, err := a.store.Get(id)
+	if err != nil {
+		logger.Error("Unable to archive voicemail", "recording_sid", id, "error", err)
+		return false
+	}
+	if len(v.Audio) > 0 {
+		return true
+	}
+	wait := a.Backoff
+	for attempt := 1; ; attempt++ {
+		err = a.download(&v)
+		if err == nil || attempt >= a.Attempts {
+			break
+		}
+		logger.Warn("Voicemail download failed, retrying", "recording_sid", id, "wait", wait, "error", err)
+		select {
+		case <-a.done:
+			return false
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+
+	_, updateErr := a.store.Update(id, func(latest *VoicemailRecord) {
+		if err != nil {
+			logger.Error("Unable to download voicemail", "recording_sid", id, "recording_url", v.RecordingURL, "error", err)
+			latest.DownloadError = err.Error()
+			return
+		}
+		latest.Audio, latest.ContentType, latest.DownloadedAt, latest.DownloadError = v.Audio, v.ContentType, v.DownloadedAt, ""
+	})
+	if updateErr != nil {
+		logger.Error("Unable to archive voicemail", "recording_sid", id, "error", updateErr)
+	}
+	return err == nil && updateErr == nil
+}
+
+// download fetches the audio of the voicemail from Twilio into the store
+func (a *Archiver) download(v *VoicemailRecord) error {
+	req, err := http.NewRequest("GET", v.RecordingURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(a.accountSid) > 0 && twilioAPIHost(a.apiHosts, v.RecordingURL) {
+		req.SetBasicAuth(a.accountSid, a.authToken)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("recording download returned %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	name, err := a.store.PutAudio(v.ID, contentType, resp.Body)
+	if err != nil {
+		return err
+	}
+	v.Audio, v.ContentType, v.DownloadedAt = name, contentType, a.now()
+	return nil
+}
+
+// RecordingStatus handles the RecordingStatusCallback sent when a voicemail recording is ready,
+// which usually arrives before the transcription
+func RecordingStatus(cfg Config, archiver *Archiver, calls *CallLog) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rs twiml.RecordingStatusCallbackRequest
+		if err := twiml.Bind(&rs, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		if rs.RecordingStatus == "completed" {
+			_, err := archiver.Archive(VoicemailRecord{
+				ID:           rs.RecordingSid,
+				CallSid:      rs.CallSid,
+				Mailbox:      r.URL.Query().Get("mailbox"),
+				Duration:     rs.RecordingDuration,
+				RecordingURL: rs.RecordingURL,
+			})
+			if err != nil {
+				requestLog(r).Error("Unable to archive voicemail", "recording_sid", rs.RecordingSid, "error", err)
+			}
+			calls.Update(rs.CallSid, func(c *CallRecord) {
+				c.Outcome, c.VoicemailID = OutcomeVoicemail, rs.RecordingSid
+			})
+		}
+		w.WriteHeader(200)
+	}
+}
@@ -0,0 +1,127 @@
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archiver", func() {
+	var dir string
+	var store *FileStore
+	var archiver *Archiver
+	var twilio *httptest.Server
+	var untrust func()
+	var requests, failures int32
+	var user, password string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "voicemails")
+		Expect(err).ToNot(HaveOccurred())
+		store, err = NewFileStore(dir)
+		Expect(err).ToNot(HaveOccurred())
+
+		atomic.StoreInt32(&requests, 0)
+		failures = 2
+		twilio = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, _ = r.BasicAuth()
+			if atomic.AddInt32(&requests, 1) <= atomic.LoadInt32(&failures) {
+				http.Error(w, "try again", 503)
+				return
+			}
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write([]byte("ID3 hello"))
+		}))
+		untrust = trustServer(twilio)
+
+		cfg := Config{TwilioAccountSid: "AC123", TwilioAuthToken: "12345", TwilioAPIHosts: []string{strings.TrimPrefix(twilio.URL, "https://")}}
+		archiver = NewArchiver(cfg, store)
+		archiver.Backoff = time.Millisecond
+		archiver.Attempts = 3
+		archiver.Start()
+	})
+
+	AfterEach(func() {
+		archiver.Stop()
+		untrust()
+		twilio.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("merges callbacks and downloads the audio after retrying", func() {
+		_, err := archiver.Archive(VoicemailRecord{ID: "RE123", CallSid: "CA123", Duration: 12, RecordingURL: twilio.URL + "/RE123"})
+		Expect(err).ToNot(HaveOccurred())
+		merged, err := archiver.Archive(VoicemailRecord{ID: "RE123", From: "+15557654321", To: "+15550001111", Transcript: "Call me back"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(merged.Duration).To(Equal(12))
+		Expect(merged.Transcript).To(Equal("Call me back"))
+
+		Eventually(func() string {
+			v, _ := store.Get("RE123")
+			return v.Audio
+		}).Should(Equal("RE123.mp3"))
+
+		v, err := store.Get("RE123")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v.From).To(Equal("+15557654321"))
+		Expect(v.Transcript).To(Equal("Call me back"))
+		Expect(v.Duration).To(Equal(12))
+		Expect(v.DownloadError).To(BeEmpty())
+		Expect(atomic.LoadInt32(&requests)).To(BeNumerically("==", 3))
+		Expect(user).To(Equal("AC123"))
+		Expect(password).To(Equal("12345"))
+
+		audio, err := store.Audio("RE123")
+		Expect(err).ToNot(HaveOccurred())
+		defer audio.Close()
+		b, _ := ioutil.ReadAll(audio)
+		Expect(string(b)).To(Equal("ID3 hello"))
+	})
+
+	It("records the error when the download keeps failing", func() {
+		atomic.StoreInt32(&failures, 10)
+		_, err := archiver.Archive(VoicemailRecord{ID: "RE456", RecordingURL: twilio.URL + "/RE456"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() string {
+			v, _ := store.Get("RE456")
+			return v.DownloadError
+		}).Should(ContainSubstring("503"))
+		Expect(atomic.LoadInt32(&requests)).To(BeNumerically("==", 3))
+	})
+
+	It("downloads every voicemail however many arrive at once", func() {
+		atomic.StoreInt32(&failures, 0)
+		for i := 0; i < 150; i++ {
+			id := fmt.Sprintf("RE%03d", i)
+			_, err := archiver.Archive(VoicemailRecord{ID: id, RecordingURL: twilio.URL + "/" + id})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		Eventually(func() int {
+			all, _ := store.List()
+			downloaded := 0
+			for _, v := range all {
+				if len(v.Audio) > 0 {
+					downloaded++
+				}
+			}
+			return downloaded
+		}, "5s").Should(Equal(150))
+	})
+
+	It("rejects ids that aren't safe file names", func() {
+		Expect(store.Put(VoicemailRecord{ID: "../etc/passwd"})).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Attachment is a file attached to email notifications
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// recordingClient downloads recordings to attach to notifications
+var recordingClient = &http.Client{Timeout: time.Minute}
+
+// recordingAttachment downloads a voicemail recording to attach to the notification, in the
+// configured audio format.  A recording over the size limit returns nil, leaving the link in the
+// notification as the way to listen to it.
+func recordingAttachment(cfg Config, name string, recordingURL string) (*Attachment, error) {
+	u := recordingURL
+	if len(path.Ext(u)) == 0 {
+		u += "." + cfg.AttachAudioFormat
+	}
+	resp, err := getRecording(cfg, u, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && len(cfg.TwilioAccountSid) > 0 && twilioAPIHost(cfg.TwilioAPIHosts, u) {
+		resp.Body.Close()
+		if resp, err = getRecording(cfg, u, true); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("recording download returned %s", resp.Status)
+	}
+	if resp.ContentLength > int64(cfg.AttachAudioMaxBytes) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(cfg.AttachAudioMaxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > cfg.AttachAudioMaxBytes {
+		return nil, nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	return &Attachment{
+		Name:        name + audioExtension(contentType),
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// archivedAttachment reads the audio of a voicemail saved in the store to attach to the
+// notification.  It returns false if the store doesn't have the audio, so that it can be
+// downloaded instead.  Audio over the size limit returns nil, as for recordingAttachment.
+func archivedAttachment(cfg Config, store VoicemailStore, n Notification) (*Attachment, bool, error) {
+	if store == nil || len(n.VoicemailID) == 0 {
+		return nil, false, nil
+	}
+	v, err := store.Get(n.VoicemailID)
+	if err != nil || len(v.Audio) == 0 {
+		return nil, false, nil
+	}
+	audio, err := store.Audio(v.ID)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer audio.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(audio, int64(cfg.AttachAudioMaxBytes)+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if len(data) > cfg.AttachAudioMaxBytes {
+		return nil, true, nil
+	}
+	contentType := v.ContentType
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	return &Attachment{
+		Name:        voicemailName(n.From) + audioExtension(contentType),
+		ContentType: contentType,
+		Data:        data,
+	}, true, nil
+}
+
+// twilioAPIHost returns true if the URL is HTTPS on api.twilio.com or one of the other hosts,
+// which are trusted with the account's credentials
+func twilioAPIHost(hosts []string, u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != "https" {
+		return false
+	}
+	for _, host := range append([]string{"api.twilio.com"}, hosts...) {
+		if strings.EqualFold(parsed.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// getRecording requests a recording, with the Twilio credentials when auth is set
+func getRecording(cfg Config, u string, auth bool) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth {
+		req.SetBasicAuth(cfg.TwilioAccountSid, cfg.TwilioAuthToken)
+	}
+	return recordingClient.Do(req)
+}
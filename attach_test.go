@@ -0,0 +1,236 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Voicemail attachments", func() {
+	var server *fakeSMTP
+	var twilio *httptest.Server
+	var untrust func()
+	var requested []string
+	var cfg *Config
+	audio := bytes.Repeat([]byte("ID3"), 100)
+
+	BeforeEach(func() {
+		requested = nil
+		server = newFakeSMTP(nil, false)
+		twilio = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			requested = append(requested, r.URL.Path)
+			if !ok || user != "AC123" || password != "12345" {
+				w.WriteHeader(401)
+				return
+			}
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write(audio)
+		}))
+		untrust = trustServer(twilio)
+		c := testConfig()
+		// without channels listed the notifications are emailed through SMTP
+		c.Notifiers = nil
+		c.TwilioAccountSid = "AC123"
+		c.TwilioAPIHosts = []string{strings.TrimPrefix(twilio.URL, "https://")}
+		c.SMTPHost = "127.0.0.1"
+		c.SMTPPort = server.port()
+		c.SMTPSecurity = SMTPNone
+		c.SMTPFrom = "voicemail@example.com"
+		c.AttachAudio = true
+		cfg = &c
+	})
+
+	AfterEach(func() {
+		server.Close()
+		untrust()
+		twilio.Close()
+	})
+
+	// parts returns the content type of each part of the message received, and the attachment
+	parts := func() ([]string, []byte, string) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		msg, err := mail.ReadMessage(bytes.NewReader(server.data))
+		Expect(err).ToNot(HaveOccurred())
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		Expect(err).ToNot(HaveOccurred())
+		if mediaType != "multipart/mixed" {
+			return []string{mediaType}, nil, ""
+		}
+		var types []string
+		var attached []byte
+		var filename string
+		mr := multipart.NewReader(msg.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+			if len(part.FileName()) > 0 {
+				filename = part.FileName()
+				b, _ := ioutil.ReadAll(part)
+				attached, err = base64.StdEncoding.DecodeString(strings.Replace(string(b), "\r\n", "", -1))
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}
+		return types, attached, filename
+	}
+
+	It("attaches the recording, downloaded with Twilio credentials", func() {
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+1 555 765 4321", Transcript: "Call me back", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Expect(requested).To(Equal([]string{"/Recordings/RE123.mp3", "/Recordings/RE123.mp3"}))
+		types, attached, filename := parts()
+		Expect(types).To(Equal([]string{"multipart/alternative", "audio/mpeg"}))
+		Expect(filename).To(Equal("voicemail-15557654321.mp3"))
+		Expect(attached).To(Equal(audio))
+	})
+
+	It("falls back to the link when the recording is over the size limit", func() {
+		cfg.AttachAudioMaxBytes = len(audio) - 1
+		cfg.AttachAudioFormat = "wav"
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Expect(requested[0]).To(Equal("/Recordings/RE123.wav"))
+		types, attached, _ := parts()
+		Expect(types).To(Equal([]string{"multipart/alternative"}))
+		Expect(attached).To(BeNil())
+	})
+
+	It("sends the notification when the recording can't be downloaded", func() {
+		cfg.TwilioAccountSid = ""
+		cfg.AttachAudioFormat = "ogg"
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("ATTACH_AUDIO_FORMAT"))))
+		cfg.AttachAudioFormat = "mp3"
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Expect(requested).To(HaveLen(1))
+		types, _, _ := parts()
+		Expect(types).To(Equal([]string{"multipart/alternative"}))
+	})
+
+	It("only sends the Twilio credentials to Twilio", func() {
+		cfg.TwilioAPIHosts = nil
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Expect(requested).To(HaveLen(1))
+		types, attached, _ := parts()
+		Expect(types).To(Equal([]string{"multipart/alternative"}))
+		Expect(attached).To(BeNil())
+	})
+
+	It("only sends the Twilio credentials over HTTPS", func() {
+		plain := httptest.NewServer(twilio.Config.Handler)
+		defer plain.Close()
+		cfg.TwilioAPIHosts = []string{strings.TrimPrefix(plain.URL, "http://")}
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: plain.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Expect(requested).To(HaveLen(1))
+		_, attached, _ := parts()
+		Expect(attached).To(BeNil())
+	})
+
+	It("doesn't download the recording for channels that can't attach it", func() {
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer hook.Close()
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierWebhook, URL: hook.URL}}
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+		Expect(requested).To(BeEmpty())
+	})
+
+	It("downloads the recording once however many times the email is retried", func() {
+		dir, err := ioutil.TempDir("", "attach")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		server.Close()
+		Expect(cfg.Validate()).To(BeEmpty())
+		outbox, err := NewOutbox(*cfg, dir)
+		Expect(err).ToNot(HaveOccurred())
+		outbox.Backoff, outbox.MaxAttempts = time.Millisecond, 3
+		outbox.Start()
+		defer outbox.Stop()
+
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", RecordingURL: twilio.URL + "/Recordings/RE123"}
+		Expect(outbox.Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		var dead []OutboxEntry
+		Eventually(func() []OutboxEntry {
+			dead, _ = ReadOutbox(filepath.Join(dir, "dead"))
+			return dead
+		}).Should(HaveLen(1))
+		Expect(dead[0].Attempts).To(Equal(3))
+		Expect(dead[0].Notification.Attachments).To(HaveLen(1))
+		Expect(dead[0].Notification.Attachments[0].Data).To(Equal(audio))
+		Expect(requested).To(Equal([]string{"/Recordings/RE123.mp3", "/Recordings/RE123.mp3"}))
+	})
+
+	It("attaches the audio the archiver saved instead of downloading it again", func() {
+		dir, err := ioutil.TempDir("", "attach")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		store, err := NewFileStore(filepath.Join(dir, "voicemails"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Put(VoicemailRecord{ID: "RE123", RecordingURL: twilio.URL + "/Recordings/RE123"})).To(Succeed())
+		name, err := store.PutAudio("RE123", "audio/x-wav", bytes.NewReader([]byte("RIFF archived")))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Update("RE123", func(v *VoicemailRecord) { v.Audio, v.ContentType = name, "audio/x-wav" })
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cfg.Validate()).To(BeEmpty())
+		outbox, err := NewOutbox(*cfg, filepath.Join(dir, "outbox"))
+		Expect(err).ToNot(HaveOccurred())
+		outbox.Store = store
+		outbox.Start()
+		defer outbox.Stop()
+
+		profile, _ := cfg.Mailbox("default")
+		v, err := store.Get("RE123")
+		Expect(err).ToNot(HaveOccurred())
+		v.From = "+15557654321"
+		Expect(outbox.Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		Eventually(func() []OutboxEntry {
+			queued, _ := ReadOutbox(filepath.Join(dir, "outbox"))
+			return queued
+		}).Should(BeEmpty())
+		Expect(requested).To(BeEmpty())
+		_, attached, filename := parts()
+		Expect(string(attached)).To(Equal("RIFF archived"))
+		Expect(filename).To(Equal("voicemail-15557654321.wav"))
+	})
+})
@@ -1,7 +1,14 @@
 // Code generated by go-bindata.
 // sources:
+// templates/inbox.html
+// templates/message.subject
+// templates/message.txt
+// templates/missed_call.subject
+// templates/missed_call.txt
 // templates/voicemail.html
 // templates/voicemail.mjml
+// templates/voicemail.subject
+// templates/voicemail.txt
 // DO NOT EDIT!
 
 package main
@@ -69,7 +76,107 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _templatesVoicemailHtml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xec\x59\x6d\x6f\xdb\x36\x10\xfe\x9e\x5f\x71\x51\x30\xa0\x1d\x42\x4b\x89\xfb\x16\x59\xf2\x9a\x26\xed\x56\xa0\xdb\x8a\x2e\x01\x36\x14\xc1\x40\x53\x67\x9b\x0d\x45\x6a\x24\x65\xcb\xf3\xf2\xdf\x07\x52\xb2\xad\xd8\x4e\x1a\xb4\x0b\xb0\x02\xf1\x07\x2b\x7c\xbb\x7b\xf8\xdc\xf1\x39\x99\x49\x76\x33\xc5\xec\xac\x40\x18\xdb\x5c\xf4\x77\x12\xf7\x80\x2a\x17\xd2\xa4\xc1\xd8\xda\x22\x0e\xc3\xe9\x74\xda\x99\x76\x3b\x4a\x8f\xc2\x83\xa3\xa3\xa3\xb0\x72\x73\x82\x7a\x52\x3c\x49\x83\x52\xcb\xd8\xb0\x31\xe6\xd4\x90\x9c\x33\xad\x8c\x1a\x5a\xc2\x54\x1e\x4f\x56\xf3\xd4\x6d\xf3\xd4\x70\xc8\x19\x36\x8f\xc0\xa1\x40\x9a\xf5\x77\x00\x12\xcb\xad\xc0\x7e\x12\xd6\x4f\xd7\xb3\x4b\xc8\x47\x3e\x84\xdd\xdc\xa8\x8b\xbe\x6b\x01\x21\x7e\x20\x47\x4b\xc1\x41\x26\xf8\x57\xc9\x27\x69\xf0\x3b\x39\x3f\x26\x27\x2a\x2f\xa8\xe5\x03\x81\x01\x30\x25\x2d\x4a\x9b\x06\x6f\x5f\xa7\x98\x8d\x9c\xa7\xda\x60\xb2\xfb\x11\x65\xc6\x87\x17\xce\xd4\xa6\xa1\x93\x7a\x1d\x39\x9b\x15\x6d\x2b\x16\x2b\x1b\x3a\x2e\x7a\xc0\xc6\x54\x1b\xb4\xe9\xf9\xd9\x1b\xf2\xc2\x6d\xc0\xd8\x99\x40\x70\xc4\x36\xf3\x98\x31\xde\xdd\x9e\x2a\xad\x50\xea\x12\x28\xcc\xa1\xa0\x59\xc6\xe5\x28\x86\xa8\x07\x57\x3b\x00\x9d\x0f\x48\xb3\x9f\xcd\xe8\x95\xca\x66\x30\x87\x29\xcf\xec\x38\x86\x83\x28\xfa\xae\x19\x7f\x5d\x59\xd4\x92\x8a\x13\x41\x8d\xb9\xc3\x8c\xef\x61\x0e\x82\x4b\x24\x63\xe4\xa3\xb1\x8d\x57\x13\x07\xb5\x8b\x9c\xea\x11\x97\x1e\x40\x1b\x0c\x99\xe2\xe0\x92\x5b\xe2\xa0\x13\xc3\xff\x46\x42\xb3\x4f\xa5\xb1\x0b\x57\x24\x37\x37\x8e\x39\xeb\x96\x0e\x04\xee\x83\xcd\x60\x0e\x03\xa5\x33\xd4\x84\x29\x21\x68\x61\x30\x5e\xfc\xd1\x83\xdc\x28\xe2\x67\x12\x61\x0a\xca\x30\x86\xa8\xb0\xed\x6e\xdd\xee\x76\x76\x79\x3e\x5a\x5a\xf4\x40\x9b\x7d\x01\x2d\xad\xea\x5d\xdb\x6a\x83\xc6\xd1\xcd\x25\xc6\x20\x95\xc4\x1e\x78\xd0\x19\x32\xa5\xa9\xe5\x4a\x2e\xba\xdd\x7e\xb8\xb4\xa8\x0b\x25\xfc\x00\xc9\x55\x86\x31\x0c\x38\x2b\x07\x9c\xd5\xce\x0b\x98\x43\xc6\x4d\x21\xe8\x2c\x86\x81\x50\xec\xb2\xb7\xe4\xef\xa0\x5b\x54\x75\x14\x93\xd0\xc7\xbe\xbf\xb3\x99\xa9\xb7\xe5\xc5\xcb\x1c\x33\x4e\x41\x49\x31\x03\xc3\x34\xa2\x04\x2a\x33\x78\x94\xd3\x8a\xd4\x51\x7e\xf2\x22\x2a\xaa\xc7\x30\xdf\x01\x00\x78\xe9\x10\x4f\x38\x4e\x0b\xa5\xed\x32\x11\xba\x87\x51\x51\xd5\x60\x01\x5e\xde\x36\xbc\x86\xf3\xfa\x01\x68\x80\x7b\xdc\x3b\x49\xe5\x74\x01\x20\x51\xf1\xaf\xfe\x7c\x9e\x2a\x56\xe6\x28\xed\x6f\x68\x2d\x97\x23\xd3\xf7\xde\x12\x15\x1f\x0b\xa1\xa6\xef\x7f\xf9\x31\x5c\xf6\xbc\xe7\x15\x0a\xf3\x1e\xf5\x5b\xc9\xc6\xfd\xa3\x67\x49\xb8\xde\xe7\x0c\x87\x37\x5b\x4e\x42\xef\x7d\x2b\x3c\x61\xd1\x41\x84\x83\x83\x8b\xdb\x88\xed\x34\x07\x8e\x8c\xb4\x2a\x0b\x32\xe4\x55\x43\x61\xcd\x89\xcb\x12\xd8\xe5\xb9\x23\x8a\x4a\xdb\x5b\xe7\xa6\xe5\x78\x6b\x44\xfd\x4e\x05\x97\x97\x30\xd6\x38\xac\x35\xd3\xc4\x61\x38\x54\xd2\x9a\xce\x48\xa9\x91\x40\x5a\x70\xd3\x61\x2a\x77\x98\x7e\x18\xd2\x9c\x8b\x59\x7a\x3e\x28\xa5\x2d\xe3\x6e\x14\xed\x3f\x89\xa2\xfd\xa7\x51\xb4\xff\x3c\x8a\x02\xd0\x28\xd2\xc0\x7b\x37\x63\x44\x1b\x6c\xdb\x12\xc0\x4d\xdb\xf5\x83\x3e\xf8\xf5\x8e\xa0\xd4\xe2\xd1\xd7\x41\x7a\xdc\xab\xad\x2e\x39\xd9\x94\xcc\x2f\xc8\x6a\x2e\xb7\x65\x75\x27\xff\xe4\x74\xa2\xcc\x25\x29\x50\x93\x83\x28\x5a\xe6\xae\x8b\x53\x2b\x4c\x1b\x49\x1c\xd6\x25\x23\x71\xba\xe6\x31\x66\x7c\xd2\x6f\x65\x32\xfc\x03\x6f\x5f\x5f\xf4\x1b\x82\x12\xaf\x2f\xa0\x95\xc0\x34\x28\x34\x1a\x94\xd6\x9f\xfb\xa0\x11\x97\x34\x88\x02\x60\x28\x44\xa3\x8a\xcb\xb6\x53\xa4\x45\xdb\x23\x4b\x83\x67\x2e\x6e\x54\xf0\x91\x4c\x03\x86\x4e\x45\x02\xf0\xb0\xd2\xa0\xc6\xfe\x2c\x72\xe7\x2e\xe8\x2f\xa3\x93\x58\xbd\x6a\xb8\x66\xb6\x58\xd0\x56\x30\xb7\xc8\xc5\xcc\x8b\xac\x6f\x39\x65\x6c\xcd\x20\xba\x14\x18\x63\x45\x99\x15\xb3\x95\xfd\x6b\xa1\xc9\xf8\x64\x61\xbb\xd1\xaa\xa8\xa8\x6a\xb9\x5c\x49\xcb\x02\xe0\x2d\xb4\x7c\x8e\x8b\xc6\xc7\x75\xbc\xab\xd0\xf5\x36\x18\x5a\xf1\xdc\x4f\xac\x8f\x9a\x63\xa5\x45\x85\x97\x6a\xbf\x28\x16\x38\xb4\xbd\x09\x6a\xcb\x19\x15\x4d\x9f\x55\x45\x2f\xe3\x1a\x99\xd7\x71\x61\xf5\x1a\x57\x8b\x72\xe6\x34\x0f\x9a\xed\xdd\x6b\x3a\xac\xe3\xdf\x82\x77\x6b\x3a\x6c\x84\x8b\xb9\xd2\x9d\x06\x9b\x67\x61\x43\xc9\x82\x5b\x7c\x2d\x2a\x15\x97\x3e\x63\xea\x7a\x75\x13\x61\xae\x7c\xf5\xd6\x09\x6f\x47\xef\x6b\x52\xa3\x39\x26\xce\xd0\x1d\xc2\x3e\x55\x3a\x23\x03\x8d\xf4\x32\xf6\xdf\xc4\x75\xdc\x10\xdb\x03\x17\xdb\xc3\xa7\x8e\xcd\x45\x7a\x39\xe4\xc1\x35\x1e\x97\x24\xb1\x52\x1b\xa5\x63\x9f\xfb\x4c\x09\xa5\xe3\xbd\xee\x49\xf7\xb4\x7b\x5a\x5b\xaf\x55\x30\xae\x55\x70\x1f\x7e\x42\x31\x41\x47\xea\x3e\x1c\x6b\x4e\xc5\x3e\x18\x2a\x0d\x31\xa8\xf9\xb0\xcd\xdc\x61\x51\xf5\xda\xa7\xf6\xf0\x70\x0b\x95\x41\xfb\xb8\xaf\x3e\x7f\xa8\x12\xc6\x74\x82\xa0\x91\x21\x9f\x60\x06\x14\x26\x8a\x33\xcc\x29\x17\x30\xd4\x2a\x87\xf9\xbc\xf3\x46\xab\xfc\xea\xaa\x03\x70\x36\x46\xb0\x9a\x4a\xc3\x34\x2f\x1c\xf7\xc0\x0d\x0c\x50\xa8\x69\xbc\x61\x3e\x09\xbd\x00\x86\x36\x73\x5f\xda\x7d\xd5\x6c\x87\x3e\x90\xfd\x66\xfc\xc6\x13\xd1\x5e\xe8\x17\x6c\xcb\xd6\x7b\xb5\xbe\xec\x7a\xd0\xf0\xbb\x6b\xf8\x80\xb2\x4b\x27\x0f\x32\x8b\xf7\x4e\x9f\x9f\x1e\x9f\xbe\xba\x5f\x59\xdf\xe6\xef\x41\xe9\x1f\x94\xfe\x3e\x94\xfe\x1b\x15\xf9\xf9\xbc\x73\xd6\x16\xed\x33\xac\xec\xd5\x95\x1b\x79\x10\xed\x07\xd1\xfe\x7f\xbf\x78\xd7\x6b\x1e\x04\xf9\x41\x90\xef\xf0\xea\xdd\x24\xd8\x7f\x90\xcc\xeb\x57\x86\x06\x0b\xaa\xa9\xc5\x2f\x48\xe6\xe6\xae\xd0\x5f\xf3\x35\x66\x35\xcd\x78\x69\x62\xc7\x7b\x53\x21\x86\xfe\xd3\x6b\xd7\x8e\xcf\xef\x13\x26\x4d\x3b\xe7\x59\x26\x30\x80\xc1\xc8\x9b\x4b\x83\xbd\x43\xd6\xc5\xa7\x0e\x12\x6d\x6e\x85\xe6\xf3\xce\x07\x64\x4a\x3b\x93\xe7\x1f\xde\x5d\x5d\x05\xd7\x0e\x5b\xeb\x42\xd2\x03\xdd\xb8\xb2\x6d\xbf\x66\xd5\xc6\xd7\xa0\x7f\x4d\x71\xeb\x2e\xe4\x6e\x5a\x7b\x94\x4a\xe7\x54\xd4\x39\xe9\x7f\x6e\x0c\x95\xce\x6b\x60\x2b\x25\xeb\x05\x60\xa9\x1e\xa1\x4d\x83\x3f\x07\x82\xca\xcb\x1b\xaa\xdf\x3b\x6e\x2c\x4a\xb0\x6a\xf5\xc3\x66\x4b\xd9\xa3\xb7\x96\xa5\x6f\xb7\x1c\xd6\x36\x76\x92\xb0\xbe\x96\x4a\xfc\xbf\x0b\xfa\xff\x06\x00\x00\xff\xff\x6c\xe1\x6d\x41\x75\x19\x00\x00")
+var _templatesInboxHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x55\x5d\x8f\x1b\x35\x17\xbe\xdf\x5f\x71\xde\x69\x5f\xb5\x95\x36\x33\xc9\x76\x0b\x55\x32\x09\x2a\x2c\x15\x20\x16\x41\x69\xb9\x41\x5c\x38\xe3\x93\x8c\x85\xc7\x9e\xda\x67\xb2\x09\xd6\xfc\x77\x64\x7b\xbe\x36\xbb\x05\x84\x98\x9b\xf8\xeb\x3c\xe7\x39\xcf\xf9\x48\xfe\x3f\xae\x0b\x3a\xd5\x08\x25\x55\x72\x73\x91\xf7\x3f\xc8\xf8\xe6\x02\x20\x27\x41\x12\x37\xbf\x68\x51\x60\xc5\x84\xcc\xb3\x78\xe0\xaf\x2a\x24\x06\x25\x51\x3d\xc3\x8f\x8d\x38\xac\x93\xaf\xb4\x22\x54\x34\x7b\x7f\xaa\x31\x81\x22\xee\xd6\x09\xe1\x91\x32\x8f\xbb\x82\xa2\x64\xc6\x22\xad\x3f\xbc\x7f\x3b\x7b\x9d\x8c\x28\x8a\x55\xb8\x4e\x0e\x02\xef\x6a\x6d\x68\x62\x7b\x27\x38\x95\x6b\x8e\x07\x51\xe0\x2c\x6c\x2e\x41\x28\x41\x82\xc9\x99\x2d\x98\xc4\xf5\x22\xc2\x58\x3a\x49\x04\x1f\x49\xe7\xb0\xb0\x36\xdc\x00\x6c\x35\x3f\x81\x83\x8a\x99\xbd\x50\x4b\x98\xaf\xa0\x66\x9c\x0b\xb5\x5f\xc2\xd5\xbc\x3e\xae\x60\xa7\x15\xcd\x76\xac\x12\xf2\xb4\x84\x0f\xdb\x46\x51\x73\x09\xdf\xa0\x3c\x20\x89\x82\x5d\xc2\x1b\x23\x98\xbc\x04\xcb\x94\x9d\x59\x34\x62\xb7\x82\x42\x4b\x6d\x96\xf0\x64\x1e\xbe\x15\xb4\xc1\x53\xb9\x00\x17\xd1\xac\xf8\x03\x97\x70\xf5\x7a\x80\xbf\x43\xb1\x2f\x69\x09\x2f\xe7\xf3\xd5\x48\x05\xe6\x81\x82\xe7\x14\x11\x76\xda\x54\xa9\x45\x66\x8a\x72\xa0\x3c\xdb\x6a\x22\x5d\xf5\x6c\x1f\x3e\x14\xaa\x6e\xe8\xd7\x10\x7b\x34\xfd\x0d\x1c\x04\xb1\x82\xbf\xfa\x38\x89\xf8\xb3\x81\x51\xa4\xb8\xb8\x1e\x31\x89\x6d\x25\x82\x83\xad\x36\x1c\xcd\xac\xd0\x52\xb2\xda\xe2\x12\xfa\xd5\xaa\x47\x5d\xcc\xe7\xff\x1f\xac\x3c\x53\x2f\xf9\x8c\x49\xb1\x57\x4b\x90\xb8\xa3\xb3\xa8\x5f\xf9\xa8\x3b\xd8\x3e\x9a\x45\x7d\x04\xab\xa5\xe0\xf0\xa4\x08\xdf\x84\xe5\xeb\x09\x29\x0e\x0e\x0e\x68\x7c\x2a\x64\xef\x82\x74\xfd\x57\x78\x18\xbe\x73\xbc\x4f\x45\x6d\xd2\x46\x19\x64\x3c\xba\xba\xc7\xfb\xf3\x31\xb7\xc4\x53\x32\x4c\xd9\xc2\x88\x9a\x42\x6e\x8e\xb3\x4e\x8d\xeb\x79\x28\xa3\xbe\x26\x5e\x85\x6f\x62\xc7\x0a\x12\x5a\xd9\x90\x33\x70\xc0\x85\xad\x25\x3b\x2d\x41\x28\x29\x14\xf6\x0f\xb7\x0d\x91\x56\xe0\xee\xf1\x7c\x79\x2f\x79\xd7\xf5\x71\x2a\x4d\x8a\x55\x4d\xbe\xb4\x1f\xf7\x9c\xa2\x31\xda\x4c\xae\x19\x8b\xc5\x3a\x75\x70\xd5\xc3\xe5\x59\x68\xa1\xcd\x45\x9e\xc5\xe6\xcf\x7d\xdf\xf8\x0e\xca\xcb\xc5\x38\x00\x9c\x13\x3b\x48\x3f\x04\xc1\xda\x16\x9e\x3b\x37\x6e\xa2\x8c\x2f\x9c\x43\xc5\xdb\x36\xcf\xca\x45\x30\x0f\x61\x17\x92\x59\xbb\x4e\x62\x7d\x26\x50\x21\x95\x9a\xaf\x93\x3d\x52\x02\x51\x9f\x75\xe2\x5c\xfa\x25\xb3\xd8\xb6\x5d\xe3\xe6\xa1\xb0\xbb\xa6\xee\x2d\xe3\xa8\xf8\x98\xc0\x81\xc9\x06\x83\xd1\x4f\x0d\x9a\x53\xdb\x26\x50\x4b\x56\x60\xa9\x25\x47\xb3\x4e\x7e\x0e\x06\x30\x26\xcd\x02\x53\x1c\x0a\x26\x25\x9a\x7e\x36\xe4\x9d\xea\x9d\x8f\x66\x5b\x09\x4a\x36\xd1\x34\xcf\xe2\xa5\x7f\x99\x67\x3e\x0a\xbf\x8a\x02\x0c\x7a\xd8\x36\x88\x17\x5a\xa7\x83\x24\x13\x17\x7e\x59\x6e\xde\x1a\x5d\xe5\x19\x95\xd3\xb3\x77\x58\xa0\x38\x20\x3f\x3f\xff\x1e\xd5\x9e\xca\xf3\xd3\x5b\xb4\x96\xed\xf1\xfc\x78\xdc\xe7\x59\xef\xd2\x39\xc3\xd4\x1e\x1f\xf0\xf3\x16\xa6\xcf\x41\x88\x40\x69\x82\xf4\x5d\xc8\x5b\x4c\x5b\x97\xb5\x4e\x17\x6f\xc0\x37\xce\xa5\x9e\x7e\xdb\x06\x93\xf4\x96\x09\xb9\xd5\xc7\xb6\xcd\xb7\x66\xb3\xf3\xa5\xe5\xc6\xb3\x21\xeb\xc4\xcf\x20\xfa\x68\xdf\x50\xfa\x56\x9b\x8a\x11\x24\xdf\x31\x05\x57\xf0\x72\x39\xbf\x86\x1f\x6f\x93\xc7\xac\x78\x63\x98\xaf\x0a\x48\x6f\xba\xd5\x83\x57\x7d\x3c\x63\x86\x07\xf2\x00\x39\x17\x87\x8d\x73\x56\x89\xba\x46\x82\xf4\xfd\xf0\xc8\xe3\xf8\xcb\xe1\x69\x0c\xee\x4d\xc3\x85\x6e\xdb\x9c\xf9\xdf\xf0\x07\x64\xb4\xb4\x50\x1b\x94\x9a\xf1\x75\xa2\xb4\xc2\x04\xac\x29\x7c\xc9\x3d\xed\x0a\x35\x73\x2e\xfd\xf6\xa6\x6d\xb3\x60\x95\x6c\xf2\xb8\xd8\x38\x87\xd2\x22\x78\xdc\x1b\x7d\xa7\x3c\xc2\xd7\xbe\x19\xdb\xd6\xf3\xea\x89\x87\xfe\x4c\x36\xc1\x73\x48\x08\xef\xde\x22\x5f\x7a\x6d\xcf\x4d\x03\xed\x4e\xe7\x8e\xfd\x27\x24\xe9\x26\xce\x54\x0f\x5f\xbf\x43\xdb\xd5\xda\xde\xeb\xbb\x07\xf1\xf8\x8a\x98\x58\x9f\xf5\x62\x29\x38\x47\xf5\x58\x2f\x3e\x1d\x9a\xf1\x1f\x1a\x07\x47\xa3\xbd\x57\x2c\x56\xe5\x8e\x49\x8b\x51\xc7\xb6\x25\xd3\x60\x17\xf8\x7d\xe0\x47\xdb\x77\x0a\x73\xcb\xcc\xef\xdd\x60\xea\xc1\xc2\xd1\xa4\xe4\xa7\x7d\xde\xc1\x0e\xdd\xfe\xaf\xc4\xe3\x28\x91\x30\x01\xad\x22\xa3\x75\x62\x90\x1a\xa3\x7c\x55\xed\x84\xa9\x9e\x3f\xbb\x09\x2f\x80\x4a\x61\xe1\xd0\xb7\xea\x17\xcf\x5e\xfc\x87\x92\x3f\xaa\x4c\xf4\xfb\x77\x01\x8f\x45\x35\x9d\x2c\x7d\xd9\xe5\xd9\x30\xec\x7a\x45\xfd\x04\xac\x87\xaa\xf6\x7f\x4a\x7d\x12\x3a\x6a\x3f\xe8\x31\x4c\x0b\x15\xa3\xa2\x84\x93\x6e\x0c\xc4\xa9\x9e\xf6\x40\xf7\xdf\x9d\x90\xd2\x21\x47\x75\xe7\xd0\xef\x2e\xf2\x2c\xfe\x39\xe5\x59\x49\x95\xdc\x5c\xfc\x39\x00\x2d\xda\x3a\x8e\xc7\x0a\x00\x00")
+
+func templatesInboxHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesInboxHtml,
+		"templates/inbox.html",
+	)
+}
+
+func templatesInboxHtml() (*asset, error) {
+	bytes, err := templatesInboxHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/inbox.html", size: 2759, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesMessageSubject = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x1b\x00\xe4\xff\x4e\x65\x77\x20\x6d\x65\x73\x73\x61\x67\x65\x20\x66\x72\x6f\x6d\x20\x7b\x7b\x2e\x46\x72\x6f\x6d\x7d\x7d\x0a\x03\x00\x12\xa6\x46\xd8\x1b\x00\x00\x00")
+
+func templatesMessageSubjectBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesMessageSubject,
+		"templates/message.subject",
+	)
+}
+
+func templatesMessageSubject() (*asset, error) {
+	bytes, err := templatesMessageSubjectBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/message.subject", size: 27, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesMessageTxt = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x76\x00\x89\xff\x59\x6f\x75\x20\x68\x61\x76\x65\x20\x72\x65\x63\x65\x69\x76\x65\x64\x20\x61\x20\x6e\x65\x77\x20\x6d\x65\x73\x73\x61\x67\x65\x20\x66\x72\x6f\x6d\x20\x7b\x7b\x2e\x43\x61\x6c\x6c\x65\x72\x7d\x7d\x0a\x0a\x7b\x7b\x2e\x42\x6f\x64\x79\x7d\x7d\x7b\x7b\x69\x66\x20\x2e\x4d\x65\x64\x69\x61\x55\x52\x4c\x73\x7d\x7d\x0a\x7b\x7b\x72\x61\x6e\x67\x65\x20\x2e\x4d\x65\x64\x69\x61\x55\x52\x4c\x73\x7d\x7d\x0a\x7b\x7b\x2e\x7d\x7d\x7b\x7b\x65\x6e\x64\x7d\x7d\x7b\x7b\x65\x6e\x64\x7d\x7d\x0a\x03\x00\x69\xd5\x9a\xa9\x76\x00\x00\x00")
+
+func templatesMessageTxtBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesMessageTxt,
+		"templates/message.txt",
+	)
+}
+
+func templatesMessageTxt() (*asset, error) {
+	bytes, err := templatesMessageTxtBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/message.txt", size: 118, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesMissed_callSubject = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x1b\x00\xe4\xff\x4d\x69\x73\x73\x65\x64\x20\x63\x61\x6c\x6c\x20\x66\x72\x6f\x6d\x20\x7b\x7b\x2e\x46\x72\x6f\x6d\x7d\x7d\x0a\x03\x00\x66\xf0\x56\x41\x1b\x00\x00\x00")
+
+func templatesMissed_callSubjectBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesMissed_callSubject,
+		"templates/missed_call.subject",
+	)
+}
+
+func templatesMissed_callSubject() (*asset, error) {
+	bytes, err := templatesMissed_callSubjectBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/missed_call.subject", size: 27, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesMissed_callTxt = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x80\x00\x7f\xff\x59\x6f\x75\x20\x6d\x69\x73\x73\x65\x64\x20\x61\x20\x63\x61\x6c\x6c\x20\x66\x72\x6f\x6d\x20\x7b\x7b\x2e\x43\x61\x6c\x6c\x65\x72\x7d\x7d\x20\x74\x6f\x20\x7b\x7b\x2e\x54\x6f\x7d\x7d\x20\x61\x74\x20\x7b\x7b\x2e\x54\x69\x6d\x65\x2e\x46\x6f\x72\x6d\x61\x74\x20\x22\x4a\x61\x6e\x20\x32\x20\x33\x3a\x30\x34\x20\x50\x4d\x20\x4d\x53\x54\x22\x7d\x7d\x2e\x20\x20\x54\x68\x65\x79\x20\x68\x75\x6e\x67\x20\x75\x70\x20\x77\x69\x74\x68\x6f\x75\x74\x20\x6c\x65\x61\x76\x69\x6e\x67\x20\x61\x20\x6d\x65\x73\x73\x61\x67\x65\x2e\x0a\x03\x00\x9c\x9b\x59\x7b\x80\x00\x00\x00")
+
+func templatesMissed_callTxtBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesMissed_callTxt,
+		"templates/missed_call.txt",
+	)
+}
+
+func templatesMissed_callTxt() (*asset, error) {
+	bytes, err := templatesMissed_callTxtBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/missed_call.txt", size: 128, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesVoicemailHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x58\x6d\x6f\xdb\x38\x12\xfe\xee\x5f\x31\x51\x70\x40\x7b\x08\x2d\x25\xee\x5b\x64\xc9\x97\x34\xe9\xdd\x15\xe8\xdd\x16\xdd\x04\xd8\x45\x11\x2c\x68\x6a\x6c\xb3\xa1\x48\x2d\x49\xf9\x65\xbd\xfe\xef\x0b\x52\xb2\xad\xd8\x8e\x53\x6c\x37\x1f\x76\x37\xb5\x61\x55\xe4\x70\x5e\x9e\x99\x79\xc8\x30\x39\xc8\x14\xb3\xb3\x02\x61\x64\x73\xd1\x6b\x25\xee\x01\xd3\x5c\x48\x93\x06\x23\x6b\x8b\x38\x0c\x27\x93\x49\x7b\xd2\x69\x2b\x3d\x0c\x8f\x4f\x4f\x4f\xc3\xa9\x93\x09\x2a\xa1\x78\x9c\x06\xa5\x96\xb1\x61\x23\xcc\xa9\x21\x39\x67\x5a\x19\x35\xb0\x84\xa9\x3c\x1e\xaf\xe5\xd4\x3e\x39\x35\x18\x70\x86\xf5\x23\x70\x5e\x20\xcd\x7a\x2d\x80\xc4\x72\x2b\xb0\x97\x84\xd5\xd3\x8d\x1c\x10\xf2\x99\x0f\xe0\x20\x37\xea\xa6\x97\x1c\x10\x02\x84\x78\xd1\x1c\x2d\x05\xe7\x32\xc1\x9f\x4b\x3e\x4e\x83\x1f\xc8\xf5\x39\xb9\x50\x79\x41\x2d\xef\x0b\x0c\x80\x29\x69\x51\xda\x34\x78\xff\x2e\xc5\x6c\x88\xc1\x52\x61\x72\xf0\x19\x65\xc6\x07\x37\x4e\xd5\xb6\xa2\x8b\x6a\x1d\xb9\x9a\x15\x4d\x2d\x16\xa7\x36\x74\x58\x74\x81\x8d\xa8\x36\x68\xd3\xeb\xab\x7f\x93\x37\x2e\x00\x63\x67\x02\xc1\x01\x5b\xcb\x31\x63\xbc\xb9\x43\x55\x5a\xa1\xd4\x2d\x50\x98\x43\x41\xb3\x8c\xcb\x61\x0c\x51\x17\x16\x2d\x80\xf6\x27\xa4\xd9\xff\xcc\xf0\xad\xca\x66\x30\x87\x09\xcf\xec\x28\x86\xe3\x28\xfa\x47\x3d\xff\x6e\x6a\x51\x4b\x2a\x2e\x04\x35\xe6\x2b\x24\xfe\x09\x73\x10\x5c\x22\x19\x21\x1f\x8e\x6c\xbc\x16\xec\x57\x26\x72\xaa\x87\x5c\x7a\x07\x9a\xce\x90\x09\xf6\x6f\xb9\x25\xce\x75\x62\xf8\x2f\x48\x68\xf6\xa5\x34\x76\x69\x8a\xe4\xe6\xde\x39\xa7\xdd\xd2\xbe\xc0\x23\xb0\x19\xcc\xa1\xaf\x74\x86\x9a\x30\x25\x04\x2d\x0c\xc6\xcb\xff\x74\x21\x37\x8a\x78\x49\x22\x4c\x41\x19\xc6\x10\x15\xb6\x39\xac\x9b\xc3\x4e\x2f\xcf\x87\x2b\x8d\xde\xe9\x3a\x2e\xa0\xa5\x55\xdd\x3b\xa1\xd6\xde\x38\xb8\xb9\xc4\x18\xa4\x92\xd8\x05\xef\x74\x86\x4c\x69\x6a\xb9\x92\xcb\x61\x17\x0f\x97\x16\x75\xa1\x84\x9f\x20\xb9\xca\x30\x86\x3e\x67\x65\x9f\xb3\xca\x78\x01\x73\xc8\xb8\x29\x04\x9d\xc5\xd0\x17\x8a\xdd\x76\x57\xf8\x1d\x77\x8a\xa9\xf3\x67\xd1\x4a\x42\x9f\xfb\x5e\x6b\xbb\x52\xf7\xd5\xc5\x59\x8e\x19\xa7\xa0\xa4\x98\x81\x61\x1a\x51\x02\x95\x19\x3c\xcb\xe9\x94\x54\x75\xf0\xe2\x4d\x54\x4c\x9f\xc3\xbc\x05\x00\x70\xe6\x3c\x1e\x73\x9c\x14\x4a\xdb\x55\x21\x74\x4e\xa2\x62\x5a\x15\x02\xc0\xd9\xbe\xe9\x0d\x3f\xef\x36\x40\xed\xb8\xef\xb0\x56\x32\x75\xbc\x00\x90\xa8\xf8\x3b\xdf\x9f\x97\x8a\x95\x39\x4a\xfb\x3d\x5a\xcb\xe5\xd0\xb8\x49\x3f\x7d\x2e\x84\x9a\x7c\xfc\xff\x7f\xc2\xd5\xc8\x47\x3e\x45\x61\x3e\xa2\x7e\x2f\xd9\xa8\x77\xfa\x2a\x09\x37\xc7\x5c\x03\x86\xf7\x6b\x4e\x42\x6f\x7d\xa7\x7b\xc2\xa2\x2b\x15\x38\x3e\xbe\xd9\x07\x6c\xbb\x6e\x38\x32\xd4\xaa\x2c\xc8\x80\x4f\x6b\x08\x2b\x54\x5d\x95\xc0\x01\xcf\x1d\x50\x54\xda\xee\x26\x36\x0d\xc3\x3b\x33\xea\x23\x15\x5c\xde\xc2\x48\xe3\xa0\xe2\x4c\x13\x87\xe1\x40\x49\x6b\xda\x43\xa5\x86\x02\x69\xc1\x4d\x9b\xa9\x3c\x64\xc6\xfc\x6b\x40\x73\x2e\x66\xe9\x75\xbf\x94\xb6\x8c\x3b\x51\x74\xf4\x22\x8a\x8e\x5e\x46\xd1\xd1\xeb\x28\x0a\x40\xa3\x48\x03\x9f\x19\x33\x42\xb4\xc1\xae\x90\x00\xee\x0b\xd7\x07\xe6\xbe\x67\x55\x44\x50\x6a\xf1\xec\xdb\x5c\x7a\xde\xad\xb4\xae\x30\xd9\xa6\xcc\xdf\x51\xd5\x5c\xee\xaa\xea\x76\xfe\xc5\xf1\x44\x99\x4b\x52\xa0\x26\xc7\x51\xb4\xaa\x5d\x97\xa7\x46\x9a\xb6\x8a\x38\xac\xb6\x8c\xc4\xf1\x9a\xb3\x9c\x64\x7c\xdc\x5b\x26\xcc\x95\xc9\xaf\xf0\xfe\xdd\x4d\xaf\x06\x28\xf1\xfc\x02\x5a\x09\x4c\x83\x42\xa3\x41\x69\x7d\xdf\x07\x35\xb9\xa4\x41\x14\x00\x43\x21\x6a\x56\x5c\xbd\x3b\x46\x5a\xbe\xfb\x08\xd2\xe0\x95\xcb\x1b\x15\x7c\x28\xd3\x80\xa1\x63\x91\x00\x3c\x22\x69\xe0\x25\xe2\x57\x91\x6b\xcb\x3a\x75\xee\x9b\x58\xbd\x7e\x71\xaf\xd9\x72\x41\x93\xc1\xdc\x22\x97\x33\x4f\xc0\xfe\xcd\x31\x63\x43\x82\xe8\x52\x60\x8c\x53\xca\xac\x98\xad\xf5\xdf\x49\x4d\xc6\xc7\x4b\xdd\x35\x57\x45\xc5\xb4\xa2\xcb\x35\xb5\x2c\x1d\xdc\x03\xcb\x43\x58\xd4\x36\xee\xfa\xbb\x4e\x5d\x77\x0b\xa1\x35\xce\xbd\xc4\xfa\xac\x25\x56\xf7\x1a\x50\x78\xaa\xf6\x8b\x62\x81\x03\xdb\x1d\xa3\xb6\x9c\x51\x51\x8f\x59\x55\x74\x33\xae\x91\xb9\xb4\xc5\xc2\xea\x0d\xac\x6a\x67\x63\xc7\x79\x50\x87\xf7\xa8\xe5\xb0\xe9\xff\x0e\x7f\x77\x96\xc3\x56\xba\x98\xdb\xba\xd3\x60\xbb\x17\xb6\x98\x2c\xd8\x63\x6b\xb9\x53\x71\xe9\x2b\xa6\xda\xaf\xee\x03\xcc\x6d\x5f\xdd\x4d\xc0\x9b\xd9\xfb\x96\xd2\xa8\xdb\xc4\x29\xfa\x8a\xb4\x4f\x94\xce\x48\x5f\x23\xbd\x8d\xfd\x2f\x71\x03\xf7\xe4\xf6\xd8\xe5\xf6\xe4\x65\x31\x5d\x97\x97\x2b\x95\xe0\x0e\x8e\x2b\x90\x58\xa9\x8d\xd2\xb1\xaf\x7d\xa6\x84\xd2\xf1\x61\xe7\xa2\x73\xd9\xb9\xac\xb4\x57\xc4\x1c\x57\x2c\x78\x04\xff\x45\x31\x46\x07\xea\x11\x9c\x6b\x4e\xc5\x11\x18\x2a\x0d\x31\xa8\xf9\xa0\x89\xdc\x49\x31\xed\x36\xbb\xf6\xe4\x64\x07\x94\xab\x64\xdf\xfd\xfc\xa8\x4a\x18\xd1\x31\x82\x46\x86\x7c\x8c\x19\x50\x18\x2b\xce\x30\xa7\x5c\xc0\x40\xab\x1c\xe6\xf3\xf6\x05\x15\x02\xf5\x62\xd1\x06\xb8\x1a\x21\x58\x4d\xa5\x61\x9a\x17\x0e\x7d\xe0\x06\xfa\x28\xd4\x24\xde\x32\x90\x84\x9e\x02\x43\x9b\xb9\xf3\xb3\x76\x3f\x55\x9b\x85\x3e\x95\xbd\x24\xdc\x4f\x91\xcd\x85\x7e\xc1\xae\x7a\x7d\x54\xed\xab\xa1\xc7\x6c\xdb\xbf\x1a\x8b\xf7\x29\xbb\x75\x04\x21\xb3\xf8\xf0\xf2\xf5\xe5\xf9\xe5\xdb\xc7\x25\xf6\x5d\xf6\x36\x71\x7c\xb0\xe9\x37\xfb\xe5\x89\xeb\x9f\xb8\x7e\x07\xd7\xff\x49\x69\x7e\x3e\x6f\x5f\xad\x48\x7b\xb1\x70\x63\x5b\x72\x35\x5f\x3e\xb1\xf5\xdf\x8b\xad\x1f\x95\x9a\xb7\x10\x7a\xb0\x21\x1b\x05\x5d\xa1\xfa\x74\xea\x7e\x3a\x75\x7f\xc5\xa9\xbb\x2e\xb0\x3f\xa0\x98\x37\x6f\x0b\x0d\x16\x54\x53\x8b\x5b\xb6\x1e\x8e\xa9\xbe\x26\xf4\x37\x7c\xb5\x5a\x4d\x33\x5e\x9a\xd8\xe1\x5e\x6f\x0d\x03\xff\xaf\xdb\xdc\x34\x1e\x8e\x13\xc6\xf5\x7b\xce\xb3\xcc\xdd\x2c\xf7\x87\x5e\x5d\x1a\x1c\x9e\xb0\x0e\xbe\x74\xfd\x45\xeb\x0b\xa1\xf9\xbc\xfd\xc9\xdd\x37\xba\x2e\xbe\xfe\xf4\x61\xb1\x58\x85\xba\x79\x17\xe9\x1d\x6d\x92\xd1\xd6\xf9\xaa\x52\xbe\xe1\xfa\xb7\xec\x6a\x9d\x25\xdd\x4d\x2a\x8b\x52\xe9\x9c\x8a\xea\x74\x60\xdd\x96\x35\x50\x3a\xaf\x1c\x5b\x33\x59\x37\x00\x4b\xf5\x10\x6d\x1a\xfc\xd4\x17\x54\xde\xae\x9a\xea\xee\xe7\x03\x37\x16\x25\x58\xb5\xfe\x9b\x66\x4b\x2e\x09\xe9\xde\x6d\xe9\x31\x37\xac\xc7\xd6\xee\x74\xb4\x92\xd0\x47\xd4\x4a\xc2\x91\xcd\x45\xef\xb7\x01\x00\xb4\x2d\x88\x4e\x70\x19\x00\x00")
 
 func templatesVoicemailHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -84,12 +191,12 @@ func templatesVoicemailHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "templates/voicemail.html", size: 6517, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	info := bindataFileInfo{name: "templates/voicemail.html", size: 6512, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _templatesVoicemailMjml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xb4\x93\x4f\x4f\x83\x40\x10\xc5\xef\x7e\x8a\xc9\x7a\x86\xfe\x21\xc6\xc4\x94\x26\x2a\xf1\xd4\x53\x53\x0f\x1e\x97\x65\x68\xb7\xee\xee\x34\xcb\x50\xab\x84\xef\x6e\xa0\x6d\xb0\x16\x13\x35\xe9\x9c\xe0\x0d\x33\x79\xef\x17\x66\x62\xd7\xd6\x4c\xaf\x00\x00\x26\x76\x1d\xa4\x94\xbd\xef\xdf\x8e\x8a\x22\xc7\x52\x3b\xf4\xa7\x72\x81\x8a\x35\x39\x60\xdc\x71\x20\x8d\x5e\xba\x58\x18\xcc\x59\x74\x9f\x75\x1b\x4c\x69\xdd\xa9\x7e\xec\x35\xe3\x90\x93\xe3\xa0\xd0\x1f\x18\x8b\xd1\x58\x80\x22\x43\x3e\x16\xd7\xd1\x63\x94\x44\x89\x38\x1f\x6c\xea\x85\x4a\x58\xc9\x2d\x82\x47\x85\x7a\x8b\x19\x48\xd8\x92\x56\x68\xa5\x36\x90\x7b\xb2\x50\x55\xe1\x93\x27\x5b\xd7\x21\xc0\x62\x85\xc0\x5e\xba\x42\x79\xbd\x69\x8d\xeb\x02\x52\x34\xf4\x76\x77\xee\x6b\x70\x30\xf6\x2d\xca\xa0\x27\x4b\x2b\x1e\x58\xf4\x03\x4a\xa5\x7a\x5d\x7a\x2a\x5d\x16\x1c\x83\x25\xb7\xc9\x7d\xf2\x20\x2e\xc1\x6e\x23\xb3\x4c\xbb\x65\x2c\x46\xc3\x5f\x82\xac\xaa\x70\xf1\x15\xcc\x02\x77\x5c\xd7\x4d\xe7\xb2\x60\xfe\x96\x35\x2d\x99\xfb\x61\x8e\x55\x84\x37\x43\x01\x2b\x8f\x79\x2c\xaa\x2a\x9c\xa3\x22\xdf\x40\x78\x9e\xcf\xea\xba\xa3\x90\xb7\xf5\x03\x85\x99\x2e\x18\x1d\x30\x75\x3f\x51\x7f\xfc\xbd\x91\xff\x03\x18\x9c\x9f\xd4\x7e\x6f\x7b\x78\xcd\xa3\x35\xd3\xcf\x00\x00\x00\xff\xff\xa1\xf9\xc0\xf9\x95\x03\x00\x00")
+var _templatesVoicemailMjml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x93\xcb\x6e\xf2\x30\x10\x85\xf7\x3c\xc5\xc8\xff\x3a\x09\x10\xfd\xaa\x54\x25\x48\x2d\x59\xb2\x42\x74\xd1\xa5\xe3\x4c\xc0\xd4\xf6\x20\xc7\xa1\x17\xcb\xef\x5e\x01\x0d\x11\x97\x56\x55\x25\x92\x95\x8f\x3d\xe3\x73\x3e\x79\x32\xbd\xd6\x6a\x32\x00\x00\xc8\xf4\x3a\x2a\xa9\x7a\x3f\xac\x3a\x45\x90\x71\x5c\x1a\xb4\xa7\x72\x83\xc2\x49\x32\xe0\xf0\xcd\x45\x5c\xc9\xa5\xc9\x99\xc2\xda\xb1\xfe\x58\xdf\x41\xb5\xda\x9c\xea\xdd\xde\xae\x1c\x6a\x32\x2e\x6a\xe4\x07\xe6\x6c\x34\x66\x20\x48\x91\xcd\xd9\xbf\x74\x9a\x16\x69\x71\xd6\xb0\xfb\x9f\xa9\x85\x15\xdf\x22\x58\x14\x28\xb7\x58\x01\x87\x2d\x49\x81\x9a\x4b\x05\xb5\x25\x0d\xde\xc7\x53\xae\x14\xda\x10\x62\x80\xc5\x0a\xc1\x59\x6e\x1a\x61\xe5\x66\x6f\x5d\x36\x50\xa2\xa2\xd7\xfb\x4b\x67\xc9\x97\xb5\xd3\xbb\xb3\xe4\x4a\x9a\x2c\xe9\x69\x5c\x47\x54\x72\xf1\xb2\xb4\xd4\x9a\x2a\xea\xa2\x15\x77\xc5\x43\xf1\xc8\x6e\x41\x6f\xc3\xab\x4a\x9a\x65\xce\x46\xc3\x5f\xa2\xf4\x3e\x5e\x1c\xc1\x84\xb0\xd3\x6e\x4b\x64\x32\x38\x0f\xf2\x53\xc8\xb2\x75\xee\x3a\xc5\xb1\x48\xf1\xff\x90\xc1\xca\x62\x9d\x33\xef\xe3\x39\x0a\xb2\xbb\xf4\x4f\xf3\x59\x08\x7d\xfc\x7a\xff\x7d\x13\x7f\x26\x1b\x87\x06\x1c\xf5\xef\xe7\xd2\x47\x72\x34\xf2\x77\x00\xc9\xe5\x34\xed\xcb\x0f\x33\x97\x25\x7a\xad\xd5\xe4\x73\x00\x8a\x9a\x3c\xbf\x90\x03\x00\x00")
 
 func templatesVoicemailMjmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -104,7 +211,47 @@ func templatesVoicemailMjml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "templates/voicemail.mjml", size: 917, mode: os.FileMode(420), modTime: time.Unix(1488247105, 0)}
+	info := bindataFileInfo{name: "templates/voicemail.mjml", size: 912, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesVoicemailSubject = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x1d\x00\xe2\xff\x4e\x65\x77\x20\x76\x6f\x69\x63\x65\x6d\x61\x69\x6c\x20\x66\x72\x6f\x6d\x20\x7b\x7b\x2e\x46\x72\x6f\x6d\x7d\x7d\x0a\x03\x00\xe1\x6b\x95\xb5\x1d\x00\x00\x00")
+
+func templatesVoicemailSubjectBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesVoicemailSubject,
+		"templates/voicemail.subject",
+	)
+}
+
+func templatesVoicemailSubject() (*asset, error) {
+	bytes, err := templatesVoicemailSubjectBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/voicemail.subject", size: 29, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _templatesVoicemailTxt = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4c\x8e\x31\x4b\xc4\x40\x10\x85\xfb\xfd\x15\x43\x2a\x6d\x82\xa8\x55\x5a\xc5\x42\x12\x90\x18\x05\xcb\x61\x77\xe2\x0d\x97\xdd\x3d\xe6\x36\xb9\x62\x98\xff\x7e\x2c\x1c\xe1\xca\xef\x3d\xbe\xc7\xfb\xcb\x2b\x1c\x70\x23\x10\xf2\xc4\x1b\x05\x40\x48\x74\x81\x2d\xb3\xa7\x88\xbc\xc0\x2c\x39\x82\x6a\xfb\x86\xcb\x42\x62\xa6\xca\x33\xb4\xef\xab\x60\xe1\x9c\xcc\xe0\x41\x35\xdc\xe8\x3e\x7f\x54\xa5\x14\xcc\x00\x4b\xd5\x27\x8e\xd4\x7e\x64\x89\x58\xa0\xf9\xc4\x04\xcf\xf0\xd2\x3d\xbd\xc2\xd7\x00\xc3\xf7\xd4\x98\x39\x37\x09\xa6\xb3\x17\x3e\x95\xce\x55\x63\xc7\x5a\xfe\xee\x87\x7a\x4e\xc7\xae\x4e\x8e\xe4\xb3\x04\x4e\xff\x3f\x63\x6f\xe6\xae\x03\x00\x9e\x19\x98\x4d\xcb\x00\x00\x00")
+
+func templatesVoicemailTxtBytes() ([]byte, error) {
+	return bindataRead(
+		_templatesVoicemailTxt,
+		"templates/voicemail.txt",
+	)
+}
+
+func templatesVoicemailTxt() (*asset, error) {
+	bytes, err := templatesVoicemailTxtBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/voicemail.txt", size: 203, mode: os.FileMode(420), modTime: time.Unix(1488247115, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -161,8 +308,15 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"templates/voicemail.html": templatesVoicemailHtml,
-	"templates/voicemail.mjml": templatesVoicemailMjml,
+	"templates/inbox.html":          templatesInboxHtml,
+	"templates/message.subject":     templatesMessageSubject,
+	"templates/message.txt":         templatesMessageTxt,
+	"templates/missed_call.subject": templatesMissed_callSubject,
+	"templates/missed_call.txt":     templatesMissed_callTxt,
+	"templates/voicemail.html":      templatesVoicemailHtml,
+	"templates/voicemail.mjml":      templatesVoicemailMjml,
+	"templates/voicemail.subject":   templatesVoicemailSubject,
+	"templates/voicemail.txt":       templatesVoicemailTxt,
 }
 
 // AssetDir returns the file names below a certain
@@ -206,8 +360,15 @@ type bintree struct {
 }
 var _bintree = &bintree{nil, map[string]*bintree{
 	"templates": &bintree{nil, map[string]*bintree{
-		"voicemail.html": &bintree{templatesVoicemailHtml, map[string]*bintree{}},
-		"voicemail.mjml": &bintree{templatesVoicemailMjml, map[string]*bintree{}},
+		"inbox.html":          &bintree{templatesInboxHtml, map[string]*bintree{}},
+		"message.subject":     &bintree{templatesMessageSubject, map[string]*bintree{}},
+		"message.txt":         &bintree{templatesMessageTxt, map[string]*bintree{}},
+		"missed_call.subject": &bintree{templatesMissed_callSubject, map[string]*bintree{}},
+		"missed_call.txt":     &bintree{templatesMissed_callTxt, map[string]*bintree{}},
+		"voicemail.html":      &bintree{templatesVoicemailHtml, map[string]*bintree{}},
+		"voicemail.mjml":      &bintree{templatesVoicemailMjml, map[string]*bintree{}},
+		"voicemail.subject":   &bintree{templatesVoicemailSubject, map[string]*bintree{}},
+		"voicemail.txt":       &bintree{templatesVoicemailTxt, map[string]*bintree{}},
 	}},
 }}
 
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+	"github.com/pressly/chi"
+)
+
+// Block actions
+const (
+	BlockBusy      = "busy"
+	BlockReject    = "reject"
+	BlockVoicemail = "voicemail"
+	BlockMessage   = "message"
+)
+
+// Anonymous is the pattern that matches callers who withhold their number
+const Anonymous = "anonymous"
+
+// anonymousCallers are the values Twilio sends in From when the caller ID is withheld
+var anonymousCallers = map[string]bool{
+	"":            true,
+	"anonymous":   true,
+	"restricted":  true,
+	"unknown":     true,
+	"unavailable": true,
+	"blocked":     true,
+	"+266696687":  true,
+	"+7378742833": true,
+	"+2562533":    true,
+	"+8656696":    true,
+}
+
+// blockHitsFlushInterval is how often the counts of blocked calls are saved to the blocklist file
+const blockHitsFlushInterval = time.Minute
+
+// BlockRule blocks callers matching Pattern, which is an exact number, a prefix ending in * like
+// "+1900*", or "anonymous" for callers who withhold their number.  Blocked counts the calls the
+// rule has blocked.
+type BlockRule struct {
+	Pattern string    `json:"pattern"`
+	Action  string    `json:"action"`
+	Message string    `json:"message,omitempty"`
+	Blocked int       `json:"blocked"`
+	Last    time.Time `json:"last_blocked,omitempty"`
+}
+
+// Blocklist holds the rules for blocking callers, stored as JSON in a file.  Numbers matching a
+// pattern in Allow are never blocked, so a list that blocks "*" only lets allowed callers through.
+type Blocklist struct {
+	Block []BlockRule `json:"block"`
+	Allow []string    `json:"allow"`
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	now     func() time.Time
+	// hits are the calls blocked by each pattern since the file was last saved
+	hits map[string]blockHits
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// blockHits counts the calls a rule has blocked that haven't been saved yet
+type blockHits struct {
+	count int
+	last  time.Time
+}
+
+// OpenBlocklist loads the blocklist stored at path.  A missing file is an empty blocklist.  Call
+// Start to save the counts of blocked calls as the server runs.
+func OpenBlocklist(cfg Config, path string) (*Blocklist, error) {
+	b := &Blocklist{
+		path: path,
+		now:  cfg.now,
+		hits: make(map[string]blockHits),
+		done: make(chan struct{}),
+	}
+	if err := b.reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Start saves the counts of blocked calls to the file every minute in the background, rather
+// than rewriting the file for every call
+func (b *Blocklist) Start() {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		t := time.NewTicker(blockHitsFlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-t.C:
+				b.flush()
+			}
+		}
+	}()
+}
+
+// Stop stops saving in the background and saves the counts of calls blocked since the last save
+func (b *Blocklist) Stop() {
+	close(b.done)
+	b.wg.Wait()
+	b.flush()
+}
+
+// flush saves the counts of calls blocked since the file was last saved
+func (b *Blocklist) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.hits) == 0 {
+		return
+	}
+	if err := b.reload(); err != nil {
+		logger.Error("Unable to reload blocklist", "error", err)
+		return
+	}
+	if err := b.save(); err != nil {
+		logger.Error("Unable to save blocklist", "error", err)
+	}
+}
+
+// reload reads the blocklist file again if it has changed since it was last read, so that
+// changes made with the blocklist command are picked up by a running server
+func (b *Blocklist) reload() error {
+	stat, err := os.Stat(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.ModTime().Equal(b.modTime) && stat.Size() == b.size {
+		return nil
+	}
+	data, err := ioutil.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
+	var loaded Blocklist
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("%s: %s", b.path, err)
+	}
+	b.Block, b.Allow, b.modTime, b.size = loaded.Block, loaded.Allow, stat.ModTime(), stat.Size()
+	return nil
+}
+
+// save writes the blocklist back to its file, with the calls blocked since it was last saved
+// added to the counts.  The file is written to a temporary file of its own first, so that the
+// server and the blocklist command don't overwrite each other's half written files.
+func (b *Blocklist) save() error {
+	rules := b.counted()
+	data, err := json.MarshalIndent(&Blocklist{Block: rules, Allow: b.Allow}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	b.Block, b.hits = rules, make(map[string]blockHits)
+	if stat, err := os.Stat(b.path); err == nil {
+		b.modTime, b.size = stat.ModTime(), stat.Size()
+	}
+	return nil
+}
+
+// counted returns a copy of the block rules with the calls blocked since the last save added
+func (b *Blocklist) counted() []BlockRule {
+	rules := append([]BlockRule(nil), b.Block...)
+	for i := range rules {
+		if hits, ok := b.hits[rules[i].Pattern]; ok {
+			rules[i].Blocked += hits.count
+			rules[i].Last = hits.last
+		}
+	}
+	return rules
+}
+
+// Check returns the rule that blocks the caller and counts the blocked attempt, or false if the
+// caller is not blocked
+func (b *Blocklist) Check(from string) (BlockRule, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		logger.Error("Unable to reload blocklist", "error", err)
+	}
+	for _, pattern := range b.Allow {
+		if matchCaller(pattern, from) {
+			return BlockRule{}, false
+		}
+	}
+	for i, rule := range b.Block {
+		if matchCaller(rule.Pattern, from) {
+			hits := b.hits[rule.Pattern]
+			hits.count++
+			hits.last = b.now()
+			b.hits[rule.Pattern] = hits
+			return b.counted()[i], true
+		}
+	}
+	return BlockRule{}, false
+}
+
+// Add adds a block rule, replacing any rule with the same pattern
+func (b *Blocklist) Add(rule BlockRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		return err
+	}
+	for i := range b.Block {
+		if b.Block[i].Pattern == rule.Pattern {
+			rule.Blocked, rule.Last = b.Block[i].Blocked, b.Block[i].Last
+			b.Block[i] = rule
+			return b.save()
+		}
+	}
+	b.Block = append(b.Block, rule)
+	return b.save()
+}
+
+// Remove removes the block rule with the pattern
+func (b *Blocklist) Remove(pattern string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		return err
+	}
+	for i := range b.Block {
+		if b.Block[i].Pattern == pattern {
+			b.Block = append(b.Block[:i], b.Block[i+1:]...)
+			return b.save()
+		}
+	}
+	return fmt.Errorf("%s is not blocked", pattern)
+}
+
+// AllowCaller adds a pattern to the allowlist
+func (b *Blocklist) AllowCaller(pattern string) error {
+	if err := validPattern(pattern); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		return err
+	}
+	for _, p := range b.Allow {
+		if p == pattern {
+			return nil
+		}
+	}
+	b.Allow = append(b.Allow, pattern)
+	return b.save()
+}
+
+// Disallow removes a pattern from the allowlist
+func (b *Blocklist) Disallow(pattern string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		return err
+	}
+	for i, p := range b.Allow {
+		if p == pattern {
+			b.Allow = append(b.Allow[:i], b.Allow[i+1:]...)
+			return b.save()
+		}
+	}
+	return fmt.Errorf("%s is not allowed", pattern)
+}
+
+// Snapshot returns a copy of the block rules and allowlist
+func (b *Blocklist) Snapshot() ([]BlockRule, []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reload(); err != nil {
+		logger.Error("Unable to reload blocklist", "error", err)
+	}
+	return b.counted(), append([]string(nil), b.Allow...)
+}
+
+func (rule *BlockRule) validate() error {
+	if err := validPattern(rule.Pattern); err != nil {
+		return err
+	}
+	switch rule.Action {
+	case "":
+		rule.Action = BlockReject
+	case BlockBusy, BlockReject, BlockVoicemail, BlockMessage:
+	default:
+		return fmt.Errorf("action must be %s, %s, %s or %s", BlockBusy, BlockReject, BlockVoicemail, BlockMessage)
+	}
+	if rule.Action == BlockMessage && len(rule.Message) == 0 {
+		rule.Message = "Sorry, your call cannot be completed."
+	}
+	return nil
+}
+
+// validPattern returns an error if the pattern isn't a number, a prefix ending in *, * or
+// anonymous.  A prefix without any digits would match every caller.
+func validPattern(pattern string) error {
+	switch {
+	case len(pattern) == 0:
+		return fmt.Errorf("pattern is required")
+	case pattern == "*", strings.EqualFold(pattern, Anonymous):
+		return nil
+	case len(digitsOnly(pattern)) == 0:
+		return fmt.Errorf("%q is not a number, a prefix ending in * or %s", pattern, Anonymous)
+	}
+	return nil
+}
+
+// matchCaller returns true if the caller matches the pattern
+func matchCaller(pattern string, from string) bool {
+	switch {
+	case strings.EqualFold(pattern, Anonymous):
+		return anonymousCallers[strings.ToLower(from)]
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "*"):
+		prefix := digitsOnly(pattern)
+		return len(digitsOnly(from)) > 0 && strings.HasPrefix(digitsOnly(from), prefix)
+	default:
+		return len(digitsOnly(from)) > 0 && digitsOnly(pattern) == digitsOnly(from)
+	}
+}
+
+// blocked returns the TwiML for a call that was blocked by the rule
+func blocked(rule BlockRule, p Profile) []twiml.Markup {
+	switch rule.Action {
+	case BlockBusy:
+		return []twiml.Markup{&twiml.Reject{Reason: "busy"}}
+	case BlockVoicemail:
+		return voicemailPrompt(p)
+	case BlockMessage:
+		return []twiml.Markup{&twiml.Say{Voice: "woman", Text: rule.Message}, &twiml.Hangup{}}
+	default:
+		return []twiml.Markup{&twiml.Reject{Reason: "rejected"}}
+	}
+}
+
+// blocklistResponse is the JSON representation of the blocklist in the admin API
+type blocklistResponse struct {
+	Block []BlockRule `json:"block"`
+	Allow []string    `json:"allow"`
+	Total int         `json:"total_blocked"`
+}
+
+// BlocklistAPI returns the router for the blocklist admin API.  GET lists the rules, allowlist
+// and counters.  POST /block and /allow add a rule or allowed pattern from a JSON body, and
+// DELETE /block and /allow remove one by its pattern query parameter.
+func BlocklistAPI(blocklist *Blocklist) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		var res blocklistResponse
+		res.Block, res.Allow = blocklist.Snapshot()
+		for _, rule := range res.Block {
+			res.Total += rule.Blocked
+		}
+		writeJSON(w, 200, res)
+	})
+	r.Post("/block", func(w http.ResponseWriter, r *http.Request) {
+		var rule BlockRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		rule.Blocked, rule.Last = 0, time.Time{}
+		if err := blocklist.Add(rule); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.WriteHeader(204)
+	})
+	r.Delete("/block", func(w http.ResponseWriter, r *http.Request) {
+		if err := blocklist.Remove(r.URL.Query().Get("pattern")); err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.WriteHeader(204)
+	})
+	r.Post("/allow", func(w http.ResponseWriter, r *http.Request) {
+		var allow struct {
+			Pattern string `json:"pattern"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&allow); err != nil || len(allow.Pattern) == 0 {
+			http.Error(w, "pattern is required", 400)
+			return
+		}
+		if err := blocklist.AllowCaller(allow.Pattern); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.WriteHeader(204)
+	})
+	r.Delete("/allow", func(w http.ResponseWriter, r *http.Request) {
+		if err := blocklist.Disallow(r.URL.Query().Get("pattern")); err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.WriteHeader(204)
+	})
+	return r
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
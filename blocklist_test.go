@@ -0,0 +1,254 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Blocklist", func() {
+	var dir string
+	var blocklist *Blocklist
+	now := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+	clock := Config{Now: func() time.Time { return now }}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "blocklist")
+		Expect(err).ToNot(HaveOccurred())
+		blocklist, err = OpenBlocklist(clock, filepath.Join(dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocklist.Add(BlockRule{Pattern: "+1900*", Action: BlockBusy})).To(Succeed())
+		Expect(blocklist.Add(BlockRule{Pattern: "+1 (555) 123-4567"})).To(Succeed())
+		Expect(blocklist.Add(BlockRule{Pattern: Anonymous, Action: BlockMessage})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	DescribeTable("matching callers",
+		func(from string, pattern string, isBlocked bool) {
+			rule, ok := blocklist.Check(from)
+			Expect(ok).To(Equal(isBlocked))
+			Expect(rule.Pattern).To(Equal(pattern))
+		},
+		Entry("exact number", "+15551234567", "+1 (555) 123-4567", true),
+		Entry("prefix", "+19005550000", "+1900*", true),
+		Entry("anonymous", "Anonymous", Anonymous, true),
+		Entry("withheld number", "+266696687", Anonymous, true),
+		Entry("other callers", "+15557654321", "", false),
+	)
+
+	It("lets allowed callers through", func() {
+		Expect(blocklist.Add(BlockRule{Pattern: "*"})).To(Succeed())
+		Expect(blocklist.AllowCaller("+15557654321")).To(Succeed())
+		_, ok := blocklist.Check("+15557654321")
+		Expect(ok).To(BeFalse())
+		_, ok = blocklist.Check("+15550000000")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("counts blocked calls and saves them when stopped", func() {
+		blocklist.Start()
+		blocklist.Check("+19005550000")
+		rule, _ := blocklist.Check("+19005551111")
+		Expect(rule.Blocked).To(Equal(2))
+		Expect(rule.Last).To(Equal(now))
+
+		reopened, err := OpenBlocklist(clock, filepath.Join(dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		rules, _ := reopened.Snapshot()
+		Expect(rules[0].Blocked).To(Equal(0))
+
+		blocklist.Stop()
+		reopened, err = OpenBlocklist(clock, filepath.Join(dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		rules, _ = reopened.Snapshot()
+		Expect(rules[0].Blocked).To(Equal(2))
+		Expect(rules[0].Last).To(BeTemporally("==", now))
+	})
+
+	It("keeps the counts of blocked calls when the file is changed before they are saved", func() {
+		blocklist.Check("+19005550000")
+		other, err := OpenBlocklist(clock, filepath.Join(dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.AllowCaller("+15557654321")).To(Succeed())
+
+		blocklist.Stop()
+		rules, allowed := blocklist.Snapshot()
+		Expect(rules[0].Blocked).To(Equal(1))
+		Expect(allowed).To(Equal([]string{"+15557654321"}))
+		leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+		Expect(leftovers).To(BeEmpty())
+	})
+
+	It("rejects unknown actions", func() {
+		Expect(blocklist.Add(BlockRule{Pattern: "+15550000000", Action: "explode"})).ToNot(Succeed())
+	})
+
+	It("rejects patterns without a number", func() {
+		Expect(blocklist.Add(BlockRule{Pattern: "hello*"})).To(MatchError(ContainSubstring(`"hello*" is not a number`)))
+		Expect(blocklist.AllowCaller("")).To(MatchError("pattern is required"))
+		Expect(blocklist.AllowCaller("ANONYMOUS")).To(Succeed())
+	})
+
+	Describe("admin API", func() {
+		// request sends a request to the API and returns the status and body of the response
+		request := func(method string, target string, body string) (int, string) {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			BlocklistAPI(blocklist).ServeHTTP(rec, req)
+			return rec.Code, rec.Body.String()
+		}
+		list := func() map[string]interface{} {
+			code, body := request("GET", "/", "")
+			Expect(code).To(Equal(200))
+			var res map[string]interface{}
+			Expect(json.Unmarshal([]byte(body), &res)).To(Succeed())
+			return res
+		}
+
+		It("lists the rules, allowlist and total blocked", func() {
+			blocklist.Check("+19005550000")
+			Expect(blocklist.AllowCaller("+19005551111")).To(Succeed())
+			res := list()
+			Expect(res["block"]).To(HaveLen(3))
+			Expect(res["allow"]).To(Equal([]interface{}{"+19005551111"}))
+			Expect(res["total_blocked"]).To(BeNumerically("==", 1))
+		})
+
+		It("blocks and unblocks a pattern", func() {
+			code, _ := request("POST", "/block", `{"pattern": "+1888*", "action": "voicemail", "blocked": 40}`)
+			Expect(code).To(Equal(204))
+			rule, ok := blocklist.Check("+18885550000")
+			Expect(ok).To(BeTrue())
+			Expect(rule.Action).To(Equal(BlockVoicemail))
+			Expect(rule.Blocked).To(Equal(1))
+
+			code, _ = request("DELETE", "/block?pattern=%2B1888*", "")
+			Expect(code).To(Equal(204))
+			_, ok = blocklist.Check("+18885550000")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("allows and disallows a pattern", func() {
+			code, _ := request("POST", "/allow", `{"pattern": "+19005550000"}`)
+			Expect(code).To(Equal(204))
+			_, ok := blocklist.Check("+19005550000")
+			Expect(ok).To(BeFalse())
+
+			code, _ = request("DELETE", "/allow?pattern=%2B19005550000", "")
+			Expect(code).To(Equal(204))
+			_, ok = blocklist.Check("+19005550000")
+			Expect(ok).To(BeTrue())
+		})
+
+		DescribeTable("bad requests",
+			func(method string, target string, body string, status int, message string) {
+				code, res := request(method, target, body)
+				Expect(code).To(Equal(status))
+				Expect(res).To(ContainSubstring(message))
+				Expect(list()["block"]).To(HaveLen(3))
+			},
+			Entry("malformed JSON", "POST", "/block", `{"pattern":`, 400, "unexpected EOF"),
+			Entry("missing pattern", "POST", "/block", `{"action": "busy"}`, 400, "pattern is required"),
+			Entry("pattern without a number", "POST", "/block", `{"pattern": "spam*"}`, 400, "is not a number"),
+			Entry("unknown action", "POST", "/block", `{"pattern": "+15550000000", "action": "explode"}`, 400, "action must be"),
+			Entry("unblocking a pattern that isn't blocked", "DELETE", "/block?pattern=%2B15550000000", "", 404, "is not blocked"),
+			Entry("allowing without a pattern", "POST", "/allow", `{}`, 400, "pattern is required"),
+			Entry("allowing a pattern without a number", "POST", "/allow", `{"pattern": "friends"}`, 400, "is not a number"),
+			Entry("disallowing a pattern that isn't allowed", "DELETE", "/allow?pattern=%2B15550000000", "", 404, "is not allowed"),
+		)
+	})
+
+	Describe("command", func() {
+		var cfg Config
+
+		BeforeEach(func() {
+			cfg = Config{BlocklistFile: filepath.Join(dir, "blocklist.json")}
+		})
+
+		// check checks the caller against the blocklist file as the server would after a restart
+		check := func(from string) (BlockRule, bool) {
+			reopened, err := OpenBlocklist(cfg, cfg.BlocklistFile)
+			Expect(err).ToNot(HaveOccurred())
+			return reopened.Check(from)
+		}
+		// run runs the blocklist command and returns what it printed
+		run := func(args ...string) (string, error) {
+			out := new(bytes.Buffer)
+			err := BlocklistCommand(out, cfg, args)
+			return out.String(), err
+		}
+
+		It("lists the rules and allowlist by default", func() {
+			Expect(blocklist.AllowCaller("+15557654321")).To(Succeed())
+			blocklist.Check("+19005550000")
+			blocklist.Stop()
+			out, err := run()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).To(HavePrefix("PATTERN"))
+			Expect(out).To(MatchRegexp(`\+1900\*\s+busy\s+1\s+\d{4}-\d\d-\d\d \d\d:\d\d`))
+			Expect(out).To(MatchRegexp(`anonymous\s+message\s+0`))
+			Expect(out).To(MatchRegexp(`\+15557654321\s+allow`))
+		})
+
+		It("writes the usage to its writer when a pattern is missing", func() {
+			out, err := run("add")
+			Expect(err).To(MatchError("blocklist add needs a pattern"))
+			Expect(out).To(HavePrefix("Usage: twilio-voice"))
+			out, err = run("unblock", "+15551234567")
+			Expect(err).To(MatchError("unknown blocklist command unblock"))
+			Expect(out).To(ContainSubstring("blocklist remove <pattern>"))
+		})
+
+		It("adds a rule with an action and message", func() {
+			_, err := run("add", "+1888*", "message", "No", "sales", "calls")
+			Expect(err).ToNot(HaveOccurred())
+			rule, ok := check("+18885550000")
+			Expect(ok).To(BeTrue())
+			Expect(rule.Action).To(Equal(BlockMessage))
+			Expect(rule.Message).To(Equal("No sales calls"))
+		})
+
+		It("removes, allows and disallows patterns", func() {
+			_, err := run("remove", "+1900*")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := check("+19005550000")
+			Expect(ok).To(BeFalse())
+
+			_, err = run("allow", "+15551234567")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok = check("+15551234567")
+			Expect(ok).To(BeFalse())
+
+			_, err = run("disallow", "+15551234567")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok = check("+15551234567")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("returns an error for a bad command", func() {
+			_, err := run("add")
+			Expect(err).To(MatchError("blocklist add needs a pattern"))
+			_, err = run("add", "spam*")
+			Expect(err).To(MatchError(ContainSubstring("is not a number")))
+			_, err = run("remove", "+15550000000")
+			Expect(err).To(MatchError("+15550000000 is not blocked"))
+			_, err = run("explode", "+15550000000")
+			Expect(err).To(MatchError("unknown blocklist command explode"))
+		})
+	})
+})
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// Call outcomes
+const (
+	OutcomeAnswered  = "answered"
+	OutcomeVoicemail = "voicemail"
+	OutcomeBlocked   = "blocked"
+	OutcomeAbandoned = "abandoned"
+)
+
+// CallRecord is the call detail record of a call, built up from the webhooks Twilio makes during
+// the call
+type CallRecord struct {
+	CallSid          string    `json:"call_sid"`
+	From             string    `json:"from"`
+	To               string    `json:"to"`
+	Direction        string    `json:"direction"`
+	CallerName       string    `json:"caller_name,omitempty"`
+	FromCity         string    `json:"from_city,omitempty"`
+	FromState        string    `json:"from_state,omitempty"`
+	FromZip          string    `json:"from_zip,omitempty"`
+	FromCountry      string    `json:"from_country,omitempty"`
+	ToCity           string    `json:"to_city,omitempty"`
+	ToState          string    `json:"to_state,omitempty"`
+	ToZip            string    `json:"to_zip,omitempty"`
+	ToCountry        string    `json:"to_country,omitempty"`
+	Profile          string    `json:"profile,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	EndedAt          time.Time `json:"ended_at,omitempty"`
+	CallStatus       string    `json:"call_status"`
+	Duration         int       `json:"duration"`
+	DialCallStatus   string    `json:"dial_call_status,omitempty"`
+	DialCallDuration int       `json:"dial_call_duration"`
+	Outcome          string    `json:"outcome,omitempty"`
+	VoicemailID      string    `json:"voicemail_id,omitempty"`
+	// MissedChecked is set once the call has been checked for a missed call notification
+	MissedChecked bool `json:"missed_checked,omitempty"`
+}
+
+// track fills in the details of the call from a webhook request
+func (c *CallRecord) track(call twiml.VoiceRequest) {
+	set := func(field *string, value string) {
+		if len(value) > 0 {
+			*field = value
+		}
+	}
+	set(&c.From, call.From)
+	set(&c.To, call.To)
+	set(&c.Direction, call.Direction)
+	set(&c.CallerName, call.CallerName)
+	set(&c.FromCity, call.FromCity)
+	set(&c.FromState, call.FromState)
+	set(&c.FromZip, call.FromZip)
+	set(&c.FromCountry, call.FromCountry)
+	set(&c.ToCity, call.ToCity)
+	set(&c.ToState, call.ToState)
+	set(&c.ToZip, call.ToZip)
+	set(&c.ToCountry, call.ToCountry)
+	set(&c.CallStatus, call.CallStatus)
+}
+
+// compactSlack is how many more lines than calls the journal can hold before it is compacted
+const compactSlack = 1000
+
+// CallLog keeps the call detail records of every call.  Records are kept in memory and journaled
+// to a JSON lines file, where the last line for a call is its current record.  The journal is
+// compacted to one line per call when it is opened and whenever it grows too long, dropping
+// calls older than the retention period.
+type CallLog struct {
+	mu        sync.Mutex
+	calls     map[string]*CallRecord
+	path      string
+	journal   *os.File
+	lines     int
+	retention time.Duration
+	now       func() time.Time
+}
+
+// OpenCallLog loads the call log journaled at path and compacts it to one line per call
+func OpenCallLog(cfg Config, path string) (*CallLog, error) {
+	records, err := ReadCallLog(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &CallLog{
+		calls:     make(map[string]*CallRecord),
+		path:      path,
+		retention: time.Duration(cfg.CallLogRetentionDays) * 24 * time.Hour,
+		now:       cfg.now,
+	}
+	for i := range records {
+		c.calls[records[i].CallSid] = &records[i]
+	}
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compact drops calls that started before the retention period and rewrites the journal with
+// the current record of each call.  The lock must be held.
+func (c *CallLog) compact() error {
+	cutoff := c.now().Add(-c.retention)
+	records := make([]CallRecord, 0, len(c.calls))
+	for sid, r := range c.calls {
+		if c.retention > 0 && r.StartedAt.Before(cutoff) {
+			delete(c.calls, sid)
+			continue
+		}
+		records = append(records, *r)
+	}
+	sortCalls(records)
+
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeCallsJSON(f, records); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	journal, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if c.journal != nil {
+		c.journal.Close()
+	}
+	c.journal, c.lines = journal, len(records)
+	return nil
+}
+
+// ReadCallLog reads the records in the call log journaled at path, oldest call first, without
+// opening it for writing
+func ReadCallLog(path string) ([]CallRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := make(map[string]CallRecord)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var c CallRecord
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			// a line cut short by a crash is skipped rather than losing the whole log
+			logger.Warn("Skipping call record", "file", path, "line", line, "error", err)
+			continue
+		}
+		latest[c.CallSid] = c
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	records := make([]CallRecord, 0, len(latest))
+	for _, c := range latest {
+		records = append(records, c)
+	}
+	sortCalls(records)
+	return records, nil
+}
+
+// Update changes the record of a call, creating it the first time the call is seen, and
+// journals the change
+func (c *CallLog) Update(callSid string, change func(r *CallRecord)) {
+	if len(callSid) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	r, ok := c.calls[callSid]
+	if !ok {
+		r = &CallRecord{CallSid: callSid, StartedAt: now}
+		c.calls[callSid] = r
+	}
+	change(r)
+	r.UpdatedAt = now
+	b, err := json.Marshal(r)
+	if err == nil {
+		_, err = c.journal.Write(append(b, '\n'))
+	}
+	if err != nil {
+		logger.Error("Unable to save call record", "call_sid", callSid, "error", err)
+		return
+	}
+	c.lines++
+	if c.lines > 2*len(c.calls)+compactSlack {
+		if err := c.compact(); err != nil {
+			logger.Error("Unable to compact call log", "file", c.path, "error", err)
+			// try again after another round of calls rather than on every update
+			c.lines = len(c.calls)
+		}
+	}
+}
+
+// Track records the details of a call from a webhook request
+func (c *CallLog) Track(call twiml.VoiceRequest) {
+	c.Update(call.CallSid, func(r *CallRecord) { r.track(call) })
+}
+
+// Subscribe records status changes from the event bus.  A call that ends without being answered
+// or leaving a voicemail is recorded as abandoned.
+func (c *CallLog) Subscribe(bus *EventBus) {
+	bus.Subscribe(func(e CallEvent) {
+		c.Update(e.Call.CallSid, func(r *CallRecord) {
+			r.track(e.Call)
+			if !e.Ended() {
+				return
+			}
+			r.EndedAt, r.Duration = e.At, e.Duration
+			if len(r.Outcome) == 0 {
+				r.Outcome = OutcomeAbandoned
+			}
+		})
+	})
+}
+
+// Record returns a copy of the record of a call, and false if the call hasn't been seen
+func (c *CallLog) Record(callSid string) (CallRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.calls[callSid]
+	if !ok {
+		return CallRecord{}, false
+	}
+	return *r, true
+}
+
+// Records returns a copy of every call record, oldest call first
+func (c *CallLog) Records() []CallRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := make([]CallRecord, 0, len(c.calls))
+	for _, r := range c.calls {
+		records = append(records, *r)
+	}
+	sortCalls(records)
+	return records
+}
+
+// Close closes the journal
+func (c *CallLog) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.journal.Close()
+}
+
+func sortCalls(records []CallRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].StartedAt.Equal(records[j].StartedAt) {
+			return records[i].CallSid < records[j].CallSid
+		}
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+}
+
+// writeCallsJSON writes call records as JSON lines
+func writeCallsJSON(w io.Writer, records []CallRecord) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var callsCSVHeader = []string{
+	"call_sid", "from", "to", "direction", "caller_name",
+	"from_city", "from_state", "from_zip", "from_country",
+	"to_city", "to_state", "to_zip", "to_country",
+	"profile", "started_at", "ended_at", "call_status", "duration",
+	"dial_call_status", "dial_call_duration", "outcome", "voicemail_id",
+}
+
+// writeCallsCSV writes call records as CSV with a header row
+func writeCallsCSV(w io.Writer, records []CallRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(callsCSVHeader); err != nil {
+		return err
+	}
+	timestamp := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, r := range records {
+		row := []string{
+			r.CallSid, r.From, r.To, r.Direction, r.CallerName,
+			r.FromCity, r.FromState, r.FromZip, r.FromCountry,
+			r.ToCity, r.ToState, r.ToZip, r.ToCountry,
+			r.Profile, timestamp(r.StartedAt), timestamp(r.EndedAt), r.CallStatus, strconv.Itoa(r.Duration),
+			r.DialCallStatus, strconv.Itoa(r.DialCallDuration), r.Outcome, r.VoicemailID,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCalls writes call records in the format, which is csv or jsonl
+func ExportCalls(w io.Writer, records []CallRecord, format string) error {
+	switch format {
+	case "csv":
+		return writeCallsCSV(w, records)
+	case "jsonl", "json":
+		return writeCallsJSON(w, records)
+	default:
+		return fmt.Errorf("unknown export format %s, use csv or jsonl", format)
+	}
+}
+
+// CallsExport serves the call log as CSV or JSON lines, depending on the extension requested
+func CallsExport(calls *CallLog, format string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType := "application/x-ndjson"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="calls.%s"`, format))
+		if err := ExportCalls(w, calls.Records(), format); err != nil {
+			requestLog(r).Error("Unable to export calls", "error", err)
+		}
+	}
+}
+
+// callEnded returns true if the call status is final
+func callEnded(status string) bool {
+	switch status {
+	case twiml.Completed, twiml.Busy, twiml.Failed, twiml.NoAnswer, twiml.Canceled:
+		return true
+	}
+	return false
+}
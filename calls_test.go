@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CallLog", func() {
+	var dir string
+	var cfg Config
+	var calls *CallLog
+	var states *CallStates
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "calls")
+		Expect(err).ToNot(HaveOccurred())
+		cfg = Config{Now: func() time.Time { return time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC) }}
+		calls, err = OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		bus := NewEventBus()
+		calls.Subscribe(bus)
+		states = NewCallStates(cfg, bus)
+	})
+
+	AfterEach(func() {
+		calls.Close()
+		os.RemoveAll(dir)
+	})
+
+	call := func(status string, extra ...string) url.Values {
+		form := url.Values{"CallSid": {"CA123"}, "From": {"+15557654321"}, "To": {"+15550001111"}, "CallStatus": {status}, "FromCity": {"Springfield"}}
+		for i := 0; i < len(extra); i += 2 {
+			form.Set(extra[i], extra[i+1])
+		}
+		return form
+	}
+
+	It("records an answered call", func() {
+		postForm(DialAction(cfg, NewScreening(cfg), calls), "/", call(twiml.InProgress, "DialCallStatus", "completed", "DialCallDuration", "42"))
+		postForm(Status(cfg, states), "/", call("completed", "CallDuration", "50"))
+
+		records := calls.Records()
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].From).To(Equal("+15557654321"))
+		Expect(records[0].FromCity).To(Equal("Springfield"))
+		Expect(records[0].DialCallStatus).To(Equal("completed"))
+		Expect(records[0].DialCallDuration).To(Equal(42))
+		Expect(records[0].Duration).To(Equal(50))
+		Expect(records[0].Outcome).To(Equal(OutcomeAnswered))
+		Expect(records[0].EndedAt.IsZero()).To(BeFalse())
+	})
+
+	It("records a call that ends without an answer as abandoned", func() {
+		postForm(Status(cfg, states), "/", call("completed"))
+		Expect(calls.Records()[0].Outcome).To(Equal(OutcomeAbandoned))
+	})
+
+	It("keeps the voicemail outcome when the call ends", func() {
+		calls.Update("CA123", func(c *CallRecord) { c.Outcome = OutcomeVoicemail })
+		postForm(Status(cfg, states), "/", call("completed"))
+		Expect(calls.Records()[0].Outcome).To(Equal(OutcomeVoicemail))
+	})
+
+	It("reloads and compacts the journal", func() {
+		calls.Track(twiml.VoiceRequest{CallSid: "CA1", From: "+15557654321", To: "+15550001111", CallStatus: twiml.Ringing})
+		calls.Update("CA1", func(c *CallRecord) { c.Outcome = OutcomeBlocked })
+		calls.Track(twiml.VoiceRequest{CallSid: "CA2", From: "+15551112222", To: "+15550001111", CallStatus: twiml.Ringing})
+		Expect(calls.Close()).To(Succeed())
+
+		var err error
+		calls, err = OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		records := calls.Records()
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Outcome).To(Equal(OutcomeBlocked))
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Count(string(b), "\n")).To(Equal(2))
+	})
+
+	It("drops calls older than the retention period when it is opened", func() {
+		calls.Track(twiml.VoiceRequest{CallSid: "CA1", From: "+15557654321", To: "+15550001111", CallStatus: twiml.Ringing})
+		Expect(calls.Close()).To(Succeed())
+
+		var err error
+		cfg.CallLogRetentionDays = 30
+		cfg.Now = func() time.Time { return time.Date(2018, 1, 18, 9, 30, 0, 0, time.UTC) }
+		calls, err = OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		calls.Track(twiml.VoiceRequest{CallSid: "CA2", From: "+15551112222", To: "+15550001111", CallStatus: twiml.Ringing})
+		Expect(calls.Records()).To(HaveLen(2))
+		Expect(calls.Close()).To(Succeed())
+
+		cfg.Now = func() time.Time { return time.Date(2018, 1, 20, 9, 30, 0, 0, time.UTC) }
+		calls, err = OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		records := calls.Records()
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].CallSid).To(Equal("CA2"))
+		_, ok := calls.Record("CA1")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("compacts the journal while it is open", func() {
+		calls.Track(twiml.VoiceRequest{CallSid: "CA1", From: "+15557654321", To: "+15550001111", CallStatus: twiml.Ringing})
+		for i := 1; i <= 1500; i++ {
+			calls.Update("CA1", func(c *CallRecord) { c.Duration = i })
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Count(string(b), "\n")).To(BeNumerically("<", 1000))
+
+		Expect(calls.Close()).To(Succeed())
+		records, err := ReadCallLog(filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].Duration).To(Equal(1500))
+	})
+
+	It("exports CSV and JSON lines", func() {
+		calls.Track(twiml.VoiceRequest{CallSid: "CA1", From: "+15557654321", To: "+15550001111", CallStatus: twiml.Ringing})
+		var csv, jsonl bytes.Buffer
+		Expect(ExportCalls(&csv, calls.Records(), "csv")).To(Succeed())
+		Expect(ExportCalls(&jsonl, calls.Records(), "jsonl")).To(Succeed())
+		Expect(ExportCalls(&jsonl, calls.Records(), "xml")).ToNot(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(HavePrefix("call_sid,from,to"))
+		Expect(lines[1]).To(HavePrefix("CA1,+15557654321,+15550001111"))
+		Expect(jsonl.String()).To(ContainSubstring(`"call_sid":"CA1"`))
+	})
+})
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BTBurke/twilio-voice/simulator"
+)
+
+const usage = `Usage: twilio-voice [-config file] [command]
+
+With no command, twilio-voice runs the server.  Commands:
+
+  blocklist list                              list blocked and allowed callers
+  blocklist add <pattern> [action] [message]  block callers matching pattern
+  blocklist remove <pattern>                  stop blocking pattern
+  blocklist allow <pattern>                   never block callers matching pattern
+  blocklist disallow <pattern>                remove pattern from the allowlist
+  calls [csv|jsonl]                           export the call log, as CSV by default
+  outbox list                                 list queued and dead notifications
+  outbox replay [id...]                       send dead notifications again, all of them by default
+  render-template <kind> [profile]            preview a notification with sample data
+  simulate [flags]                            run a test call through the server, -h for flags
+
+Patterns are a number, a prefix ending in * like +1900*, or anonymous.  Actions are busy,
+reject, voicemail or message.  Notification kinds are voicemail, message or missed_call, and
+the profile is a name or virtual number, the default profile if it is left out.
+`
+
+// runCommand runs the command given on the command line, writing its output to w
+func runCommand(w io.Writer, cfg Config, args []string) error {
+	switch args[0] {
+	case "blocklist":
+		return BlocklistCommand(w, cfg, args[1:])
+	case "calls":
+		format := "csv"
+		if len(args) > 1 {
+			format = args[1]
+		}
+		records, err := ReadCallLog(cfg.CallLogPath())
+		if err != nil {
+			return err
+		}
+		return ExportCalls(w, records, format)
+	case "outbox":
+		return outboxCommand(w, cfg, args[1:])
+	case "render-template":
+		if len(args) < 2 {
+			fmt.Fprint(w, usage)
+			return fmt.Errorf("render-template needs a notification kind")
+		}
+		mailbox := "default"
+		if len(args) > 2 {
+			mailbox = args[2]
+		}
+		return RenderTemplate(w, cfg, args[1], mailbox)
+	case "simulate":
+		return simulateCommand(w, cfg, args[1:])
+	default:
+		fmt.Fprint(w, usage)
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+// BlocklistCommand lists, adds or removes blocked and allowed callers, writing the list to w
+func BlocklistCommand(w io.Writer, cfg Config, args []string) error {
+	blocklist, err := OpenBlocklist(cfg, cfg.BlocklistPath())
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if args[0] != "list" && len(args) < 2 {
+		fmt.Fprint(w, usage)
+		return fmt.Errorf("blocklist %s needs a pattern", args[0])
+	}
+	switch args[0] {
+	case "list":
+		rules, allowed := blocklist.Snapshot()
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PATTERN\tACTION\tBLOCKED\tLAST BLOCKED")
+		for _, rule := range rules {
+			last := ""
+			if !rule.Last.IsZero() {
+				last = rule.Last.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", rule.Pattern, rule.Action, rule.Blocked, last)
+		}
+		for _, pattern := range allowed {
+			fmt.Fprintf(tw, "%s\tallow\t\t\n", pattern)
+		}
+		return tw.Flush()
+	case "add":
+		rule := BlockRule{Pattern: args[1]}
+		if len(args) > 2 {
+			rule.Action = args[2]
+		}
+		if len(args) > 3 {
+			rule.Message = strings.Join(args[3:], " ")
+		}
+		return blocklist.Add(rule)
+	case "remove":
+		return blocklist.Remove(args[1])
+	case "allow":
+		return blocklist.AllowCaller(args[1])
+	case "disallow":
+		return blocklist.Disallow(args[1])
+	default:
+		fmt.Fprint(w, usage)
+		return fmt.Errorf("unknown blocklist command %s", args[0])
+	}
+}
+
+func outboxCommand(w io.Writer, cfg Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		queued, err := ReadOutbox(cfg.OutboxPath())
+		if err != nil {
+			return err
+		}
+		dead, err := ReadOutbox(filepath.Join(cfg.OutboxPath(), "dead"))
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATE\tKIND\tFROM\tATTEMPTS\tLAST ERROR")
+		for _, e := range queued {
+			fmt.Fprintf(tw, "%s\tqueued\t%s\t%s\t%d\t%s\n", e.ID, e.Notification.Kind, e.Notification.From, e.Attempts, e.LastError)
+		}
+		for _, e := range dead {
+			fmt.Fprintf(tw, "%s\tdead\t%s\t%s\t%d\t%s\n", e.ID, e.Notification.Kind, e.Notification.From, e.Attempts, e.LastError)
+		}
+		return tw.Flush()
+	case "replay":
+		replayed, err := ReplayDead(cfg, cfg.OutboxPath(), args[1:]...)
+		for _, e := range replayed {
+			fmt.Fprintf(w, "Queued %s notification %s to be sent again\n", e.Notification.Kind, e.ID)
+		}
+		return err
+	default:
+		fmt.Fprint(w, usage)
+		return fmt.Errorf("unknown outbox command %s", args[0])
+	}
+}
+
+func simulateCommand(w io.Writer, cfg Config, args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(w)
+	var call simulator.Call
+	flags.StringVar(&call.From, "from", "+15555550100", "number of the caller")
+	flags.StringVar(&call.To, "to", "+15555550199", "virtual number that was called, choosing the profile")
+	flags.StringVar(&call.CallerName, "name", "", "caller ID name of the caller")
+	flags.StringVar(&call.Transcript, "transcript", "This is a test message from the simulator.", "what the caller says in a voicemail")
+	dial := flags.String("dial", "no-answer", "comma separated status of each dial, like completed, busy or no-answer")
+	digits := flags.String("digits", "", "comma separated digits the caller presses at each menu")
+	screen := flags.String("screen", "", "comma separated digits the person answering presses when screening")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	call.DialStatuses, call.Digits, call.ScreenDigits = splitList(*dial), splitList(*digits), splitList(*screen)
+	return Simulate(w, cfg, call)
+}
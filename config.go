@@ -1,23 +1,240 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"net"
 	"os"
 	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Config holds the settings for twilio-voice.  Settings can be loaded from a JSON config file
+// using the json keys below, and each one can be overridden by the environment variable in its
+// env tag.
 type Config struct {
-	MailgunPublicKey   string
-	MailgunSecretKey   string
-	MailgunDomain      string
-	NotificationEmail  string
-	ForwardingNumber   string
-	VoicemailScript    string
-	VoicemailFile      string
-	EnableCustomPrompt bool
-	ServeDirectory     string
-	VoiceFileName      string
+	MailgunPublicKey       string   `json:"mailgun_public_key" env:"MAILGUN_PUBLIC_KEY"`
+	MailgunSecretKey       string   `json:"mailgun_secret_key" env:"MAILGUN_SECRET_KEY"`
+	MailgunDomain          string   `json:"mailgun_domain" env:"MAILGUN_DOMAIN"`
+	NotificationEmail      string   `json:"notification_email" env:"NOTIFICATION_EMAIL"`
+	ForwardingNumber       string   `json:"forwarding_number" env:"FORWARDING_NUMBER"`
+	VoicemailScript        string   `json:"voicemail_script" env:"VOICEMAIL_SCRIPT"`
+	VoicemailFile          string   `json:"voicemail_file" env:"VOICEMAIL_FILE"`
+	EnableCustomPrompt     bool     `json:"-"`
+	ServeDirectory         string   `json:"-"`
+	VoiceFileName          string   `json:"-"`
+	TwilioAuthToken        string   `json:"twilio_auth_token" env:"TWILIO_AUTH_TOKEN"`
+	TwilioAccountSid       string   `json:"twilio_account_sid" env:"TWILIO_ACCOUNT_SID"`
+	TwilioAPIHosts         []string `json:"twilio_api_hosts" env:"TWILIO_API_HOSTS"`
+	PublicURL              string   `json:"public_url" env:"PUBLIC_URL"`
+	SignatureMode          string   `json:"signature_mode" env:"TWILIO_SIGNATURE_MODE"`
+	OwnerNumbers           []string `json:"owner_numbers" env:"OWNER_NUMBERS"`
+	OutboundPIN            string   `json:"outbound_pin" env:"OUTBOUND_PIN"`
+	DefaultCountryCode     string   `json:"default_country_code" env:"DEFAULT_COUNTRY_CODE"`
+	OutboundAllowCountries []string `json:"outbound_allow_countries" env:"OUTBOUND_ALLOW_COUNTRIES"`
+	OutboundDenyCountries  []string `json:"outbound_deny_countries" env:"OUTBOUND_DENY_COUNTRIES"`
+	DialTimeout            int      `json:"dial_timeout" env:"DIAL_TIMEOUT"`
+	ScreenCalls            bool     `json:"screen_calls" env:"SCREEN_CALLS"`
+	AdminToken             string   `json:"admin_token" env:"ADMIN_TOKEN"`
+	BlocklistFile          string   `json:"blocklist_file" env:"BLOCKLIST_FILE"`
+	Menu                   string   `json:"menu" env:"MENU"`
+	VoicemailDir           string   `json:"voicemail_dir" env:"VOICEMAIL_DIR"`
+	CallLogFile            string   `json:"call_log_file" env:"CALL_LOG_FILE"`
+	CallLogRetentionDays   int      `json:"call_log_retention_days" env:"CALL_LOG_RETENTION_DAYS"`
+	NotifyMissedCalls      bool     `json:"notify_missed_calls" env:"NOTIFY_MISSED_CALLS"`
+	MissedCallMinRing      int      `json:"missed_call_min_ring" env:"MISSED_CALL_MIN_RING"`
+	SMTPHost               string   `json:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort               int      `json:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername           string   `json:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword           string   `json:"smtp_password" env:"SMTP_PASSWORD"`
+	SMTPFrom               string   `json:"smtp_from" env:"SMTP_FROM"`
+	SMTPSecurity           string   `json:"smtp_security" env:"SMTP_SECURITY"`
+	SMTPAuth               string   `json:"smtp_auth" env:"SMTP_AUTH"`
+	SMTPCAFile             string   `json:"smtp_ca_file" env:"SMTP_CA_FILE"`
+	AttachAudio            bool     `json:"attach_audio" env:"ATTACH_AUDIO"`
+	AttachAudioFormat      string   `json:"attach_audio_format" env:"ATTACH_AUDIO_FORMAT"`
+	AttachAudioMaxBytes    int      `json:"attach_audio_max_bytes" env:"ATTACH_AUDIO_MAX_BYTES"`
+	OutboxDir              string   `json:"outbox_dir" env:"OUTBOX_DIR"`
+	OutboxMaxAttempts      int      `json:"outbox_max_attempts" env:"OUTBOX_MAX_ATTEMPTS"`
+	TemplateDir            string   `json:"template_dir" env:"TEMPLATE_DIR"`
+	AdminAddr              string   `json:"admin_addr" env:"ADMIN_ADDR"`
+	ListenAddr             string   `json:"listen_addr" env:"LISTEN_ADDR"`
+	TLSCertFile            string   `json:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile             string   `json:"tls_key_file" env:"TLS_KEY_FILE"`
+	LogFormat              string   `json:"log_format" env:"LOG_FORMAT"`
+	LogLevel               string   `json:"log_level" env:"LOG_LEVEL"`
+	LogRedact              bool     `json:"log_redact" env:"LOG_REDACT"`
+
+	// Schedule holds the business hours of the default profile.  Calls are always forwarded
+	// when there is no schedule.
+	Schedule *Schedule `json:"schedule"`
+	// RingGroup holds the phones to ring for the default profile, instead of the forwarding number
+	RingGroup *RingGroup `json:"ring_group"`
+	// Profiles holds the routing profiles for each virtual number, keyed by number
+	Profiles map[string]Profile `json:"profiles"`
+	// Menus holds the phone menus that profiles can play to callers, keyed by name
+	Menus map[string]*Menu `json:"menus"`
+	// Notifiers holds the channels that voicemails, messages and missed calls are sent on.
+	// Notifications are emailed through the SMTP server or Mailgun when there are none.
+	Notifiers []NotifierConfig `json:"notifiers"`
+	// Now returns the current time when checking schedules, defaulting to time.Now
+	Now func() time.Time `json:"-"`
+
+	// File is the config file the settings were loaded from, if any
+	File string `json:"-"`
+	// sources records where each setting came from, keyed by environment variable
+	sources map[string]string
+	// notifiers are the channels built from Notifiers
+	notifiers []Notifier
+	// templates are the notification templates loaded from TemplateDir
+	templates notificationTemplates
+}
+
+// LoadConfig reads the config file at path, if one is given, then applies overrides from
+// environment variables looked up with getenv
+func LoadConfig(path string, getenv func(string) string) (Config, error) {
+	cfg := Config{File: path, sources: make(map[string]string)}
+	fileKeys := make(map[string]json.RawMessage)
+	if len(path) > 0 {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(b, &fileKeys); err != nil {
+			return cfg, configFileError(path, b, err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, configFileError(path, b, err)
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		env := t.Field(i).Tag.Get("env")
+		if len(env) == 0 {
+			continue
+		}
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if _, ok := fileKeys[key]; ok {
+			cfg.sources[env] = fmt.Sprintf("%s: %s", path, key)
+		}
+		value := getenv(env)
+		if len(value) == 0 {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(splitList(value)))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %s is not true or false", env, value)
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %s is not a number", env, value)
+			}
+			field.SetInt(int64(n))
+		}
+		cfg.sources[env] = env
+	}
+	return cfg, nil
+}
+
+// configFileError adds the file name, line number and key to errors decoding a config file
+func configFileError(path string, b []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line := bytes.Count(b[:e.Offset], []byte("\n")) + 1
+		return fmt.Errorf("%s:%d: %s", path, line, e)
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("%s: %s: expected %s but found %s", path, e.Field, e.Type, e.Value)
+	}
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return fmt.Errorf("%s: unknown key %s", path, strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return fmt.Errorf("%s: %s", path, err)
+}
+
+// BlocklistPath returns the file the blocklist is stored in
+func (cfg *Config) BlocklistPath() string {
+	if len(cfg.BlocklistFile) == 0 {
+		return "blocklist.json"
+	}
+	return cfg.BlocklistFile
+}
+
+// CallLogPath returns the file the call log is journaled to
+func (cfg *Config) CallLogPath() string {
+	if len(cfg.CallLogFile) == 0 {
+		return "calls.jsonl"
+	}
+	return cfg.CallLogFile
+}
+
+// OutboxPath returns the directory notifications are queued in
+func (cfg *Config) OutboxPath() string {
+	if len(cfg.OutboxDir) == 0 {
+		return "outbox"
+	}
+	return cfg.OutboxDir
+}
+
+// now returns the current time from the configured clock
+func (cfg *Config) now() time.Time {
+	if cfg.Now == nil {
+		return time.Now()
+	}
+	return cfg.Now()
+}
+
+// missing returns an error for settings which must be set, explaining where they can be set
+func (cfg *Config) missing(purpose string, envs ...string) error {
+	where := fmt.Sprintf("%s environment variable", strings.Join(envs, ", "))
+	if len(envs) > 1 {
+		where += "s"
+	}
+	if len(cfg.File) > 0 {
+		where += fmt.Sprintf(" or %s in %s", strings.Join(cfg.keys(envs...), ", "), cfg.File)
+	}
+	return fmt.Errorf("set %s %s", where, purpose)
+}
+
+// invalid returns an error for a setting with a bad value, naming the file key or environment
+// variable it came from
+func (cfg *Config) invalid(env string, format string, a ...interface{}) error {
+	source, ok := cfg.sources[env]
+	if !ok {
+		source = env
+	}
+	return fmt.Errorf("%s: %s", source, fmt.Sprintf(format, a...))
+}
+
+// keys returns the config file keys for the environment variables
+func (cfg *Config) keys(envs ...string) []string {
+	var keys []string
+	t := reflect.TypeOf(*cfg)
+	for _, env := range envs {
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("env") == env {
+				keys = append(keys, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+			}
+		}
+	}
+	return keys
 }
 
 func (cfg *Config) Validate() (errors []error) {
@@ -27,18 +244,97 @@ func (cfg *Config) Validate() (errors []error) {
 	}
 	fullVoicemailPath := path.Join(workingDir, cfg.VoicemailFile)
 
-	if (len(cfg.MailgunPublicKey) == 0) || (len(cfg.MailgunSecretKey) == 0) || (len(cfg.MailgunDomain) == 0) {
-		errors = append(errors, fmt.Errorf("set MAILGUN_PUBLIC_KEY, MAILGUN_SECRET_KEY, MAILGUN_DOMAIN environment variables to receive voicemail notifications"))
+	if len(cfg.TwilioAuthToken) == 0 {
+		errors = append(errors, cfg.missing("to verify that requests come from Twilio", "TWILIO_AUTH_TOKEN"))
 	}
-	if len(cfg.NotificationEmail) == 0 {
-		errors = append(errors, fmt.Errorf("set NOTIFICATION_EMAIL environment variable to receive voicemail notifications"))
+	switch cfg.SignatureMode {
+	case "":
+		cfg.SignatureMode = SignatureEnforce
+	case SignatureEnforce, SignatureLogOnly:
+	default:
+		errors = append(errors, cfg.invalid("TWILIO_SIGNATURE_MODE", "signature mode must be %s or %s", SignatureEnforce, SignatureLogOnly))
 	}
 	if len(cfg.ForwardingNumber) == 0 {
-		errors = append(errors, fmt.Errorf("set FORWARDING_NUMBER environment variable to connect your incoming calls to your phone"))
+		errors = append(errors, cfg.missing("to connect your incoming calls to your phone", "FORWARDING_NUMBER"))
+	}
+	if len(cfg.OutboundPIN) > 0 && (len(cfg.OutboundPIN) < 4 || digitsOnly(cfg.OutboundPIN) != cfg.OutboundPIN) {
+		errors = append(errors, cfg.invalid("OUTBOUND_PIN", "outbound PIN must be at least 4 digits"))
+	}
+	if len(cfg.DefaultCountryCode) == 0 {
+		cfg.DefaultCountryCode = "1"
+	}
+	cfg.DefaultCountryCode = digitsOnly(cfg.DefaultCountryCode)
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 15
+	}
+	if cfg.CallLogRetentionDays == 0 {
+		cfg.CallLogRetentionDays = 90
+	}
+	if cfg.CallLogRetentionDays < 0 {
+		errors = append(errors, cfg.invalid("CALL_LOG_RETENTION_DAYS", "call log retention must be a positive number of days"))
+	}
+	if cfg.MissedCallMinRing == 0 {
+		cfg.MissedCallMinRing = 5
+	}
+	if cfg.MissedCallMinRing < 0 {
+		errors = append(errors, cfg.invalid("MISSED_CALL_MIN_RING", "minimum ring must be a positive number of seconds"))
+	}
+	switch cfg.AttachAudioFormat {
+	case "":
+		cfg.AttachAudioFormat = "mp3"
+	case "mp3", "wav":
+	default:
+		errors = append(errors, cfg.invalid("ATTACH_AUDIO_FORMAT", "audio format must be mp3 or wav"))
+	}
+	if cfg.AttachAudioMaxBytes == 0 {
+		// well under the 25MB most mail providers accept
+		cfg.AttachAudioMaxBytes = 10 * 1024 * 1024
+	}
+	if cfg.AttachAudioMaxBytes < 0 {
+		errors = append(errors, cfg.invalid("ATTACH_AUDIO_MAX_BYTES", "attachment size limit must be a positive number of bytes"))
+	}
+	if cfg.OutboxMaxAttempts == 0 {
+		cfg.OutboxMaxAttempts = 8
+	}
+	if cfg.OutboxMaxAttempts < 0 {
+		errors = append(errors, cfg.invalid("OUTBOX_MAX_ATTEMPTS", "outbox attempts must be a positive number"))
+	}
+	if len(cfg.VoicemailDir) == 0 {
+		cfg.VoicemailDir = "voicemails"
+	}
+	switch cfg.LogFormat {
+	case "":
+		cfg.LogFormat = LogLogfmt
+	case LogLogfmt, LogJSON:
+	default:
+		errors = append(errors, cfg.invalid("LOG_FORMAT", "log format must be %s or %s", LogLogfmt, LogJSON))
+	}
+	if len(cfg.LogLevel) == 0 {
+		cfg.LogLevel = LevelInfo
+	}
+	if _, ok := logLevels[cfg.LogLevel]; !ok {
+		errors = append(errors, cfg.invalid("LOG_LEVEL", "log level must be %s, %s, %s or %s", LevelDebug, LevelInfo, LevelWarn, LevelError))
+	}
+	if len(cfg.ListenAddr) == 0 {
+		cfg.ListenAddr = ":8080"
+	}
+	if _, _, err := net.SplitHostPort(cfg.ListenAddr); err != nil {
+		errors = append(errors, cfg.invalid("LISTEN_ADDR", "listen address must be a port like :8080 or a host and port like 127.0.0.1:8080"))
+	}
+	if (len(cfg.TLSCertFile) > 0) != (len(cfg.TLSKeyFile) > 0) {
+		errors = append(errors, cfg.missing("to serve over TLS", "TLS_CERT_FILE", "TLS_KEY_FILE"))
+	}
+	if len(cfg.AdminAddr) > 0 {
+		if _, _, err := net.SplitHostPort(cfg.AdminAddr); err != nil {
+			errors = append(errors, cfg.invalid("ADMIN_ADDR", "admin address must be a host and port like 127.0.0.1:9090"))
+		}
+	}
+	if cfg.DialTimeout < 0 {
+		errors = append(errors, cfg.invalid("DIAL_TIMEOUT", "dial timeout must be a positive number of seconds"))
 	}
 	// If no voicemail file is accessible and no script is set, falls back to generic voicemail prompt
 	if stat, err := os.Stat(fullVoicemailPath); os.IsNotExist(err) || stat.IsDir() {
-		log.Printf("Voicemail file not found, falling back to voice prompt")
+		logger.Warn("Voicemail file not found, falling back to voice prompt", "file", cfg.VoicemailFile)
 		cfg.VoicemailFile = ""
 		if len(cfg.VoicemailScript) == 0 {
 			cfg.VoicemailScript = "Please leave a message"
@@ -48,5 +344,19 @@ func (cfg *Config) Validate() (errors []error) {
 		cfg.EnableCustomPrompt = true
 		cfg.ServeDirectory, cfg.VoiceFileName = path.Split(fullVoicemailPath)
 	}
+	if cfg.Schedule != nil {
+		for _, err := range cfg.Schedule.Compile() {
+			errors = append(errors, fmt.Errorf("%s: schedule.%s", cfg.File, err))
+		}
+	}
+	if cfg.RingGroup != nil {
+		for _, err := range cfg.RingGroup.compile(cfg.DialTimeout) {
+			errors = append(errors, fmt.Errorf("%s: ring_group.%s", cfg.File, err))
+		}
+	}
+	errors = append(errors, cfg.validateProfiles()...)
+	errors = append(errors, cfg.validateTemplates()...)
+	errors = append(errors, cfg.validateMenus()...)
+	errors = append(errors, cfg.buildNotifiers()...)
 	return
 }
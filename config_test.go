@@ -2,7 +2,9 @@ package main_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	. "github.com/BTBurke/twilio-voice"
 
@@ -20,6 +22,7 @@ var _ = Describe("Config", func() {
 			MailgunDomain:     "example.com",
 			ForwardingNumber:  "+15555555",
 			NotificationEmail: "voicemail@example.com",
+			TwilioAuthToken:   "12345",
 		}
 	})
 
@@ -105,6 +108,21 @@ var _ = Describe("Config", func() {
 			))
 		})
 
+		It("doesn't need NotificationEmail without an email channel sending to it", func() {
+			cfg.NotificationEmail = ""
+			cfg.Notifiers = []NotifierConfig{
+				{Type: NotifierWebhook, URL: "https://example.com/hook"},
+				{Type: NotifierMailgun, To: []string{"office@example.com"}},
+				{Type: NotifierLog},
+			}
+			Expect(cfg.Validate()).To(BeEmpty())
+
+			cfg.Notifiers = append(cfg.Notifiers, NotifierConfig{Type: NotifierSMTP, Name: "backup", Host: "mail.example.com", From: "voicemail@example.com"})
+			errs := cfg.Validate()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0]).To(MatchError(MatchRegexp("set.*NOTIFICATION_EMAIL")))
+		})
+
 		It("returns error when missing ForwardingNumber", func() {
 			cfg.ForwardingNumber = ""
 
@@ -114,5 +132,154 @@ var _ = Describe("Config", func() {
 				MatchRegexp("set.*FORWARDING_NUMBER"),
 			))
 		})
+
+		It("returns error when missing TwilioAuthToken", func() {
+			cfg.TwilioAuthToken = ""
+
+			errs := cfg.Validate()
+			Expect(len(errs)).To(Equal(1))
+			Expect(errs[0]).To(MatchError(
+				MatchRegexp("set.*TWILIO_AUTH_TOKEN"),
+			))
+		})
+
+		It("defaults SignatureMode to enforce", func() {
+			Expect(cfg.Validate()).To(BeEmpty())
+			Expect(cfg.SignatureMode).To(Equal(SignatureEnforce))
+		})
+
+		It("returns error when SignatureMode is unknown", func() {
+			cfg.SignatureMode = "sometimes"
+
+			errs := cfg.Validate()
+			Expect(len(errs)).To(Equal(1))
+			Expect(errs[0]).To(MatchError(
+				MatchRegexp("TWILIO_SIGNATURE_MODE: .*enforce or log"),
+			))
+		})
+	})
+
+	Describe("LoadConfig", func() {
+		var (
+			dir  string
+			env  map[string]string
+			file string
+		)
+
+		getenv := func(key string) string {
+			return env[key]
+		}
+
+		writeFile := func(contents string) {
+			Expect(ioutil.WriteFile(file, []byte(contents), 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "twilio-voice")
+			Expect(err).NotTo(HaveOccurred())
+			file = filepath.Join(dir, "config.json")
+			env = map[string]string{}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("loads settings from environment variables without a file", func() {
+			env["FORWARDING_NUMBER"] = "+15555555"
+			env["OWNER_NUMBERS"] = "+15551111, +15552222"
+
+			loaded, err := LoadConfig("", getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.ForwardingNumber).To(Equal("+15555555"))
+			Expect(loaded.OwnerNumbers).To(Equal([]string{"+15551111", "+15552222"}))
+		})
+
+		It("loads settings from the file", func() {
+			writeFile(`{"forwarding_number": "+15555555", "owner_numbers": ["+15551111"]}`)
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.ForwardingNumber).To(Equal("+15555555"))
+			Expect(loaded.OwnerNumbers).To(Equal([]string{"+15551111"}))
+			Expect(loaded.File).To(Equal(file))
+		})
+
+		It("lets environment variables override the file", func() {
+			writeFile(`{"forwarding_number": "+15555555", "mailgun_domain": "example.com"}`)
+			env["FORWARDING_NUMBER"] = "+15556666"
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.ForwardingNumber).To(Equal("+15556666"))
+			Expect(loaded.MailgunDomain).To(Equal("example.com"))
+		})
+
+		It("ignores empty environment variables", func() {
+			writeFile(`{"forwarding_number": "+15555555"}`)
+			env["FORWARDING_NUMBER"] = ""
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.ForwardingNumber).To(Equal("+15555555"))
+		})
+
+		It("returns error when the file does not exist", func() {
+			_, err := LoadConfig(filepath.Join(dir, "missing.json"), getenv)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns error with the line number when the file is malformed", func() {
+			writeFile("{\n  \"forwarding_number\": \"+15555555\"\n  \"mailgun_domain\": \"example.com\"\n}")
+
+			_, err := LoadConfig(file, getenv)
+			Expect(err).To(MatchError(HavePrefix(file + ":3:")))
+		})
+
+		It("returns error naming an unknown key", func() {
+			writeFile(`{"forwarding_nmber": "+15555555"}`)
+
+			_, err := LoadConfig(file, getenv)
+			Expect(err).To(MatchError(MatchRegexp("config.json: unknown key .*forwarding_nmber")))
+		})
+
+		It("returns error naming a key with the wrong type", func() {
+			writeFile(`{"owner_numbers": "+15551111"}`)
+
+			_, err := LoadConfig(file, getenv)
+			Expect(err).To(MatchError(MatchRegexp("config.json: owner_numbers: ")))
+		})
+
+		It("reports validation errors with the key in the file", func() {
+			writeFile(`{"signature_mode": "sometimes"}`)
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Validate()).To(ContainElement(
+				MatchError(file + ": signature_mode: signature mode must be enforce or log"),
+			))
+		})
+
+		It("reports validation errors with the environment variable that overrode the file", func() {
+			writeFile(`{"signature_mode": "enforce"}`)
+			env["TWILIO_SIGNATURE_MODE"] = "sometimes"
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Validate()).To(ContainElement(
+				MatchError("TWILIO_SIGNATURE_MODE: signature mode must be enforce or log"),
+			))
+		})
+
+		It("reports missing settings with both the environment variable and file key", func() {
+			writeFile(`{}`)
+
+			loaded, err := LoadConfig(file, getenv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Validate()).To(ContainElement(
+				MatchError("set FORWARDING_NUMBER environment variable or forwarding_number in " + file + " to connect your incoming calls to your phone"),
+			))
+		})
 	})
 })
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// StatusRequest is the status callback Twilio sends as a call progresses and when it ends
+type StatusRequest struct {
+	twiml.VoiceRequest
+	CallDuration int
+}
+
+// CallEvent is published on the event bus each time a call moves to a new status
+type CallEvent struct {
+	Call     twiml.VoiceRequest
+	Previous string
+	Status   string
+	// Duration is the length of the call in seconds, sent once the call has ended
+	Duration int
+	At       time.Time
+}
+
+// Ended returns true if the event is the end of the call
+func (e CallEvent) Ended() bool {
+	return callEnded(e.Status)
+}
+
+// EventBus delivers call events to the components that subscribe to them
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []func(CallEvent)
+}
+
+// NewEventBus returns an event bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe calls fn with every event published from now on.  Subscribers are called in the
+// order they subscribed, on the goroutine publishing the event, so they should not block.
+func (b *EventBus) Subscribe(fn func(CallEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish delivers the event to every subscriber
+func (b *EventBus) Publish(e CallEvent) {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
+
+// callTransitions lists the statuses a call can move to from each status.  The final statuses
+// have no transitions.
+var callTransitions = map[string][]string{
+	"":               {twiml.Queued, twiml.Ringing, twiml.InProgress, twiml.Completed, twiml.Busy, twiml.Failed, twiml.NoAnswer, twiml.Canceled},
+	twiml.Queued:     {twiml.Ringing, twiml.InProgress, twiml.Completed, twiml.Busy, twiml.Failed, twiml.NoAnswer, twiml.Canceled},
+	twiml.Ringing:    {twiml.InProgress, twiml.Completed, twiml.Busy, twiml.Failed, twiml.NoAnswer, twiml.Canceled},
+	twiml.InProgress: {twiml.Completed, twiml.Failed},
+}
+
+// IllegalTransition is the error for a status callback that moves a call to a status it can't
+// reach from its current status, such as a callback that arrives out of order
+type IllegalTransition struct {
+	CallSid string
+	From    string
+	To      string
+}
+
+func (e IllegalTransition) Error() string {
+	return fmt.Sprintf("call %s cannot move from %q to %q", e.CallSid, e.From, e.To)
+}
+
+// How long CallStates remembers a call after its last status callback.  An ended call is kept
+// for a while in case a callback is repeated, and a call that never sends a final status is
+// forgotten once it is older than the longest call Twilio allows.
+const (
+	endedCallTTL = time.Hour
+	staleCallTTL = 24 * time.Hour
+)
+
+// callState is the current status of a call
+type callState struct {
+	callSid string
+	status  string
+	updated time.Time
+}
+
+// CallStates tracks the status of each call from its status callbacks, and publishes an event
+// on the bus for each change
+type CallStates struct {
+	mu    sync.Mutex
+	calls map[string]*list.Element
+	// order holds the *callState of each call, least recently updated first
+	order *list.List
+	bus   *EventBus
+	now   func() time.Time
+}
+
+// NewCallStates returns a state machine for calls that publishes to the bus
+func NewCallStates(cfg Config, bus *EventBus) *CallStates {
+	return &CallStates{
+		calls: make(map[string]*list.Element),
+		order: list.New(),
+		bus:   bus,
+		now:   cfg.now,
+	}
+}
+
+// Transition moves the call to the status in the callback and publishes the change.  A repeated
+// status is ignored, and an illegal transition returns an IllegalTransition error and leaves the
+// call where it was.
+func (s *CallStates) Transition(sr StatusRequest) error {
+	s.mu.Lock()
+	now := s.now()
+	s.prune(now)
+	var current callState
+	e, ok := s.calls[sr.CallSid]
+	if ok {
+		current = *e.Value.(*callState)
+	}
+	if current.status == sr.CallStatus {
+		s.mu.Unlock()
+		return nil
+	}
+	if !canTransition(current.status, sr.CallStatus) {
+		s.mu.Unlock()
+		return IllegalTransition{CallSid: sr.CallSid, From: current.status, To: sr.CallStatus}
+	}
+	if ok {
+		c := e.Value.(*callState)
+		c.status, c.updated = sr.CallStatus, now
+		s.order.MoveToBack(e)
+	} else {
+		s.calls[sr.CallSid] = s.order.PushBack(&callState{callSid: sr.CallSid, status: sr.CallStatus, updated: now})
+	}
+	s.mu.Unlock()
+	if callEnded(sr.CallStatus) {
+		callsTotal.Inc(sr.To, sr.CallStatus)
+	}
+
+	s.bus.Publish(CallEvent{
+		Call:     sr.VoiceRequest,
+		Previous: current.status,
+		Status:   sr.CallStatus,
+		Duration: sr.CallDuration,
+		At:       now,
+	})
+	return nil
+}
+
+// prune forgets ended calls and stale calls, looking only at the calls that haven't been updated
+// recently.  The lock must be held.
+func (s *CallStates) prune(now time.Time) {
+	for e := s.order.Front(); e != nil; {
+		c := e.Value.(*callState)
+		age := now.Sub(c.updated)
+		if age <= endedCallTTL {
+			return
+		}
+		next := e.Next()
+		if callEnded(c.status) || age > staleCallTTL {
+			s.order.Remove(e)
+			delete(s.calls, c.callSid)
+		}
+		e = next
+	}
+}
+
+// State returns the current status of the call, or an empty string for a call it hasn't seen
+func (s *CallStates) State(callSid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.calls[callSid]; ok {
+		return e.Value.(*callState).status
+	}
+	return ""
+}
+
+func canTransition(from string, to string) bool {
+	for _, next := range callTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Status receives status callbacks as calls progress.  It is outside the mail control loop.  In
+// this case, acknowledging the status to continue the call is the right thing to do.  Each
+// callback moves the call through its states, publishing the change to the event bus.
+func Status(cfg Config, states *CallStates) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sr StatusRequest
+		if err := twiml.Bind(&sr, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		if err := states.Transition(sr); err != nil {
+			requestLog(r).Warn("Ignoring status callback", "error", err)
+		}
+		w.WriteHeader(200)
+	}
+}
@@ -0,0 +1,103 @@
+package main_test
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CallStates", func() {
+	var cfg Config
+	var bus *EventBus
+	var states *CallStates
+	var events []CallEvent
+
+	BeforeEach(func() {
+		cfg = Config{Now: func() time.Time { return time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC) }}
+		bus = NewEventBus()
+		events = nil
+		bus.Subscribe(func(e CallEvent) { events = append(events, e) })
+		states = NewCallStates(cfg, bus)
+	})
+
+	// replay feeds a recorded sequence of status callbacks for one call through the Status handler
+	replay := func(statuses ...string) {
+		for _, status := range statuses {
+			form := url.Values{"CallSid": {"CA123"}, "From": {"+15557654321"}, "To": {"+15550001111"}, "CallStatus": {status}}
+			if status == twiml.Completed {
+				form.Set("CallDuration", "37")
+			}
+			postForm(Status(cfg, states), "/status", form)
+		}
+	}
+
+	DescribeTable("recorded callback sequences",
+		func(sequence []string, final string, published int) {
+			replay(sequence...)
+			Expect(states.State("CA123")).To(Equal(final))
+			Expect(events).To(HaveLen(published))
+		},
+		Entry("answered call", []string{"queued", "ringing", "in-progress", "completed"}, "completed", 4),
+		Entry("busy", []string{"ringing", "busy"}, "busy", 2),
+		Entry("no answer", []string{"queued", "ringing", "no-answer"}, "no-answer", 3),
+		Entry("caller hung up while ringing", []string{"ringing", "canceled"}, "canceled", 2),
+		Entry("failed", []string{"queued", "failed"}, "failed", 2),
+		Entry("only the final callback", []string{"completed"}, "completed", 1),
+		Entry("repeated callbacks", []string{"ringing", "ringing", "in-progress", "in-progress", "completed"}, "completed", 3),
+		Entry("ringing arrives late", []string{"in-progress", "ringing", "completed"}, "completed", 2),
+		Entry("callbacks after the call ended", []string{"ringing", "completed", "in-progress", "busy"}, "completed", 2),
+		Entry("answered call reported busy", []string{"in-progress", "busy"}, "in-progress", 1),
+	)
+
+	It("reports illegal transitions", func() {
+		Expect(states.Transition(StatusRequest{VoiceRequest: twiml.VoiceRequest{CallSid: "CA1", CallStatus: twiml.Completed}})).To(Succeed())
+		err := states.Transition(StatusRequest{VoiceRequest: twiml.VoiceRequest{CallSid: "CA1", CallStatus: twiml.Ringing}})
+		Expect(err).To(Equal(IllegalTransition{CallSid: "CA1", From: twiml.Completed, To: twiml.Ringing}))
+	})
+
+	It("publishes the details of each change", func() {
+		replay("ringing", "in-progress", "completed")
+		Expect(events[0].Previous).To(BeEmpty())
+		Expect(events[0].Status).To(Equal(twiml.Ringing))
+		Expect(events[0].Call.From).To(Equal("+15557654321"))
+		Expect(events[0].Ended()).To(BeFalse())
+		Expect(events[2].Previous).To(Equal(twiml.InProgress))
+		Expect(events[2].Ended()).To(BeTrue())
+		Expect(events[2].Duration).To(Equal(37))
+	})
+
+	It("forgets ended calls after an hour and calls that never end after a day", func() {
+		now := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		cfg.Now = func() time.Time { return now }
+		states = NewCallStates(cfg, bus)
+		transition := func(sid string, status string) {
+			Expect(states.Transition(StatusRequest{VoiceRequest: twiml.VoiceRequest{CallSid: sid, CallStatus: status}})).To(Succeed())
+		}
+		transition("CA1", twiml.Ringing)
+		transition("CA2", twiml.Ringing)
+		transition("CA2", twiml.Completed)
+		transition("CA3", twiml.InProgress)
+
+		now = now.Add(2 * time.Hour)
+		transition("CA4", twiml.Ringing)
+		Expect(states.State("CA1")).To(Equal(twiml.Ringing))
+		Expect(states.State("CA2")).To(BeEmpty())
+		Expect(states.State("CA3")).To(Equal(twiml.InProgress))
+
+		now = now.Add(12 * time.Hour)
+		transition("CA3", twiml.Completed)
+		Expect(states.State("CA3")).To(Equal(twiml.Completed))
+		now = now.Add(11 * time.Hour)
+		transition("CA5", twiml.Ringing)
+		Expect(states.State("CA1")).To(BeEmpty())
+		Expect(states.State("CA3")).To(BeEmpty())
+		Expect(states.State("CA4")).To(Equal(twiml.Ringing))
+		Expect(states.State("CA5")).To(Equal(twiml.Ringing))
+	})
+})
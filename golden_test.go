@@ -0,0 +1,204 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+	"github.com/gorilla/schema"
+	"github.com/pressly/chi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// update rewrites the goldens with the TwiML the handlers return, for when a change to the
+// responses is intended.  Review the diff of testdata/twiml before committing it.
+var update = flag.Bool("update", false, "rewrite the golden TwiML files in testdata/twiml")
+
+// canonicalTwiML indents TwiML one element per line with the attributes of each element in
+// order, so that a golden only changes when the response means something different
+func canonicalTwiML(b []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	out := new(bytes.Buffer)
+	e := xml.NewEncoder(out)
+	e.Indent("", "  ")
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			sort.Slice(t.Attr, func(i, j int) bool { return t.Attr[i].Name.Local < t.Attr[j].Name.Local })
+			tok = t
+		case xml.CharData:
+			text := bytes.TrimSpace(t)
+			if len(text) == 0 {
+				continue
+			}
+			tok = xml.CharData(text)
+		case xml.ProcInst, xml.Comment, xml.Directive:
+			continue
+		}
+		if err := e.EncodeToken(tok); err != nil {
+			return "", err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return "", err
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+var _ = Describe("TwiML goldens", func() {
+	var f *fixture
+	var router *chi.Mux
+
+	BeforeEach(func() {
+		cfg := testConfig()
+		cfg.VoicemailScript = "Sorry we missed you, please leave a message"
+		cfg.OutboundPIN = "1234"
+		cfg.OwnerNumbers = []string{"+15551230000"}
+		cfg.Now = func() time.Time { return time.Date(2017, 12, 23, 12, 0, 0, 0, time.UTC) }
+		cfg.Profiles = map[string]Profile{
+			"+15550001111": {
+				Name: "sales",
+				RingGroup: &RingGroup{Members: []RingMember{
+					{Number: "+15551111111"},
+					{Number: "+15551112222", Screen: true},
+				}},
+			},
+			"+15550002222": {
+				Name:            "support",
+				VoicemailScript: "Support is busy, please leave a message",
+				RingGroup: &RingGroup{Strategy: RingSequential, Members: []RingMember{
+					{Number: "+15552221111", Timeout: 10},
+					{Number: "+15552222222"},
+				}},
+			},
+			"+15550003333": {
+				Name:              "recorded",
+				ForwardingNumbers: []string{"+15553331111"},
+				VoicemailFile:     "testdata/greeting.mp3",
+			},
+			"+15550004444": {
+				Name:              "hours",
+				ForwardingNumbers: []string{"+15554441111"},
+				Schedule: &Schedule{
+					TimeZone:   "UTC",
+					Hours:      map[string][]string{"weekdays": {"09:00-17:00"}},
+					AfterHours: AfterHours{Action: AfterHoursMessage, Message: "We are open weekdays from nine to five"},
+				},
+			},
+			"+15550005555": {
+				Name:              "menu",
+				ForwardingNumbers: []string{"+15555551111"},
+				Menu:              "main",
+			},
+		}
+		cfg.Menus = map[string]*Menu{
+			"main": {
+				Say: "Press 1 for sales, 2 to leave a message for support",
+				Options: map[string]MenuAction{
+					"1": {Dial: "sales"},
+					"2": {Voicemail: "support"},
+				},
+			},
+		}
+		f = newFixture(cfg)
+
+		blocklist, err := OpenBlocklist(f.cfg, filepath.Join(f.dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocklist.Add(BlockRule{Pattern: "+15559990000", Action: BlockBusy})).To(Succeed())
+		screening := NewScreening(f.cfg)
+		screening.Decline("CAdeclined")
+
+		router = chi.NewRouter()
+		router.Post("/call/", CallRequest(f.cfg, blocklist, f.calls))
+		router.Post("/call/action/", DialAction(f.cfg, screening, f.calls))
+	})
+
+	AfterEach(func() {
+		f.close()
+	})
+
+	// call is the incoming call webhook from the caller to the number, with the status given
+	call := func(from string, to string, status string) twiml.VoiceRequest {
+		return twiml.VoiceRequest{
+			CallSid:    "CA123",
+			AccountSid: "AC123",
+			From:       from,
+			To:         to,
+			CallStatus: status,
+			APIVersion: "2010-04-01",
+			Direction:  "inbound",
+		}
+	}
+
+	// dialed is the dial action webhook for a call that was forwarded with the dial status given
+	dialed := func(to string, status string) twiml.DialActionRequest {
+		return twiml.DialActionRequest{
+			VoiceRequest:   call("+15557654321", to, twiml.InProgress),
+			DialCallStatus: status,
+			DialCallSid:    "CA456",
+		}
+	}
+
+	DescribeTable("responses",
+		func(golden string, target string, fixture interface{}) {
+			form := url.Values{}
+			// this version of the encoder returns an empty MultiError when it succeeds
+			err := schema.NewEncoder().Encode(fixture, form)
+			Expect(err).To(BeEmpty())
+			actual, err := canonicalTwiML([]byte(postForm(router.ServeHTTP, target, form)))
+			Expect(err).ToNot(HaveOccurred())
+			file := filepath.Join("testdata", "twiml", golden+".xml")
+			if *update {
+				Expect(os.MkdirAll(filepath.Dir(file), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(file, []byte(actual), 0644)).To(Succeed())
+			}
+			expected, err := ioutil.ReadFile(file)
+			Expect(err).ToNot(HaveOccurred(), "run go test -update to create the golden")
+			Expect(actual).To(Equal(string(expected)), "run go test -update if the change is intended")
+		},
+		Entry("call in progress", "call_in_progress", "/call/", call("+15557654321", "+15550009999", twiml.InProgress)),
+		Entry("call ringing", "call_ringing", "/call/", call("+15557654321", "+15550009999", twiml.Ringing)),
+		Entry("call queued for a ring group with screening", "call_queued_ring_group", "/call/", call("+15557654321", "+15550001111", twiml.Queued)),
+		Entry("call ringing a sequential ring group", "call_sequential", "/call/", call("+15557654321", "+15550002222", twiml.Ringing)),
+		Entry("call from a blocked caller", "call_blocked", "/call/", call("+15559990000", "+15550009999", twiml.Ringing)),
+		Entry("call after hours", "call_after_hours", "/call/", call("+15557654321", "+15550004444", twiml.Ringing)),
+		Entry("call to a profile with a menu", "call_menu", "/call/", call("+15557654321", "+15550005555", twiml.Ringing)),
+		Entry("call from the owner with outbound calling", "call_owner", "/call/", call("+15551230000", "+15550009999", twiml.Ringing)),
+		Entry("call already completed", "call_hangup", "/call/", call("+15557654321", "+15550009999", twiml.Completed)),
+
+		Entry("dial answered", "action_completed", "/call/action/", dialed("+15550009999", twiml.Completed)),
+		Entry("dial not answered with a script", "action_no_answer_script", "/call/action/", dialed("+15550009999", twiml.NoAnswer)),
+		Entry("dial busy with a recorded prompt", "action_busy_prompt", "/call/action/", dialed("+15550003333", twiml.Busy)),
+		Entry("dial failed with another member to try", "action_failed_next_step", "/call/action/?step=1", dialed("+15550002222", twiml.Failed)),
+		Entry("dial not answered by the last member", "action_no_answer_last_step", "/call/action/?step=2", dialed("+15550002222", twiml.NoAnswer)),
+		Entry("dial declined during screening", "action_declined", "/call/action/", func() twiml.DialActionRequest {
+			ca := dialed("+15550001111", twiml.Completed)
+			ca.DialCallSid = "CAdeclined"
+			return ca
+		}()),
+		Entry("dial answered by one member after another declined", "action_completed_after_decline", "/call/action/", dialed("+15550001111", twiml.Completed)),
+		Entry("dial not answered for a menu mailbox", "action_mailbox", "/call/action/?mailbox=support", dialed("+15550005555", twiml.NoAnswer)),
+	)
+})
@@ -1,21 +1,22 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/BTBurke/twiml"
 )
 
-// CallRequest will return XML to connect to the forwarding number
-func CallRequest(cfg Config) func(http.ResponseWriter, *http.Request) {
+// CallRequest will return XML to connect to the forwarding number, unless the caller is blocked
+func CallRequest(cfg Config, blocklist *Blocklist, calls *CallLog) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var cr twiml.VoiceRequest
 		if err := twiml.Bind(&cr, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
 			http.Error(w, http.StatusText(400), 400)
 			return
 		}
+		calls.Track(cr)
 		res := twiml.NewResponse()
 
 		switch status := cr.CallStatus; status {
@@ -23,84 +24,76 @@ func CallRequest(cfg Config) func(http.ResponseWriter, *http.Request) {
 			w.WriteHeader(200)
 			return
 		case twiml.Ringing, twiml.Queued:
-			d := twiml.Dial{
-				Number:   cfg.ForwardingNumber,
-				Action:   "action/",
-				Timeout:  15,
-				CallerID: cr.To,
-			}
-			res.Add(&d)
-			b, err := res.Encode()
-			if err != nil {
-				http.Error(w, http.StatusText(502), 502)
+			if len(cfg.OutboundPIN) > 0 && cfg.IsOwner(cr.From) {
+				res.Add(outboundPrompt()...)
+				writeResponse(w, r, res)
 				return
 			}
-			if _, err := w.Write(b); err != nil {
-				http.Error(w, http.StatusText(502), 502)
+			profile := cfg.Profile(cr.To)
+			calls.Update(cr.CallSid, func(c *CallRecord) { c.Profile = profile.Name })
+			if rule, ok := blocklist.Check(cr.From); ok {
+				requestLog(r).Info("Blocked call", "from", cr.From, "pattern", rule.Pattern, "action", rule.Action)
+				calls.Update(cr.CallSid, func(c *CallRecord) { c.Outcome = OutcomeBlocked })
+				res.Add(blocked(rule, profile)...)
+				writeResponse(w, r, res)
 				return
 			}
-			w.Header().Set("Content-Type", "application/xml")
-			w.WriteHeader(200)
-			return
-		default:
-			res.Add(&twiml.Hangup{})
-			b, err := res.Encode()
-			if err != nil {
-				http.Error(w, http.StatusText(502), 502)
+			if profile.Schedule != nil && !profile.Schedule.Open(cfg.now()) {
+				res.Add(afterHours(profile, cr.To)...)
+				writeResponse(w, r, res)
 				return
 			}
-			if _, err := w.Write(b); err != nil {
-				http.Error(w, http.StatusText(502), 502)
+			if len(profile.Menu) > 0 {
+				res.Add(menuPrompt(profile.Menu, cfg.Menus[profile.Menu], 0)...)
+				writeResponse(w, r, res)
 				return
 			}
-			w.Header().Set("Content-Type", "application/xml")
-			w.WriteHeader(200)
+			res.Add(dialProfile(cfg, profile, cr))
+			writeResponse(w, r, res)
+			return
+		default:
+			res.Add(&twiml.Hangup{})
+			writeResponse(w, r, res)
 			return
 		}
 	}
 }
 
-// DialAction will forward to voicemail if the call is not connected
-func DialAction(cfg Config) func(http.ResponseWriter, *http.Request) {
+// DialAction will try the next member of a sequential ring group, or forward to voicemail if the
+// call is not connected
+func DialAction(cfg Config, screening *Screening, calls *CallLog) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var ca twiml.DialActionRequest
 		if err := twiml.Bind(&ca, r); err != nil {
-			log.Printf("%v", err)
+			requestLog(r).Warn("Unable to read webhook", "error", err)
 			http.Error(w, http.StatusText(400), 400)
 			return
 		}
 		res := twiml.NewResponse()
-		switch status := ca.DialCallStatus; status {
-		case twiml.NoAnswer, twiml.Failed, twiml.Busy:
-			if cfg.EnableCustomPrompt {
-				p := twiml.Play{URL: fmt.Sprintf("/prompt/%s", cfg.VoiceFileName)}
-				res.Add(&p)
-			} else {
-				s := twiml.Say{
-					Voice: "woman",
-					Text:  cfg.VoicemailScript,
-				}
-				res.Add(&s)
-			}
-
-			rec := twiml.Record{
-				Transcribe:         true,
-				TranscribeCallback: "/voicemail",
-				MaxLength:          30,
-			}
-			res.Add(&rec)
-
-			b, err := res.Encode()
-			if err != nil {
-				http.Error(w, http.StatusText(502), 502)
-				return
+		status := ca.DialCallStatus
+		// the leg that was bridged hung up at the screening prompt
+		if status == twiml.Completed && screening.Declined(ca.DialCallSid) {
+			status = twiml.NoAnswer
+		}
+		dialOutcomes.Inc(status)
+		calls.Track(ca.VoiceRequest)
+		calls.Update(ca.CallSid, func(c *CallRecord) {
+			c.DialCallStatus = status
+			c.DialCallDuration += ca.DialCallDuration
+			if status == twiml.Completed {
+				c.Outcome = OutcomeAnswered
 			}
-			if _, err := w.Write(b); err != nil {
-				http.Error(w, http.StatusText(502), 502)
+		})
+		switch status {
+		case twiml.NoAnswer, twiml.Failed, twiml.Busy:
+			profile := cfg.requestProfile(r, ca.To)
+			if step, ok := nextStep(profile, r.URL.Query().Get("step")); ok {
+				res.Add(dialStep(cfg, profile, step, ca.VoiceRequest))
+				writeResponse(w, r, res)
 				return
 			}
-			w.Header().Set("Content-Type", "application/xml")
-			w.WriteHeader(200)
+			res.Add(voicemailPrompt(profile)...)
+			writeResponse(w, r, res)
 			return
 		default:
 			w.WriteHeader(200)
@@ -110,29 +103,78 @@ func DialAction(cfg Config) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// voicemailPrompt plays the voicemail greeting of the profile and records a message
+func voicemailPrompt(profile Profile) []twiml.Markup {
+	var greeting twiml.Markup
+	if len(profile.PromptURL) > 0 {
+		greeting = &twiml.Play{URL: profile.PromptURL}
+	} else {
+		greeting = &twiml.Say{
+			Voice: "woman",
+			Text:  profile.VoicemailScript,
+		}
+	}
+	rec := twiml.Record{
+		Transcribe:         true,
+		TranscribeCallback: profile.withMailbox("/voicemail"),
+		MaxLength:          30,
+
+		RecordingStatusCallback: profile.withMailbox("/voicemail/recording"),
+	}
+	return []twiml.Markup{greeting, &rec}
+}
+
 // Voicemail handles the TranscriptionCallback which lets you know that transcription is done and the
-// voicemail is available.  If Mailgun is set, it will email a copy of the transcription text and
-// a link to the voicemail to your email address
-func Voicemail(cfg Config) func(http.ResponseWriter, *http.Request) {
+// voicemail is available.  The voicemail is archived with its transcription, and if Mailgun is
+// set, it will email a copy of the transcription text and a link to the voicemail to your email
+// address
+func Voicemail(cfg Config, archiver *Archiver, calls *CallLog, outbox *Outbox) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var tcb twiml.TranscribeCallbackRequest
 		if err := twiml.Bind(&tcb, r); err != nil {
-			log.Printf("%v", err)
+			requestLog(r).Warn("Unable to read webhook", "error", err)
 			http.Error(w, http.StatusText(400), 400)
 			return
 		}
-		log.Printf("Call from: %s\n\nTranscription follows:\n%s\n\nVoicemail Link: %s\n", tcb.From, tcb.TranscriptionText, tcb.RecordingURL)
-		if err := Send(cfg, tcb); err != nil {
-			log.Printf("Unable to send notification email due to error: %s\n\nVoicemail available at: %s", err, tcb.RecordingURL)
+		requestLog(r).Info("Voicemail transcribed", "from", tcb.From, "status", tcb.TranscriptionStatus, "transcript_length", utf8.RuneCountInString(tcb.TranscriptionText), "recording_url", tcb.RecordingURL)
+		profile := cfg.requestProfile(r, tcb.To)
+		voicemailsTotal.Inc(profile.Name)
+		if tcb.TranscriptionStatus == "completed" {
+			transcriptionLength.Observe(float64(utf8.RuneCountInString(tcb.TranscriptionText)))
+		}
+		v, err := archiver.Archive(VoicemailRecord{
+			ID:           tcb.RecordingSid,
+			CallSid:      tcb.CallSid,
+			From:         tcb.From,
+			To:           tcb.To,
+			Mailbox:      r.URL.Query().Get("mailbox"),
+			Transcript:   tcb.TranscriptionText,
+			RecordingURL: tcb.RecordingURL,
+		})
+		if err != nil {
+			requestLog(r).Error("Unable to archive voicemail", "recording_sid", tcb.RecordingSid, "error", err)
+		}
+		calls.Update(tcb.CallSid, func(c *CallRecord) {
+			c.Outcome, c.VoicemailID = OutcomeVoicemail, tcb.RecordingSid
+		})
+		call, _ := calls.Record(tcb.CallSid)
+		if err := outbox.Send(cfg, profile, v, call); err != nil {
+			requestLog(r).Error("Unable to queue voicemail notification", "recording_url", tcb.RecordingURL, "error", err)
 		}
 		w.WriteHeader(200)
 	}
 }
 
-// Status receives in-progress status events.  It is outside the mail control loop.  In this case,
-// acknowledging the status to continue the call is the right thing to do.
-func Status(cfg Config) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
+// writeResponse encodes the TwiML response and writes it back to Twilio
+func writeResponse(w http.ResponseWriter, r *http.Request, res *twiml.Response) {
+	b, err := res.Encode()
+	if err != nil {
+		requestLog(r).Error("Unable to encode TwiML response", "error", err)
+		twimlEncodeErrors.Inc()
+		http.Error(w, http.StatusText(502), 502)
+		return
 	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(200)
+	w.Write(b)
 }
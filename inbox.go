@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pressly/chi"
+)
+
+// inboxPage is the data for the voicemail inbox template
+type inboxPage struct {
+	Voicemails []VoicemailRecord
+	Query      string
+	Unread     int
+	// Base is the path the inbox is served from
+	Base string
+}
+
+var inboxFuncs = template.FuncMap{
+	"duration": func(seconds int) string {
+		return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+	},
+	"snippet": func(text string) string {
+		if len(text) <= 120 {
+			return text
+		}
+		cut := strings.LastIndex(text[:120], " ")
+		if cut < 0 {
+			cut = 120
+		}
+		return strings.TrimSpace(text[:cut]) + "..."
+	},
+}
+
+// Inbox returns the router for the web voicemail inbox, which lists the stored voicemails with
+// their transcripts and plays them in the browser.  Voicemails can be searched, marked read or
+// unread, and deleted.
+func Inbox(store VoicemailStore) http.Handler {
+	page, err := Asset("templates/inbox.html")
+	if err != nil {
+		panic(err)
+	}
+	tmpl := template.Must(template.New("inbox").Funcs(inboxFuncs).Parse(string(page)))
+
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		all, err := store.List()
+		if err != nil {
+			requestLog(r).Error("Unable to read voicemails", "error", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		data := inboxPage{
+			Query: strings.TrimSpace(r.URL.Query().Get("q")),
+			Base:  strings.TrimSuffix(r.URL.Path, "/"),
+		}
+		for _, v := range all {
+			if !v.Read {
+				data.Unread++
+			}
+			if matchVoicemail(v, data.Query) {
+				data.Voicemails = append(data.Voicemails, v)
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, data); err != nil {
+			requestLog(r).Error("Unable to render inbox", "error", err)
+		}
+	})
+	r.Get("/:id/audio", func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		v, err := store.Get(id)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		audio, err := store.Audio(id)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		defer audio.Close()
+		w.Header().Set("Content-Type", v.ContentType)
+		if rs, ok := audio.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, v.Audio, v.DownloadedAt, rs)
+			return
+		}
+		io.Copy(w, audio)
+	})
+	r.Post("/:id/read", func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if _, err := store.Get(id); err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		read := r.PostFormValue("read") != "false"
+		if _, err := store.Update(id, func(v *VoicemailRecord) { v.Read = read }); err != nil {
+			requestLog(r).Error("Unable to read voicemails", "error", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		backToInbox(w, r)
+	})
+	r.Post("/:id/delete", func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Delete(chi.URLParam(r, "id")); err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		backToInbox(w, r)
+	})
+	return r
+}
+
+// backToInbox redirects from the URL of a change to a voicemail back to the inbox, keeping the
+// search
+func backToInbox(w http.ResponseWriter, r *http.Request) {
+	to := path.Dir(path.Dir(r.URL.Path))
+	if q := r.PostFormValue("q"); len(q) > 0 {
+		to += "?q=" + url.QueryEscape(q)
+	}
+	http.Redirect(w, r, to, 303)
+}
+
+// matchVoicemail returns true if every word of the search appears in the transcript or the
+// caller's number
+func matchVoicemail(v VoicemailRecord, query string) bool {
+	text := strings.ToLower(v.Transcript + " " + v.From + " " + v.Mailbox)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
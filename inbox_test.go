@@ -0,0 +1,91 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inbox", func() {
+	var dir string
+	var store *FileStore
+	var inbox http.Handler
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "inbox")
+		Expect(err).ToNot(HaveOccurred())
+		store, err = NewFileStore(dir)
+		Expect(err).ToNot(HaveOccurred())
+		received := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		Expect(store.Put(VoicemailRecord{ID: "RE1", From: "+15557654321", Duration: 75, ReceivedAt: received, Transcript: "Please call me back about the invoice"})).To(Succeed())
+		Expect(store.Put(VoicemailRecord{ID: "RE2", From: "+15551112222", ReceivedAt: received.Add(time.Hour), Transcript: "Lunch tomorrow?"})).To(Succeed())
+		_, err = store.PutAudio("RE1", "audio/mpeg", strings.NewReader("ID3 hello"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Update("RE1", func(v *VoicemailRecord) { v.Audio, v.ContentType = "RE1.mp3", "audio/mpeg" })
+		Expect(err).ToNot(HaveOccurred())
+		inbox = Inbox(store)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	request := func(method string, target string, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		inbox.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("lists voicemails newest first", func() {
+		rec := request("GET", "/", "")
+		Expect(rec.Code).To(Equal(200))
+		body := rec.Body.String()
+		Expect(body).To(ContainSubstring("2 unread"))
+		Expect(body).To(ContainSubstring("1:15"))
+		Expect(strings.Index(body, "Lunch tomorrow?")).To(BeNumerically("<", strings.Index(body, "about the invoice")))
+		Expect(body).To(ContainSubstring(`src="/RE1/audio"`))
+	})
+
+	It("searches transcripts", func() {
+		body := request("GET", "/?q=Invoice", "").Body.String()
+		Expect(body).To(ContainSubstring("about the invoice"))
+		Expect(body).ToNot(ContainSubstring("Lunch tomorrow?"))
+	})
+
+	It("plays the audio", func() {
+		rec := request("GET", "/RE1/audio", "")
+		Expect(rec.Code).To(Equal(200))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("audio/mpeg"))
+		Expect(rec.Body.String()).To(Equal("ID3 hello"))
+		Expect(request("GET", "/RE2/audio", "").Code).To(Equal(404))
+	})
+
+	It("marks voicemails read and unread", func() {
+		Expect(request("POST", "/RE1/read", "read=true").Code).To(Equal(303))
+		v, _ := store.Get("RE1")
+		Expect(v.Read).To(BeTrue())
+		Expect(request("POST", "/RE1/read", "read=false").Code).To(Equal(303))
+		v, _ = store.Get("RE1")
+		Expect(v.Read).To(BeFalse())
+		Expect(request("POST", "/RE9/read", "read=true").Code).To(Equal(404))
+	})
+
+	It("deletes voicemails and their audio", func() {
+		Expect(request("POST", "/RE1/delete", "").Code).To(Equal(303))
+		_, err := store.Get("RE1")
+		Expect(err).To(Equal(ErrVoicemailNotFound))
+		_, err = os.Stat(dir + "/RE1.mp3")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
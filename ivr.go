@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BTBurke/twiml"
+)
+
+// Menu is a phone menu, like "press 1 for sales, 2 for support", played to callers before their
+// call is forwarded.  The prompt is read from Say or played from the audio at Play, and each digit
+// in Options is mapped to what happens when the caller presses it.  If the caller presses nothing
+// or a digit that isn't an option, they hear Invalid and the menu repeats up to Retries times,
+// after which the Fallback action is taken.
+type Menu struct {
+	Say      string                `json:"say"`
+	Play     string                `json:"play"`
+	Options  map[string]MenuAction `json:"options"`
+	Retries  int                   `json:"retries"`
+	Timeout  int                   `json:"timeout"`
+	Invalid  string                `json:"invalid"`
+	Fallback *MenuAction           `json:"fallback"`
+}
+
+// MenuAction is what happens when a menu option is chosen, and has exactly one of Dial, to ring
+// the ring group of a profile, Voicemail, to record a message for the mailbox of a profile, or
+// Menu, to go to another menu.  Profiles are named by their virtual number, their name, or
+// "default" for the top level settings.
+type MenuAction struct {
+	Dial      string `json:"dial,omitempty"`
+	Voicemail string `json:"voicemail,omitempty"`
+	Menu      string `json:"menu,omitempty"`
+}
+
+// compile checks the menu and fills in defaults
+func (m *Menu) compile(cfg *Config) (errors []error) {
+	if len(m.Say) == 0 && len(m.Play) == 0 {
+		errors = append(errors, fmt.Errorf("say or play is required"))
+	}
+	if len(m.Options) == 0 {
+		errors = append(errors, fmt.Errorf("options: at least one option is required"))
+	}
+	for _, digit := range m.digits() {
+		if len(digit) != 1 || !strings.Contains("0123456789*#", digit) {
+			errors = append(errors, fmt.Errorf("options: %q is not a key on the phone", digit))
+			continue
+		}
+		if err := m.Options[digit].validate(cfg); err != nil {
+			errors = append(errors, fmt.Errorf("options.%s: %s", digit, err))
+		}
+	}
+	if m.Fallback != nil {
+		if err := m.Fallback.validate(cfg); err != nil {
+			errors = append(errors, fmt.Errorf("fallback: %s", err))
+		}
+	}
+	if m.Retries == 0 {
+		m.Retries = 2
+	}
+	if m.Timeout == 0 {
+		m.Timeout = 5
+	}
+	if m.Retries < 0 {
+		errors = append(errors, fmt.Errorf("retries: must be a positive number"))
+	}
+	if m.Timeout < 0 {
+		errors = append(errors, fmt.Errorf("timeout: must be a positive number of seconds"))
+	}
+	if len(m.Invalid) == 0 {
+		m.Invalid = "Sorry, that is not a valid choice."
+	}
+	return
+}
+
+// digits returns the options of the menu in order
+func (m *Menu) digits() []string {
+	var digits []string
+	for d := range m.Options {
+		digits = append(digits, d)
+	}
+	sort.Strings(digits)
+	return digits
+}
+
+// validate checks that the action has exactly one target and that the target exists
+func (a MenuAction) validate(cfg *Config) error {
+	set := 0
+	for _, target := range []string{a.Dial, a.Voicemail, a.Menu} {
+		if len(target) > 0 {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("must have one of dial, voicemail or menu")
+	}
+	switch {
+	case len(a.Menu) > 0:
+		if _, ok := cfg.Menus[a.Menu]; !ok {
+			return fmt.Errorf("menu %q does not exist", a.Menu)
+		}
+	case len(a.Dial) > 0:
+		if _, ok := cfg.Mailbox(a.Dial); !ok {
+			return fmt.Errorf("profile %q does not exist", a.Dial)
+		}
+	default:
+		if _, ok := cfg.Mailbox(a.Voicemail); !ok {
+			return fmt.Errorf("profile %q does not exist", a.Voicemail)
+		}
+	}
+	return nil
+}
+
+// validateMenus compiles each menu and checks that every menu can be reached from a profile
+func (cfg *Config) validateMenus() (errors []error) {
+	var names []string
+	for name := range cfg.Menus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, err := range cfg.Menus[name].compile(cfg) {
+			errors = append(errors, fmt.Errorf("%s: menus.%s.%s", cfg.File, name, err))
+		}
+	}
+
+	reached := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		m, ok := cfg.Menus[name]
+		if !ok || reached[name] {
+			return
+		}
+		reached[name] = true
+		for _, a := range m.Options {
+			visit(a.Menu)
+		}
+		if m.Fallback != nil {
+			visit(m.Fallback.Menu)
+		}
+	}
+	if len(cfg.Menu) > 0 {
+		if _, ok := cfg.Menus[cfg.Menu]; !ok {
+			errors = append(errors, cfg.invalid("MENU", "menu %q does not exist", cfg.Menu))
+		}
+		visit(cfg.Menu)
+	}
+	for number, p := range cfg.Profiles {
+		if len(p.Menu) == 0 {
+			continue
+		}
+		if _, ok := cfg.Menus[p.Menu]; !ok {
+			errors = append(errors, fmt.Errorf("%s: profiles.%s.menu: menu %q does not exist", cfg.File, number, p.Menu))
+		}
+		visit(p.Menu)
+	}
+	for _, name := range names {
+		if !reached[name] {
+			errors = append(errors, fmt.Errorf("%s: menus.%s: not reachable from any profile", cfg.File, name))
+		}
+	}
+	return
+}
+
+// menuURL returns the URL for the choice made in the menu on the given attempt
+func menuURL(name string, attempt int) string {
+	v := url.Values{}
+	v.Set("menu", name)
+	v.Set("attempt", strconv.Itoa(attempt))
+	return "/call/menu?" + v.Encode()
+}
+
+// menuPrompt returns the TwiML that reads the menu and gathers the caller's choice.  If the
+// caller doesn't press anything, Twilio moves on to the redirect so that the menu can repeat.
+func menuPrompt(name string, m *Menu, attempt int) []twiml.Markup {
+	g := twiml.Gather{
+		Action:    menuURL(name, attempt),
+		NumDigits: 1,
+		Timeout:   m.Timeout,
+	}
+	if len(m.Play) > 0 {
+		g.Add(&twiml.Play{URL: m.Play})
+	} else {
+		g.Add(&twiml.Say{Voice: "woman", Text: m.Say})
+	}
+	return []twiml.Markup{&g, &twiml.Redirect{URL: menuURL(name, attempt)}}
+}
+
+// MenuChoice handles the digit pressed in a menu, repeating the menu when the choice isn't valid
+func MenuChoice(cfg Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ga GatherActionRequest
+		if err := twiml.Bind(&ga, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		name := r.URL.Query().Get("menu")
+		m, ok := cfg.Menus[name]
+		if !ok {
+			http.Error(w, http.StatusText(404), 404)
+			return
+		}
+		attempt, _ := strconv.Atoi(r.URL.Query().Get("attempt"))
+
+		res := twiml.NewResponse()
+		if a, ok := m.Options[ga.Digits]; ok {
+			res.Add(menuAction(&cfg, a, ga.VoiceRequest)...)
+			writeResponse(w, r, res)
+			return
+		}
+		if len(ga.Digits) > 0 {
+			res.Add(&twiml.Say{Voice: "woman", Text: m.Invalid})
+		}
+		if attempt < m.Retries {
+			res.Add(menuPrompt(name, m, attempt+1)...)
+			writeResponse(w, r, res)
+			return
+		}
+		if m.Fallback != nil {
+			res.Add(menuAction(&cfg, *m.Fallback, ga.VoiceRequest)...)
+		} else {
+			res.Add(voicemailPrompt(cfg.Profile(ga.To))...)
+		}
+		writeResponse(w, r, res)
+	}
+}
+
+// menuAction returns the TwiML that carries out a menu action.  Calls dialed to a profile from a
+// menu follow its business hours.
+func menuAction(cfg *Config, a MenuAction, call twiml.VoiceRequest) []twiml.Markup {
+	switch {
+	case len(a.Menu) > 0:
+		return menuPrompt(a.Menu, cfg.Menus[a.Menu], 0)
+	case len(a.Dial) > 0:
+		p, _ := cfg.Mailbox(a.Dial)
+		if p.Schedule != nil && !p.Schedule.Open(cfg.now()) {
+			return afterHours(p, call.To)
+		}
+		return []twiml.Markup{dialProfile(*cfg, p, call)}
+	default:
+		p, _ := cfg.Mailbox(a.Voicemail)
+		return voicemailPrompt(p)
+	}
+}
@@ -0,0 +1,102 @@
+package main_test
+
+import (
+	"net/url"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Menus", func() {
+	var cfg *Config
+
+	BeforeEach(func() {
+		c := testConfig()
+		c.Menu = "main"
+		c.Profiles = map[string]Profile{
+			"+15550001111": {
+				Name:              "sales",
+				ForwardingNumbers: []string{"+15551111111"},
+			},
+		}
+		c.Menus = map[string]*Menu{
+			"main": {
+				Say: "Press 1 for sales, 2 for support",
+				Options: map[string]MenuAction{
+					"1": {Dial: "sales"},
+					"2": {Menu: "support"},
+				},
+			},
+			"support": {
+				Say: "Press 1 to leave a message",
+				Options: map[string]MenuAction{
+					"1": {Voicemail: "default"},
+					"9": {Menu: "main"},
+				},
+			},
+		}
+		cfg = &c
+	})
+
+	It("fills in defaults", func() {
+		Expect(cfg.Validate()).To(BeEmpty())
+		Expect(cfg.Menus["main"].Retries).To(Equal(2))
+		Expect(cfg.Menus["main"].Timeout).To(Equal(5))
+		Expect(cfg.Menus["main"].Invalid).ToNot(BeEmpty())
+	})
+
+	DescribeTable("menu graph errors",
+		func(change func(cfg *Config), expected string) {
+			change(cfg)
+			Expect(cfg.Validate()).To(ContainElement(MatchError(MatchRegexp(expected))))
+		},
+		Entry("missing prompt", func(cfg *Config) { cfg.Menus["main"].Say = "" }, "menus.main.say or play is required"),
+		Entry("dangling menu", func(cfg *Config) {
+			cfg.Menus["main"].Options["3"] = MenuAction{Menu: "billing"}
+		}, `menus.main.options.3: menu "billing" does not exist`),
+		Entry("dangling profile", func(cfg *Config) {
+			cfg.Menus["main"].Options["3"] = MenuAction{Dial: "billing"}
+		}, `menus.main.options.3: profile "billing" does not exist`),
+		Entry("two targets", func(cfg *Config) {
+			cfg.Menus["main"].Options["3"] = MenuAction{Dial: "sales", Menu: "support"}
+		}, "menus.main.options.3: must have one of"),
+		Entry("not a key", func(cfg *Config) {
+			cfg.Menus["main"].Options["10"] = MenuAction{Dial: "sales"}
+		}, `menus.main.options: "10" is not a key`),
+		Entry("unreachable menu", func(cfg *Config) {
+			cfg.Menus["orphan"] = &Menu{Say: "Hello", Options: map[string]MenuAction{"1": {Dial: "sales"}}}
+		}, "menus.orphan: not reachable"),
+		Entry("unknown entry menu", func(cfg *Config) { cfg.Menu = "start" }, `menu "start" does not exist`),
+	)
+
+	Describe("MenuChoice", func() {
+		choose := func(query string, digits string) string {
+			Expect(cfg.Validate()).To(BeEmpty())
+			form := url.Values{"CallSid": {"CA123"}, "From": {"+15557654321"}, "To": {"+15550009999"}, "Digits": {digits}}
+			return postForm(MenuChoice(*cfg), "/call/menu?"+query, form)
+		}
+
+		It("dials the profile for the option", func() {
+			Expect(choose("menu=main&attempt=0", "1")).To(ContainSubstring("+15551111111"))
+		})
+
+		It("goes to a submenu", func() {
+			Expect(choose("menu=main&attempt=0", "2")).To(ContainSubstring("Press 1 to leave a message"))
+		})
+
+		It("repeats the menu after an invalid choice", func() {
+			res := choose("menu=main&attempt=0", "7")
+			Expect(res).To(ContainSubstring("not a valid choice"))
+			Expect(res).To(ContainSubstring("attempt=1"))
+		})
+
+		It("falls back to voicemail after the retries", func() {
+			res := choose("menu=main&attempt=2", "")
+			Expect(res).To(ContainSubstring("<Record"))
+			Expect(res).ToNot(ContainSubstring("Press 1"))
+		})
+	})
+})
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pressly/chi/middleware"
+)
+
+// Log formats
+const (
+	LogLogfmt = "logfmt"
+	LogJSON   = "json"
+)
+
+// Log levels, from the most to the least verbose
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var logLevels = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3}
+
+// redactedNumbers are the fields holding phone numbers, which are masked when redacting
+var redactedNumbers = map[string]bool{
+	"from":    true,
+	"to":      true,
+	"number":  true,
+	"numbers": true,
+	"pattern": true,
+	"caller":  true,
+}
+
+// redactedText are the fields holding what callers said or wrote, which are left out when
+// redacting
+var redactedText = map[string]bool{
+	"transcript": true,
+	"body":       true,
+	"subject":    true,
+	"text":       true,
+}
+
+// logger is the logger of the server, replaced with one configured from the config at startup
+var logger = NewLogger(os.Stderr, Config{})
+
+// Logger writes structured log lines as logfmt or JSON.  Each line has the time, level and
+// message followed by the fields of the logger and those of the line, given as alternating
+// keys and values.
+type Logger struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	format string
+	level  int
+	redact bool
+	fields []interface{}
+	now    func() time.Time
+}
+
+// NewLogger returns a logger writing to out with the log format, level and redaction of the
+// config, which must have been validated
+func NewLogger(out io.Writer, cfg Config) *Logger {
+	format := cfg.LogFormat
+	if len(format) == 0 {
+		format = LogLogfmt
+	}
+	level, ok := logLevels[cfg.LogLevel]
+	if !ok {
+		level = logLevels[LevelInfo]
+	}
+	return &Logger{
+		out:    out,
+		mu:     new(sync.Mutex),
+		format: format,
+		level:  level,
+		redact: cfg.LogRedact,
+		now:    cfg.now,
+	}
+}
+
+// With returns a logger that adds the fields to every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	with := *l
+	with.fields = append(append([]interface{}(nil), l.fields...), kv...)
+	return &with
+}
+
+// Debug logs detail that is only useful while troubleshooting
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+// Info logs the normal progress of calls and messages
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+// Warn logs something unexpected that the server recovered from
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+// Error logs a failure that lost a call, message or notification
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+// Fatal logs an error that the server can't run with, and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level string, msg string, kv []interface{}) {
+	if logLevels[level] < l.level {
+		return
+	}
+	fields := []interface{}{"time", l.now().UTC().Format(time.RFC3339), "level", level, "msg", msg}
+	fields = append(append(fields, l.fields...), kv...)
+
+	buf := new(bytes.Buffer)
+	if l.format == LogJSON {
+		buf.WriteByte('{')
+	}
+	first := true
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		if l.redact && redactedText[key] {
+			continue
+		}
+		value = logValue(value)
+		if l.redact && redactedNumbers[key] {
+			value = maskNumbers(value)
+		}
+		if !first {
+			if l.format == LogJSON {
+				buf.WriteByte(',')
+			} else {
+				buf.WriteByte(' ')
+			}
+		}
+		first = false
+		if l.format == LogJSON {
+			k, _ := json.Marshal(key)
+			v, err := json.Marshal(value)
+			if err != nil {
+				v, _ = json.Marshal(fmt.Sprint(value))
+			}
+			fmt.Fprintf(buf, "%s:%s", k, v)
+		} else {
+			fmt.Fprintf(buf, "%s=%s", key, logfmtValue(value))
+		}
+	}
+	if l.format == LogJSON {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// logValue converts values that don't log well as they are, like errors, to strings
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// logfmtValue formats a value for logfmt, quoting it if it has spaces or special characters
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case []string:
+		s = strings.Join(v, ",")
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) == 0 || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// maskNumbers masks all but the last four digits of a phone number, or of each number in a list
+func maskNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return maskNumber(v)
+	case []string:
+		masked := make([]string, len(v))
+		for i, number := range v {
+			masked[i] = maskNumber(number)
+		}
+		return masked
+	}
+	return v
+}
+
+func maskNumber(number string) string {
+	keep := 4
+	out := []rune(number)
+	for i := len(out) - 1; i >= 0; i-- {
+		if !unicode.IsDigit(out[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		out[i] = '*'
+	}
+	return string(out)
+}
+
+// LogRequests is middleware that logs each request once it has been answered, and gives the
+// handlers a logger that adds the request ID to their log lines.  It replaces chi's Logger.
+func LogRequests(l *Logger) func(http.Handler) http.Handler {
+	return middleware.RequestLogger(&requestLogFormatter{l})
+}
+
+// LogCalls is middleware for the Twilio webhooks that adds the route, the call or message and
+// the profile it was routed to to the log lines of the request.  It must be used inside the
+// router, once the route is known, and after LogRequests.
+func LogCalls(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if entry, ok := middleware.GetLogEntry(r).(*requestLogEntry); ok {
+				fields := []interface{}{"route", routePattern(r)}
+				if sid := r.PostFormValue("CallSid"); len(sid) > 0 {
+					fields = append(fields, "call_sid", sid)
+				}
+				if sid := r.PostFormValue("MessageSid"); len(sid) > 0 {
+					fields = append(fields, "message_sid", sid)
+				}
+				fields = append(fields, "profile", cfg.requestProfile(r, r.PostFormValue("To")).Name)
+				entry.log = entry.log.With(fields...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestLog returns the logger for the request, which carries the request ID and, for
+// webhooks, the call it is about
+func requestLog(r *http.Request) *Logger {
+	if entry, ok := middleware.GetLogEntry(r).(*requestLogEntry); ok {
+		return entry.log
+	}
+	return logger
+}
+
+type requestLogFormatter struct {
+	log *Logger
+}
+
+func (f *requestLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	return &requestLogEntry{
+		log:    f.log.With("request_id", middleware.GetReqID(r.Context())),
+		method: r.Method,
+		path:   r.URL.Path,
+	}
+}
+
+// requestLogEntry is the log of a request
+type requestLogEntry struct {
+	log    *Logger
+	method string
+	path   string
+}
+
+func (e *requestLogEntry) Write(status int, bytes int, elapsed time.Duration) {
+	log := e.log.Info
+	if status >= 500 {
+		log = e.log.Error
+	}
+	log("Request handled", "method", e.method, "path", e.path, "status", status, "bytes", bytes, "elapsed", elapsed)
+}
+
+func (e *requestLogEntry) Panic(v interface{}, stack []byte) {
+	e.log.Error("Request panicked", "method", e.method, "path", e.path, "panic", fmt.Sprint(v), "stack", string(stack))
+}
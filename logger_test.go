@@ -0,0 +1,147 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var out *bytes.Buffer
+	var cfg Config
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+		cfg = testConfig()
+		cfg.Now = func() time.Time { return time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC) }
+	})
+
+	// lines decodes the JSON log lines written so far
+	lines := func() []map[string]interface{} {
+		var decoded []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var fields map[string]interface{}
+			Expect(json.Unmarshal([]byte(line), &fields)).To(Succeed(), line)
+			decoded = append(decoded, fields)
+		}
+		return decoded
+	}
+
+	It("writes logfmt lines with the fields of the logger", func() {
+		Expect(cfg.Validate()).To(BeEmpty())
+		l := NewLogger(out, cfg).With("call_sid", "CA123")
+		l.Info("Blocked call", "from", "+15557654321", "error", errors.New("no such number"), "wait", 2*time.Second)
+		Expect(out.String()).To(Equal(`time=2017-12-20T09:30:00Z level=info msg="Blocked call" call_sid=CA123 from=+15557654321 error="no such number" wait=2s` + "\n"))
+	})
+
+	It("writes JSON lines and leaves out levels below the one configured", func() {
+		cfg.LogFormat, cfg.LogLevel = LogJSON, LevelWarn
+		Expect(cfg.Validate()).To(BeEmpty())
+		l := NewLogger(out, cfg)
+		l.Debug("Detail")
+		l.Info("Progress")
+		l.Warn("Retrying notification", "attempts", 2, "channels", []string{"smtp", "sms"})
+		Expect(lines()).To(Equal([]map[string]interface{}{{
+			"time":     "2017-12-20T09:30:00Z",
+			"level":    "warn",
+			"msg":      "Retrying notification",
+			"attempts": 2.0,
+			"channels": []interface{}{"smtp", "sms"},
+		}}))
+	})
+
+	It("masks phone numbers and leaves out what callers said when redacting", func() {
+		cfg.LogRedact = true
+		Expect(cfg.Validate()).To(BeEmpty())
+		l := NewLogger(out, cfg)
+		l.Info("Forwarding message", "from", "+1 (555) 765-4321", "numbers", []string{"+15550001111"}, "body", "Running late", "transcript", "Call me", "from_city", "PORTLAND")
+		Expect(out.String()).To(Equal(`time=2017-12-20T09:30:00Z level=info msg="Forwarding message" from="+* (***) ***-4321" numbers=+*******1111 from_city=PORTLAND` + "\n"))
+	})
+
+	It("rejects unknown formats and levels", func() {
+		cfg.LogFormat, cfg.LogLevel = "xml", "verbose"
+		Expect(cfg.Validate()).To(ConsistOf(
+			MatchError(ContainSubstring("LOG_FORMAT")),
+			MatchError(ContainSubstring("LOG_LEVEL")),
+		))
+	})
+
+	It("adds the request, call, route and profile to the log lines of webhooks", func() {
+		cfg.LogFormat, cfg.LogRedact = LogJSON, true
+		cfg.Profiles = map[string]Profile{"+15550001111": {Name: "sales"}}
+		Expect(cfg.Validate()).To(BeEmpty())
+		dir, err := ioutil.TempDir("", "logger")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		calls, err := OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		defer calls.Close()
+		store, err := NewFileStore(filepath.Join(dir, "voicemails"))
+		Expect(err).ToNot(HaveOccurred())
+		outbox, err := NewOutbox(cfg, filepath.Join(dir, "outbox"))
+		Expect(err).ToNot(HaveOccurred())
+
+		r := chi.NewRouter()
+		r.Use(middleware.RequestID)
+		r.Use(LogRequests(NewLogger(out, cfg)))
+		r.Group(func(r chi.Router) {
+			r.Use(LogCalls(cfg))
+			r.Post("/voicemail", Voicemail(cfg, NewArchiver(cfg, store), calls, outbox))
+		})
+		form := url.Values{
+			"CallSid":             {"CA123"},
+			"RecordingSid":        {"RE123"},
+			"From":                {"+15557654321"},
+			"To":                  {"+15550001111"},
+			"TranscriptionStatus": {"completed"},
+			"TranscriptionText":   {"Call me back about the invoice"},
+		}
+		postForm(r.ServeHTTP, "/voicemail", form)
+
+		logged := lines()
+		Expect(logged).To(HaveLen(2))
+		Expect(logged[0]["msg"]).To(Equal("Voicemail transcribed"))
+		Expect(logged[1]["msg"]).To(Equal("Request handled"))
+		Expect(logged[1]["status"]).To(Equal(200.0))
+		Expect(logged[0]["request_id"]).ToNot(BeEmpty())
+		for _, fields := range logged {
+			Expect(fields["request_id"]).To(Equal(logged[0]["request_id"]))
+			Expect(fields["call_sid"]).To(Equal("CA123"))
+			Expect(fields["route"]).To(Equal("/voicemail"))
+			Expect(fields["profile"]).To(Equal("sales"))
+		}
+		Expect(logged[0]["from"]).To(Equal("+*******4321"))
+		Expect(logged[0]).ToNot(HaveKey("transcript"))
+		Expect(out.String()).ToNot(ContainSubstring("invoice"))
+	})
+
+	It("logs the length of what callers said rather than the words when not redacting", func() {
+		cfg.LogFormat = LogJSON
+		f := newFixture(cfg)
+		defer f.close()
+		outbox, err := NewOutbox(f.cfg, filepath.Join(f.dir, "outbox"))
+		Expect(err).ToNot(HaveOccurred())
+		r := chi.NewRouter()
+		r.Use(LogRequests(NewLogger(out, f.cfg)))
+		r.Post("/sms", Message(f.cfg, NewCorrespondents(), outbox))
+		postForm(r.ServeHTTP, "/sms", url.Values{"MessageSid": {"SM123"}, "From": {"+15557654321"}, "To": {"+15550001111"}, "Body": {"Running late"}})
+
+		logged := lines()
+		Expect(logged[0]["msg"]).To(Equal("Forwarding message"))
+		Expect(logged[0]["body_length"]).To(Equal(12.0))
+		Expect(out.String()).ToNot(ContainSubstring("Running late"))
+	})
+})
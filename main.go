@@ -1,54 +1,108 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/pressly/chi"
-	"github.com/pressly/chi/middleware"
 )
 
 var cfg Config
 
-func init() {
-	cfg = Config{
-		MailgunPublicKey:  os.Getenv("MAILGUN_PUBLIC_KEY"),
-		MailgunSecretKey:  os.Getenv("MAILGUN_SECRET_KEY"),
-		MailgunDomain:     os.Getenv("MAILGUN_DOMAIN"),
-		NotificationEmail: os.Getenv("NOTIFICATION_EMAIL"),
-		ForwardingNumber:  os.Getenv("FORWARDING_NUMBER"),
-		VoicemailScript:   os.Getenv("VOICEMAIL_SCRIPT"),
-		VoicemailFile:     os.Getenv("VOICEMAIL_FILE"),
+func main() {
+	configFile := flag.String("config", os.Getenv("TWILIO_VOICE_CONFIG"), "path to a JSON config file, environment variables override its settings")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
 	}
-}
+	flag.Parse()
 
-func main() {
+	var err error
+	if cfg, err = LoadConfig(*configFile, os.Getenv); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if flag.NArg() > 0 {
+		if err := runCommand(os.Stdout, cfg, flag.Args()); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
 	if errs := cfg.Validate(); len(errs) > 0 {
 		log.Fatalf("%v", errs)
 	}
+	logger = NewLogger(os.Stderr, cfg)
 
-	log.Printf("Forwarding calls to %s\n", cfg.ForwardingNumber)
-	log.Printf("Voicemail notifications will be sent to %s\n", cfg.NotificationEmail)
+	logger.Info("Forwarding calls", "number", cfg.ForwardingNumber)
+	if len(cfg.NotificationEmail) > 0 {
+		logger.Info("Voicemail notifications will be sent", "email", cfg.NotificationEmail)
+	}
+	for number, p := range cfg.Profiles {
+		logger.Info("Forwarding calls", "profile", p.Name, "to", number, "numbers", p.ForwardingNumbers)
+	}
+	if len(cfg.OutboundPIN) > 0 {
+		logger.Info("Outbound calling is enabled, call your virtual number from your forwarding number to dial out")
+	}
+	if cfg.SignatureMode == SignatureLogOnly {
+		logger.Warn("Twilio signature verification is in log-only mode, invalid requests will not be rejected")
+	}
 
-	r := chi.NewRouter()
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.CloseNotify)
-	r.Use(middleware.Timeout(10 * time.Second))
+	app, err := NewApp(cfg)
+	if err != nil {
+		logger.Fatal("Unable to start", "error", err)
+	}
+	app.Start()
+
+	server, err := NewServer(cfg, app.Handler())
+	if err != nil {
+		logger.Fatal("Unable to start", "error", err)
+	}
+	failed := make(chan error, 2)
+	go func() { failed <- server.ListenAndServe() }()
+	var admin *http.Server
+	if len(cfg.AdminAddr) > 0 {
+		router := chi.NewRouter()
+		router.Get("/metrics", MetricsHandler())
+		admin = &http.Server{Addr: cfg.AdminAddr, Handler: router}
+		go func() {
+			logger.Info("Serving metrics", "addr", cfg.AdminAddr)
+			if err := admin.ListenAndServe(); err != http.ErrServerClosed {
+				failed <- err
+			}
+		}()
+	}
 
-	r.Post("/call/", CallRequest(cfg))
-	r.Post("/call/action/", DialAction(cfg))
-	r.Post("/voicemail", Voicemail(cfg))
-	r.Post("/status", Status(cfg))
-	if cfg.EnableCustomPrompt {
-		log.Printf("Serving custom voicemail prompt from %s\n", cfg.VoicemailFile)
-		r.FileServer("/prompt", http.Dir(cfg.ServeDirectory))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-failed:
+		logger.Fatal("Listener failed", "error", err)
+	case sig := <-signals:
+		logger.Info("Shutting down, waiting for requests in progress", "signal", sig)
 	}
+	if err := server.Shutdown(); err != nil {
+		logger.Error("Requests were still in progress when the server stopped", "error", err)
+	}
+	if admin != nil {
+		admin.Close()
+	}
+	// the webhooks are finished, so nothing more will be queued or archived
+	app.Stop()
+	logger.Info("Stopped")
+}
 
-	log.Println("Listening on 127.0.0.1:8080")
-	http.ListenAndServe(":8080", r)
+// splitList splits a comma separated environment variable into its values
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
 }
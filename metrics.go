@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pressly/chi"
+)
+
+// metrics are the counters and histograms served on the admin listener
+var metrics = NewMetrics()
+
+var (
+	callsTotal = metrics.Counter("twilio_voice_calls_total",
+		"Calls that have ended, by called number and final call status", "to", "status")
+	dialOutcomes = metrics.Counter("twilio_voice_dial_outcomes_total",
+		"Outcomes of forwarding calls, by dial call status", "status")
+	voicemailsTotal = metrics.Counter("twilio_voice_voicemails_total",
+		"Voicemails recorded, by mailbox", "mailbox")
+	transcriptionLength = metrics.Histogram("twilio_voice_transcription_length_characters",
+		"Length of voicemail transcriptions in characters", []float64{0, 25, 50, 100, 250, 500, 1000})
+	notificationsTotal = metrics.Counter("twilio_voice_notifications_total",
+		"Notifications sent, by channel and result", "channel", "result")
+	requestDuration = metrics.Histogram("twilio_voice_request_duration_seconds",
+		"Time taken to handle webhooks and other requests, by route", []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "route")
+	twimlEncodeErrors = metrics.Counter("twilio_voice_twiml_encode_errors_total",
+		"TwiML responses that could not be encoded")
+)
+
+// Metrics collects counters and histograms and writes them in the Prometheus text format
+type Metrics struct {
+	mu       sync.Mutex
+	families []*metricFamily
+}
+
+// NewMetrics returns a collection with no metrics
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// metricFamily is a metric and its value for each combination of labels
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+// metricSeries is the value of a metric for one combination of labels.  Counters only use count.
+type metricSeries struct {
+	labels  []string
+	count   float64
+	sum     float64
+	buckets []uint64
+}
+
+// CounterVec is a counter with a value for each combination of its labels
+type CounterVec struct {
+	m *Metrics
+	f *metricFamily
+}
+
+// HistogramVec is a histogram with a distribution for each combination of its labels
+type HistogramVec struct {
+	m *Metrics
+	f *metricFamily
+}
+
+// Counter adds a counter to the collection
+func (m *Metrics) Counter(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{m: m, f: m.add(name, help, "counter", labels, nil)}
+}
+
+// Histogram adds a histogram with the given upper bounds for its buckets to the collection
+func (m *Metrics) Histogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{m: m, f: m.add(name, help, "histogram", labels, buckets)}
+}
+
+func (m *Metrics) add(name string, help string, kind string, labels []string, buckets []float64) *metricFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	m.families = append(m.families, f)
+	return f
+}
+
+// Inc adds one to the counter for the label values, given in the order of the labels
+func (c *CounterVec) Inc(values ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.f.get(values).count++
+}
+
+// Observe adds a value to the histogram for the label values, given in the order of the labels
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	s := h.f.get(values)
+	s.count++
+	s.sum += v
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+}
+
+// get returns the series for the label values, creating it the first time they are seen
+func (f *metricFamily) get(values []string) *metricSeries {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("%s has labels %v but was given %d values", f.name, f.labels, len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: values, buckets: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b bytes.Buffer
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind == "counter" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, labelPairs(f.labels, s.labels, ""), formatFloat(s.count))
+				continue
+			}
+			for i, upper := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.labels, formatFloat(upper)), s.buckets[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %s\n", f.name, labelPairs(f.labels, s.labels, "+Inf"), formatFloat(s.count))
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, labelPairs(f.labels, s.labels, ""), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %s\n", f.name, labelPairs(f.labels, s.labels, ""), formatFloat(s.count))
+		}
+	}
+	return b.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelPairs formats the labels of a series, adding the le label of a histogram bucket if it
+// is given
+func labelPairs(names []string, values []string, le string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i])))
+	}
+	if len(le) > 0 {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// MetricsHandler serves the metrics of the server for Prometheus to scrape
+func MetricsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WriteTo(w)
+	}
+}
+
+// InstrumentRoutes is middleware that records how long each request takes by the route that
+// handled it, so that calls with different parameters are counted together
+func InstrumentRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		requestDuration.Observe(time.Since(start).Seconds(), routePattern(r))
+	})
+}
+
+// routePattern returns the pattern of the route that handled the request, joining the patterns
+// of mounted routers, or "unmatched" for requests that didn't match a route
+func routePattern(r *http.Request) string {
+	rctx, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return "unmatched"
+	}
+	route := strings.Join(rctx.RoutePatterns, "")
+	return strings.Replace(route, "/*/", "/", -1)
+}
@@ -0,0 +1,121 @@
+package main_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+	"github.com/pressly/chi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// scrape returns the value of each series served by the metrics handler
+func scrape() map[string]float64 {
+	rec := httptest.NewRecorder()
+	MetricsHandler()(rec, httptest.NewRequest("GET", "/metrics", nil))
+	Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		Expect(err).ToNot(HaveOccurred())
+		values[line[:i]] = v
+	}
+	return values
+}
+
+var _ = Describe("Metrics", func() {
+	It("writes counters and histograms in the Prometheus text format", func() {
+		m := NewMetrics()
+		c := m.Counter("calls_total", "Calls", "to")
+		h := m.Histogram("length", "Lengths", []float64{10, 100})
+		c.Inc(`+1555"0001111`)
+		c.Inc(`+1555"0001111`)
+		h.Observe(5)
+		h.Observe(50)
+		h.Observe(500)
+
+		var out bytes.Buffer
+		_, err := m.WriteTo(&out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal(`# HELP calls_total Calls
+# TYPE calls_total counter
+calls_total{to="+1555\"0001111"} 2
+# HELP length Lengths
+# TYPE length histogram
+length_bucket{le="10"} 1
+length_bucket{le="100"} 2
+length_bucket{le="+Inf"} 3
+length_sum 555
+length_count 3
+`))
+		Expect(func() { c.Inc() }).To(Panic())
+	})
+
+	It("counts calls, dial outcomes, voicemails and request times by route", func() {
+		f := newFixture(testConfig())
+		defer f.close()
+		cfg, calls := f.cfg, f.calls
+		blocklist, err := OpenBlocklist(cfg, filepath.Join(f.dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+		store, err := NewFileStore(filepath.Join(f.dir, "voicemails"))
+		Expect(err).ToNot(HaveOccurred())
+		outbox, err := NewOutbox(cfg, filepath.Join(f.dir, "outbox"))
+		Expect(err).ToNot(HaveOccurred())
+
+		r := chi.NewRouter()
+		r.Use(InstrumentRoutes)
+		r.Post("/call/", CallRequest(cfg, blocklist, calls))
+		r.Post("/call/action/", DialAction(cfg, NewScreening(cfg), calls))
+		r.Post("/voicemail", Voicemail(cfg, NewArchiver(cfg, store), calls, outbox))
+		r.Post("/status", Status(cfg, NewCallStates(cfg, NewEventBus())))
+		post := func(path string, form url.Values) {
+			postForm(r.ServeHTTP, path, form)
+		}
+
+		before := scrape()
+		form := url.Values{"CallSid": {"CA123"}, "From": {"+15557654321"}, "To": {"+15550009999"}, "CallStatus": {twiml.Ringing}}
+		post("/call/", form)
+		form.Set("DialCallStatus", twiml.Busy)
+		post("/call/action/", form)
+		form.Set("TranscriptionStatus", "completed")
+		form.Set("TranscriptionText", "Call me")
+		post("/voicemail", form)
+		form.Set("CallStatus", twiml.Completed)
+		post("/status", form)
+		post("/status", form)
+
+		after := scrape()
+		Expect(after[`twilio_voice_calls_total{to="+15550009999",status="completed"}`] - before[`twilio_voice_calls_total{to="+15550009999",status="completed"}`]).To(Equal(1.0))
+		Expect(after).ToNot(HaveKey(`twilio_voice_calls_total{to="+15550009999",status="ringing"}`))
+		Expect(after[`twilio_voice_dial_outcomes_total{status="busy"}`] - before[`twilio_voice_dial_outcomes_total{status="busy"}`]).To(Equal(1.0))
+		Expect(after[`twilio_voice_voicemails_total{mailbox="default"}`] - before[`twilio_voice_voicemails_total{mailbox="default"}`]).To(Equal(1.0))
+		Expect(after[`twilio_voice_transcription_length_characters_bucket{le="25"}`] - before[`twilio_voice_transcription_length_characters_bucket{le="25"}`]).To(Equal(1.0))
+		Expect(after[`twilio_voice_request_duration_seconds_count{route="/call/action/"}`] - before[`twilio_voice_request_duration_seconds_count{route="/call/action/"}`]).To(Equal(1.0))
+		Expect(after).To(HaveKey(`twilio_voice_request_duration_seconds_bucket{route="/voicemail",le="+Inf"}`))
+	})
+
+	It("counts notifications by channel and result", func() {
+		before := scrape()
+		err := Notify([]Notifier{&fakeNotifier{name: "metrics-ok"}, &fakeNotifier{name: "metrics-down", err: errors.New("connection refused")}}, Notification{Kind: NotifyMessage})
+		Expect(err).To(HaveOccurred())
+		after := scrape()
+		Expect(after[`twilio_voice_notifications_total{channel="metrics-ok",result="success"}`]).To(Equal(1.0))
+		Expect(after[`twilio_voice_notifications_total{channel="metrics-down",result="failure"}`]).To(Equal(1.0))
+		Expect(before).ToNot(HaveKey(`twilio_voice_notifications_total{channel="metrics-ok",result="success"}`))
+	})
+})
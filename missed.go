@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MissedCalls sends a notification when a call ends without being answered or leaving a
+// voicemail, so callers who hang up during the greeting aren't lost.  Calls shorter than the
+// minimum ring are taken to be pocket dials and ignored.
+type MissedCalls struct {
+	// Wait is how long to wait after a call ends before deciding it was missed, since the
+	// recording of a voicemail can arrive after the call has ended
+	Wait time.Duration
+	// Send sends the notification for a missed call
+	Send func(cfg Config, profile Profile, call CallRecord) error
+
+	cfg   Config
+	calls *CallLog
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	running sync.WaitGroup
+	stopped bool
+}
+
+// NewMissedCalls returns missed call notifications for calls in the call log, queued in the
+// outbox
+func NewMissedCalls(cfg Config, calls *CallLog, outbox *Outbox) *MissedCalls {
+	return &MissedCalls{
+		Wait:   30 * time.Second,
+		Send:   outbox.SendMissedCall,
+		cfg:    cfg,
+		calls:  calls,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// missedRecheckWindow is how long after a call ends it is still checked for a missed call when
+// the server starts, for calls that ended just before it last stopped
+const missedRecheckWindow = 24 * time.Hour
+
+// Start checks the calls in the call log that ended before the server last stopped but weren't
+// checked, so a restart doesn't lose a missed call notification
+func (m *MissedCalls) Start() {
+	if !m.cfg.NotifyMissedCalls {
+		return
+	}
+	now := m.cfg.now()
+	for _, call := range m.calls.Records() {
+		if call.EndedAt.IsZero() || call.MissedChecked || now.Sub(call.EndedAt) > missedRecheckWindow {
+			continue
+		}
+		m.schedule(call.CallSid, call.EndedAt.Add(m.Wait).Sub(now))
+	}
+}
+
+// Stop cancels the checks that are waiting and waits for any that are running.  The cancelled
+// calls aren't marked as checked in the call log, so Start checks them when the server starts
+// again.  It must be called before the call log and outbox are closed.
+func (m *MissedCalls) Stop() {
+	m.mu.Lock()
+	m.stopped = true
+	for callSid, t := range m.timers {
+		t.Stop()
+		delete(m.timers, callSid)
+	}
+	m.mu.Unlock()
+	m.running.Wait()
+}
+
+// schedule checks the call for a missed call after the wait
+func (m *MissedCalls) schedule(callSid string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return
+	}
+	if t, ok := m.timers[callSid]; ok {
+		t.Stop()
+	}
+	m.timers[callSid] = time.AfterFunc(wait, func() {
+		m.mu.Lock()
+		if m.stopped {
+			m.mu.Unlock()
+			return
+		}
+		delete(m.timers, callSid)
+		m.running.Add(1)
+		m.mu.Unlock()
+		defer m.running.Done()
+		m.check(callSid)
+	})
+}
+
+// Subscribe checks each call that ends on the event bus for a missed call.  It must subscribe
+// after the call log so that the outcome of the call has been recorded.
+func (m *MissedCalls) Subscribe(bus *EventBus) {
+	bus.Subscribe(func(e CallEvent) {
+		if !e.Ended() || !m.cfg.NotifyMissedCalls {
+			return
+		}
+		m.schedule(e.Call.CallSid, m.Wait)
+	})
+}
+
+// check sends the notification if the call was missed, and records in the call log that the
+// call was checked once the notification is queued
+func (m *MissedCalls) check(callSid string) {
+	call, ok := m.calls.Record(callSid)
+	if !ok || call.MissedChecked {
+		return
+	}
+	if m.missed(call) {
+		logger.Info("Missed call", "call_sid", call.CallSid, "from", call.From, "profile", call.Profile)
+		if err := m.Send(m.cfg, m.cfg.Profile(call.To), call); err != nil {
+			logger.Error("Unable to queue missed call notification", "call_sid", call.CallSid, "error", err)
+			return
+		}
+	}
+	m.calls.Update(callSid, func(c *CallRecord) { c.MissedChecked = true })
+}
+
+// missed returns true if the call was missed, rather than answered, blocked, sent to voicemail,
+// made by the owner or a pocket dial
+func (m *MissedCalls) missed(call CallRecord) bool {
+	if call.Outcome != OutcomeAbandoned || call.Direction != "inbound" || m.cfg.IsOwner(call.From) {
+		return false
+	}
+	if call.Duration < m.cfg.MissedCallMinRing {
+		logger.Info("Ignoring pocket dial", "call_sid", call.CallSid, "from", call.From, "duration", call.Duration)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MissedCalls", func() {
+	var dir string
+	var calls *CallLog
+	var missed *MissedCalls
+	var mu sync.Mutex
+	var sent []CallRecord
+
+	setup := func(cfg Config) *CallStates {
+		var err error
+		dir, err = ioutil.TempDir("", "missed")
+		Expect(err).ToNot(HaveOccurred())
+		calls, err = OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+
+		mu.Lock()
+		sent = nil
+		mu.Unlock()
+		missed = NewMissedCalls(cfg, calls, nil)
+		missed.Wait = 0
+		missed.Send = func(cfg Config, p Profile, call CallRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, call)
+			return nil
+		}
+		bus := NewEventBus()
+		calls.Subscribe(bus)
+		missed.Subscribe(bus)
+		return NewCallStates(cfg, bus)
+	}
+	notified := func() []CallRecord {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]CallRecord(nil), sent...)
+	}
+
+	AfterEach(func() {
+		calls.Close()
+		os.RemoveAll(dir)
+	})
+
+	DescribeTable("notifications",
+		func(enabled bool, outcome string, duration int, expected int) {
+			cfg := Config{
+				ForwardingNumber:  "+15551234567",
+				NotifyMissedCalls: enabled,
+				MissedCallMinRing: 5,
+				Now:               func() time.Time { return time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC) },
+			}
+			states := setup(cfg)
+			call := twiml.VoiceRequest{CallSid: "CA123", From: "+15557654321", To: "+15550001111", Direction: "inbound", FromCity: "Springfield"}
+			calls.Track(call)
+			if len(outcome) > 0 {
+				calls.Update("CA123", func(c *CallRecord) { c.Outcome = outcome })
+			}
+			call.CallStatus = twiml.Completed
+			Expect(states.Transition(StatusRequest{VoiceRequest: call, CallDuration: duration})).To(Succeed())
+
+			if expected == 0 {
+				Consistently(notified, "50ms").Should(BeEmpty())
+				return
+			}
+			Eventually(notified).Should(HaveLen(expected))
+			Expect(notified()[0].From).To(Equal("+15557654321"))
+			Expect(notified()[0].FromCity).To(Equal("Springfield"))
+		},
+		Entry("hung up without a message", true, "", 20, 1),
+		Entry("pocket dial", true, "", 2, 0),
+		Entry("answered", true, OutcomeAnswered, 20, 0),
+		Entry("left a voicemail", true, OutcomeVoicemail, 20, 0),
+		Entry("blocked", true, OutcomeBlocked, 20, 0),
+		Entry("notifications turned off", false, "", 20, 0),
+	)
+
+	It("checks calls that ended before a restart but weren't checked", func() {
+		now := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		setup(Config{
+			ForwardingNumber:  "+15551234567",
+			NotifyMissedCalls: true,
+			MissedCallMinRing: 5,
+			Now:               func() time.Time { return now },
+		})
+		ended := func(callSid string, endedAt time.Time, checked bool) {
+			calls.Update(callSid, func(c *CallRecord) {
+				c.From, c.To, c.Direction = "+15557654321", "+15550001111", "inbound"
+				c.Outcome, c.Duration, c.EndedAt, c.MissedChecked = OutcomeAbandoned, 20, endedAt, checked
+			})
+		}
+		ended("CA1", now.Add(-10*time.Second), false)
+		ended("CA2", now.Add(-time.Minute), true)
+		ended("CA3", now.Add(-48*time.Hour), false)
+		calls.Track(twiml.VoiceRequest{CallSid: "CA4", From: "+15557654321", Direction: "inbound", CallStatus: twiml.InProgress})
+
+		missed.Start()
+		Eventually(notified).Should(HaveLen(1))
+		Expect(notified()[0].CallSid).To(Equal("CA1"))
+		Eventually(func() bool {
+			call, _ := calls.Record("CA1")
+			return call.MissedChecked
+		}).Should(BeTrue())
+
+		missed.Start()
+		Consistently(notified, "50ms").Should(HaveLen(1))
+	})
+
+	It("leaves the calls still waiting when stopped to be checked on the next start", func() {
+		now := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		cfg := Config{
+			ForwardingNumber:  "+15551234567",
+			NotifyMissedCalls: true,
+			MissedCallMinRing: 5,
+			Now:               func() time.Time { return now },
+		}
+		states := setup(cfg)
+		missed.Wait = time.Hour
+		call := twiml.VoiceRequest{CallSid: "CA123", From: "+15557654321", To: "+15550001111", Direction: "inbound"}
+		calls.Track(call)
+		call.CallStatus = twiml.Completed
+		Expect(states.Transition(StatusRequest{VoiceRequest: call, CallDuration: 20})).To(Succeed())
+
+		missed.Stop()
+		missed.Start()
+		Consistently(notified, "50ms").Should(BeEmpty())
+		record, _ := calls.Record("CA123")
+		Expect(record.MissedChecked).To(BeFalse())
+
+		restarted := NewMissedCalls(cfg, calls, nil)
+		restarted.Wait = 0
+		restarted.Send = missed.Send
+		restarted.Start()
+		Eventually(notified).Should(HaveLen(1))
+		Expect(notified()[0].CallSid).To(Equal("CA123"))
+		restarted.Stop()
+	})
+})
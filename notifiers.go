@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/mailgun/mailgun-go.v1"
+)
+
+// Notifier types
+const (
+	NotifierMailgun = "mailgun"
+	NotifierSMTP    = "smtp"
+	NotifierWebhook = "webhook"
+	NotifierSMS     = "sms"
+	NotifierLog     = "log"
+)
+
+// NotifierConfig configures a notification channel in the notifiers list of the config file.
+// Email channels send to the notification emails of the profile and text channels to its
+// forwarding numbers, unless To is set.
+type NotifierConfig struct {
+	Type string   `json:"type"`
+	Name string   `json:"name"`
+	To   []string `json:"to"`
+
+	// Host, Port, Username, Password, From, Security, Auth and CAFile configure an SMTP server.
+	// Any that are left out are taken from the SMTP_ environment variables.
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	Security string `json:"security"`
+	Auth     string `json:"auth"`
+	CAFile   string `json:"ca_file"`
+
+	// URL is where a webhook posts notifications as JSON, with any extra Headers.  For SMS it
+	// overrides the Twilio API.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// buildNotifiers creates the notification channels in the config.  Without any, notifications
+// are emailed through the SMTP server if one is set, or else through Mailgun.
+func (cfg *Config) buildNotifiers() (errors []error) {
+	configs := cfg.Notifiers
+	if len(configs) == 0 {
+		configs = []NotifierConfig{{Type: NotifierMailgun}}
+		if len(cfg.SMTPHost) > 0 {
+			configs = []NotifierConfig{{Type: NotifierSMTP}}
+		}
+	}
+	cfg.notifiers = nil
+	names := make(map[string]bool)
+	emailProfiles := false
+	for i, nc := range configs {
+		if len(nc.Name) == 0 {
+			nc.Name = nc.Type
+		}
+		if (nc.Type == NotifierMailgun || nc.Type == NotifierSMTP) && len(nc.To) == 0 {
+			emailProfiles = true
+		}
+		if names[nc.Name] {
+			errors = append(errors, fmt.Errorf("%s: notifiers.%d.name: %q is used by another notifier", cfg.File, i, nc.Name))
+			continue
+		}
+		names[nc.Name] = true
+		n, err := newNotifier(cfg, nc)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		cfg.notifiers = append(cfg.notifiers, n)
+	}
+	// email channels without their own recipients send to the default profile's address
+	if emailProfiles && len(cfg.NotificationEmail) == 0 {
+		errors = append(errors, cfg.missing("to receive voicemail notifications by email", "NOTIFICATION_EMAIL"))
+	}
+	return
+}
+
+// newNotifier creates the notifier for a channel in the config
+func newNotifier(cfg *Config, nc NotifierConfig) (Notifier, error) {
+	switch nc.Type {
+	case NotifierMailgun:
+		if (len(cfg.MailgunPublicKey) == 0) || (len(cfg.MailgunSecretKey) == 0) || (len(cfg.MailgunDomain) == 0) {
+			return nil, cfg.missing("to receive voicemail notifications", "MAILGUN_PUBLIC_KEY", "MAILGUN_SECRET_KEY", "MAILGUN_DOMAIN")
+		}
+		return &MailgunNotifier{name: nc.Name, to: nc.To, domain: cfg.MailgunDomain, secretKey: cfg.MailgunSecretKey, publicKey: cfg.MailgunPublicKey}, nil
+	case NotifierSMTP:
+		return newSMTPNotifier(cfg, nc)
+	case NotifierWebhook:
+		if _, err := url.ParseRequestURI(nc.URL); err != nil {
+			return nil, fmt.Errorf("%s: notifiers.%s.url: %q is not a URL", cfg.File, nc.Name, nc.URL)
+		}
+		return &WebhookNotifier{name: nc.Name, url: nc.URL, headers: nc.Headers, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case NotifierSMS:
+		if len(cfg.TwilioAccountSid) == 0 {
+			return nil, cfg.missing("to send notifications by text", "TWILIO_ACCOUNT_SID")
+		}
+		api := nc.URL
+		if len(api) == 0 {
+			api = "https://api.twilio.com"
+		}
+		return &SMSNotifier{name: nc.Name, to: nc.To, api: api, accountSid: cfg.TwilioAccountSid, authToken: cfg.TwilioAuthToken, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case NotifierLog:
+		return &LogNotifier{name: nc.Name}, nil
+	default:
+		return nil, fmt.Errorf("%s: notifiers.%s.type: must be %s, %s, %s, %s or %s", cfg.File, nc.Name, NotifierMailgun, NotifierSMTP, NotifierWebhook, NotifierSMS, NotifierLog)
+	}
+}
+
+// recipients returns the configured recipients of a channel, or the profile's if there are none
+func recipients(configured []string, profile []string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+	return profile
+}
+
+// sender returns the local part of the address notifications of a kind are sent from
+func (n Notification) sender() string {
+	if n.Kind == NotifyMessage {
+		return "messages"
+	}
+	return "voicemail"
+}
+
+// MailgunNotifier emails notifications through Mailgun
+type MailgunNotifier struct {
+	name      string
+	to        []string
+	domain    string
+	secretKey string
+	publicKey string
+}
+
+func (m *MailgunNotifier) Name() string { return m.name }
+
+func (m *MailgunNotifier) Notify(n Notification) error {
+	to := recipients(m.to, n.Emails)
+	if len(to) == 0 {
+		return nil
+	}
+	mg := mailgun.NewMailgun(m.domain, m.secretKey, m.publicKey)
+	message := mailgun.NewMessage(fmt.Sprintf("%s@%s", n.sender(), m.domain), n.Subject, n.Text, to...)
+	if len(n.HTML) > 0 {
+		message.SetHtml(n.HTML)
+	}
+	for _, a := range n.Attachments {
+		message.AddReaderAttachment(a.Name, ioutil.NopCloser(bytes.NewReader(a.Data)))
+	}
+	_, _, err := mg.Send(message)
+	return err
+}
+
+// WebhookNotifier posts notifications as JSON to a URL
+type WebhookNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (wh *WebhookNotifier) Name() string { return wh.name }
+
+func (wh *WebhookNotifier) Notify(n Notification) error {
+	// the recipients and email bodies are only for the other channels
+	n.HTML, n.Emails, n.Numbers, n.Attachments = "", nil, nil, nil
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", wh.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SMSNotifier texts notifications from the virtual number through the Twilio REST API
+type SMSNotifier struct {
+	name       string
+	to         []string
+	api        string
+	accountSid string
+	authToken  string
+	client     *http.Client
+}
+
+func (s *SMSNotifier) Name() string { return s.name }
+
+func (s *SMSNotifier) Notify(n Notification) error {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimSuffix(s.api, "/"), s.accountSid)
+	body := n.Subject
+	if n.Kind == NotifyVoicemail && len(n.Transcript) > 0 {
+		body = fmt.Sprintf("%s: %s", n.Subject, n.Transcript)
+	}
+	for _, to := range recipients(s.to, n.Numbers) {
+		form := url.Values{"From": {n.To}, "To": {to}, "Body": {body}}
+		req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(s.accountSid, s.authToken)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("sending text to %s returned %s", to, resp.Status)
+		}
+	}
+	return nil
+}
+
+// LogNotifier writes notifications to the log
+type LogNotifier struct {
+	name string
+}
+
+func (l *LogNotifier) Name() string { return l.name }
+
+func (l *LogNotifier) Notify(n Notification) error {
+	logger.Info("Notification", "kind", n.Kind, "mailbox", n.Mailbox, "from", n.From, "subject", n.Subject, "text", n.Text)
+	return nil
+}
@@ -2,39 +2,214 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"html/template"
+	"sort"
+	"strings"
+	"sync"
+)
 
-	"github.com/BTBurke/twiml"
-	"gopkg.in/mailgun/mailgun-go.v1"
+// Notification kinds
+const (
+	NotifyVoicemail  = "voicemail"
+	NotifyMessage    = "message"
+	NotifyMissedCall = "missed_call"
 )
 
-func Send(cfg Config, tcb twiml.TranscribeCallbackRequest) error {
-	mg := mailgun.NewMailgun(cfg.MailgunDomain, cfg.MailgunSecretKey, cfg.MailgunPublicKey)
+// Notification is a voicemail, text message or missed call to tell the owner of a profile about
+type Notification struct {
+	Kind         string   `json:"kind"`
+	Mailbox      string   `json:"mailbox"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Subject      string   `json:"subject"`
+	Text         string   `json:"text"`
+	HTML         string   `json:"html,omitempty"`
+	Transcript   string   `json:"transcript,omitempty"`
+	RecordingURL string   `json:"recording_url,omitempty"`
+	VoicemailID  string   `json:"voicemail_id,omitempty"`
+	MediaURLs    []string `json:"media_urls,omitempty"`
+
+	// Emails are the addresses of the profile to email the notification to
+	Emails []string `json:"emails,omitempty"`
+	// Numbers are the phones of the profile to text the notification to
+	Numbers []string `json:"numbers,omitempty"`
+	// Attachments are attached to email notifications
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Notifier sends notifications over one channel, like email or a webhook
+type Notifier interface {
+	// Name identifies the channel in logs and errors
+	Name() string
+	Notify(n Notification) error
+}
+
+// NotifyError reports the channels that failed to send a notification
+type NotifyError map[string]error
 
-	emailTemplate, err := Asset("templates/voicemail.html")
+func (e NotifyError) Error() string {
+	var failed []string
+	for name, err := range e {
+		failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+	}
+	sort.Strings(failed)
+	return strings.Join(failed, "; ")
+}
+
+// Notify sends the notification on every channel at once, so that a slow or failing channel
+// doesn't hold up the others.  The channels that failed are returned as a NotifyError.
+func Notify(notifiers []Notifier, n Notification) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(NotifyError)
+	for _, notifier := range notifiers {
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+			if err := notifier.Notify(n); err != nil {
+				logger.Error("Unable to send notification", "kind", n.Kind, "notifier", notifier.Name(), "error", err)
+				notificationsTotal.Inc(notifier.Name(), "failure")
+				mu.Lock()
+				failed[notifier.Name()] = err
+				mu.Unlock()
+				return
+			}
+			notificationsTotal.Inc(notifier.Name(), "success")
+		}(notifier)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// notification starts a notification to the owner of the profile
+func notification(kind string, profile Profile) Notification {
+	return Notification{
+		Kind:    kind,
+		Mailbox: profile.Name,
+		Emails:  profile.NotificationEmails,
+		Numbers: profile.ForwardingNumbers,
+	}
+}
+
+// Send notifies the owner of the profile about a voicemail with its transcription and a link to
+// the recording.  The call record fills in what is known about the caller.
+func Send(cfg Config, profile Profile, v VoicemailRecord, call CallRecord) error {
+	n, err := VoicemailNotification(cfg, profile, v, call)
 	if err != nil {
 		return err
 	}
-	tmpl, err := template.New("email").Parse(string(emailTemplate))
+	return deliver(cfg, cfg.notifiers, n)
+}
+
+// SendMessage notifies the owner of the profile about an SMS, with links to any MMS media
+func SendMessage(cfg Config, profile Profile, msg MessageRequest) error {
+	n, err := MessageNotification(cfg, profile, msg)
 	if err != nil {
 		return err
 	}
-	buf := new(bytes.Buffer)
-	if err := tmpl.Execute(buf, tcb); err != nil {
+	return deliver(cfg, cfg.notifiers, n)
+}
+
+// SendMissedCall notifies the owner of the profile about a call that ended without being
+// answered or leaving a voicemail, with the caller ID and location
+func SendMissedCall(cfg Config, profile Profile, call CallRecord) error {
+	n, err := MissedCallNotification(cfg, profile, call)
+	if err != nil {
 		return err
 	}
+	return deliver(cfg, cfg.notifiers, n)
+}
+
+// VoicemailNotification builds the notification for a voicemail from the profile's templates
+func VoicemailNotification(cfg Config, profile Profile, v VoicemailRecord, call CallRecord) (Notification, error) {
+	at := v.ReceivedAt
+	if at.IsZero() {
+		at = cfg.now()
+	}
+	data := templateData(NotifyVoicemail, profile, at)
+	data.caller(v.From, call.CallerName, call.FromCity, call.FromState, call.FromZip, call.FromCountry)
+	data.To, data.Duration = v.To, v.Duration
+	data.Transcript, data.RecordingURL = v.Transcript, v.RecordingURL
 
-	message := mailgun.NewMessage(
-		fmt.Sprintf("voicemail@%s", cfg.MailgunDomain),
-		fmt.Sprintf("New voicemail from %s", tcb.From),
-		fmt.Sprintf("You have received a new voicemail from %s\n\nTranscript:\n%s\n\nVoicemail Link: %s\n", tcb.From, tcb.TranscriptionText, tcb.RecordingURL),
-		cfg.NotificationEmail,
-	)
-	message.SetHtml(buf.String())
-	if _, _, err := mg.Send(message); err != nil {
-		return err
+	n := notification(NotifyVoicemail, profile)
+	n.From, n.To = v.From, v.To
+	n.Transcript, n.RecordingURL, n.VoicemailID = v.Transcript, v.RecordingURL, v.ID
+	return n, profile.notificationTemplates().render(&n, data)
+}
+
+// MessageNotification builds the notification for an SMS from the profile's templates
+func MessageNotification(cfg Config, profile Profile, msg MessageRequest) (Notification, error) {
+	data := templateData(NotifyMessage, profile, cfg.now())
+	data.caller(msg.From, "", msg.FromCity, msg.FromState, msg.FromZip, msg.FromCountry)
+	data.To, data.Body, data.MediaURLs = msg.To, msg.Body, msg.MediaURLs
+
+	n := notification(NotifyMessage, profile)
+	n.From, n.To = msg.From, msg.To
+	n.MediaURLs = msg.MediaURLs
+	return n, profile.notificationTemplates().render(&n, data)
+}
+
+// MissedCallNotification builds the notification for a missed call from the profile's templates
+func MissedCallNotification(cfg Config, profile Profile, call CallRecord) (Notification, error) {
+	data := templateData(NotifyMissedCall, profile, call.StartedAt)
+	data.caller(call.From, call.CallerName, call.FromCity, call.FromState, call.FromZip, call.FromCountry)
+	data.To, data.Duration = call.To, call.Duration
+
+	n := notification(NotifyMissedCall, profile)
+	n.From, n.To = call.From, call.To
+	return n, profile.notificationTemplates().render(&n, data)
+}
+
+// deliver sends the notification on the channels, first attaching the recording of a voicemail
+// if that is turned on
+func deliver(cfg Config, notifiers []Notifier, n Notification) error {
+	if needsRecording(cfg, notifiers, n) {
+		attachRecording(cfg, nil, &n)
 	}
-	return nil
+	return Notify(notifiers, n)
+}
+
+// needsRecording returns true if the recording of a voicemail should be downloaded and attached
+// before it is sent on the channels.  Only email channels can carry it.
+func needsRecording(cfg Config, notifiers []Notifier, n Notification) bool {
+	if n.Kind != NotifyVoicemail || !cfg.AttachAudio || len(n.RecordingURL) == 0 || len(n.Attachments) > 0 {
+		return false
+	}
+	for _, notifier := range notifiers {
+		switch notifier.(type) {
+		case *MailgunNotifier, *SMTPNotifier:
+			return true
+		}
+	}
+	return false
+}
+
+// attachRecording attaches the recording of a voicemail to the notification, from the audio the
+// archiver saved in the store if it has been downloaded already, or else from Twilio.  Without
+// the attachment, the link in the notification is still there to listen to it.
+func attachRecording(cfg Config, store VoicemailStore, n *Notification) {
+	a, archived, err := archivedAttachment(cfg, store, *n)
+	if !archived {
+		a, err = recordingAttachment(cfg, voicemailName(n.From), n.RecordingURL)
+	}
+	switch {
+	case err != nil:
+		logger.Warn("Unable to attach voicemail", "recording_url", n.RecordingURL, "error", err)
+	case a == nil:
+		logger.Warn("Voicemail is too large to attach", "recording_url", n.RecordingURL)
+	default:
+		n.Attachments = append(n.Attachments, *a)
+	}
+}
+
+// voicemailName returns the file name of an attached voicemail from the caller, without the
+// extension
+func voicemailName(from string) string {
+	if len(digitsOnly(from)) == 0 {
+		return "voicemail"
+	}
+	return "voicemail-" + digitsOnly(from)
 }
@@ -0,0 +1,133 @@
+package main_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeNotifier struct {
+	name string
+	err  error
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Notify(n Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, n)
+	return f.err
+}
+
+var _ = Describe("Notify", func() {
+	It("sends on every channel when one fails", func() {
+		broken := &fakeNotifier{name: "broken", err: errors.New("connection refused")}
+		working := &fakeNotifier{name: "working"}
+		err := Notify([]Notifier{broken, working}, Notification{Kind: NotifyVoicemail, Subject: "New voicemail"})
+
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(BeAssignableToTypeOf(NotifyError{}))
+		Expect(err.(NotifyError)).To(HaveKey("broken"))
+		Expect(err.(NotifyError)).ToNot(HaveKey("working"))
+		Expect(err.Error()).To(Equal("broken: connection refused"))
+		Expect(broken.sent).To(HaveLen(1))
+		Expect(working.sent).To(HaveLen(1))
+	})
+
+	It("returns nil when every channel succeeds", func() {
+		Expect(Notify([]Notifier{&fakeNotifier{name: "log"}}, Notification{})).To(Succeed())
+	})
+})
+
+var _ = Describe("Notifiers", func() {
+	var cfg *Config
+
+	BeforeEach(func() {
+		c := testConfig()
+		c.Notifiers = nil
+		c.TwilioAccountSid = "AC123"
+		cfg = &c
+	})
+
+	It("requires Mailgun keys only when emailing through Mailgun", func() {
+		Expect(cfg.Validate()).To(ContainElement(MatchError(MatchRegexp("set.*MAILGUN_PUBLIC_KEY"))))
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierLog}}
+		Expect(cfg.Validate()).To(BeEmpty())
+	})
+
+	It("rejects unknown types and repeated names", func() {
+		cfg.Notifiers = []NotifierConfig{{Type: "pigeon"}, {Type: NotifierLog}, {Type: NotifierLog}}
+		errs := cfg.Validate()
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0]).To(MatchError(ContainSubstring("notifiers.pigeon.type")))
+		Expect(errs[1]).To(MatchError(ContainSubstring(`"log" is used by another notifier`)))
+	})
+
+	It("posts notifications to webhooks as JSON", func() {
+		var received Notification
+		var token string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			token = r.Header.Get("Authorization")
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+		}))
+		defer server.Close()
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierWebhook, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer hook"}}}
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		msg := MessageRequest{From: "+15557654321", To: "+15550001111", Body: "Running late"}
+		Expect(SendMessage(*cfg, profile, msg)).To(Succeed())
+		Expect(token).To(Equal("Bearer hook"))
+		Expect(received.Kind).To(Equal(NotifyMessage))
+		Expect(received.From).To(Equal("+15557654321"))
+		Expect(received.Text).To(ContainSubstring("Running late"))
+	})
+
+	It("reports webhooks that fail", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", 503)
+		}))
+		defer server.Close()
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierWebhook, Name: "chat", URL: server.URL}, {Type: NotifierLog}}
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		err := SendMessage(*cfg, profile, MessageRequest{From: "+15557654321"})
+		Expect(err).To(MatchError("chat: webhook returned 503 Service Unavailable"))
+	})
+
+	It("texts notifications from the virtual number through Twilio", func() {
+		var path, user, password string
+		var form map[string][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			user, password, _ = r.BasicAuth()
+			r.ParseForm()
+			form = r.PostForm
+			w.WriteHeader(201)
+		}))
+		defer server.Close()
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierSMS, URL: server.URL}}
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		Expect(SendMissedCall(*cfg, profile, CallRecord{From: "+15557654321", To: "+15550001111"})).To(Succeed())
+		Expect(path).To(Equal("/2010-04-01/Accounts/AC123/Messages.json"))
+		Expect(user).To(Equal("AC123"))
+		Expect(password).To(Equal("12345"))
+		Expect(form["From"]).To(Equal([]string{"+15550001111"}))
+		Expect(form["To"]).To(Equal([]string{"+15555555"}))
+		Expect(form["Body"]).To(Equal([]string{"Missed call from +15557654321"}))
+	})
+})
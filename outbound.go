@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// GatherActionRequest represents a request as a result of declaring an `action` URL on a Gather verb
+type GatherActionRequest struct {
+	twiml.VoiceRequest
+	Digits string
+}
+
+// PINAttempts counts the incorrect PINs entered from each number, so that someone spoofing the
+// caller ID of an owner can't guess the PIN over many calls.  After MaxFailures incorrect PINs
+// within Window, the number is locked out until the oldest of them is outside the window.
+type PINAttempts struct {
+	MaxFailures int
+	Window      time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	now      func() time.Time
+}
+
+// NewPINAttempts returns a counter that allows 5 incorrect PINs an hour from each number
+func NewPINAttempts(cfg Config) *PINAttempts {
+	return &PINAttempts{
+		MaxFailures: 5,
+		Window:      time.Hour,
+		failures:    make(map[string][]time.Time),
+		now:         cfg.now,
+	}
+}
+
+// Locked returns true if the number has entered too many incorrect PINs recently
+func (a *PINAttempts) Locked(number string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.recent(digitsOnly(number))) >= a.MaxFailures
+}
+
+// Fail records an incorrect PIN from the number
+func (a *PINAttempts) Fail(number string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for n := range a.failures {
+		a.recent(n)
+	}
+	n := digitsOnly(number)
+	a.failures[n] = append(a.failures[n], a.now())
+}
+
+// Reset forgets the incorrect PINs from the number after it enters the right one
+func (a *PINAttempts) Reset(number string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, digitsOnly(number))
+}
+
+// recent drops the failures of the number that are outside the window and returns the rest
+func (a *PINAttempts) recent(n string) []time.Time {
+	cutoff := a.now().Add(-a.Window)
+	var kept []time.Time
+	for _, at := range a.failures[n] {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	if len(kept) == 0 {
+		delete(a.failures, n)
+		return nil
+	}
+	a.failures[n] = kept
+	return kept
+}
+
+// OutboundPIN checks the PIN entered by the owner before allowing an outbound call.  Numbers that
+// have entered too many incorrect PINs are turned away without checking the PIN.
+func OutboundPIN(cfg Config, attempts *PINAttempts) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ga GatherActionRequest
+		if err := twiml.Bind(&ga, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		res := twiml.NewResponse()
+		if attempts.Locked(ga.From) {
+			requestLog(r).Warn("Rejected outbound call attempt from a number locked out after incorrect PINs", "from", ga.From)
+			res.Add(&twiml.Say{Voice: "woman", Text: "Sorry, that PIN is incorrect. Goodbye."}, &twiml.Hangup{})
+			writeResponse(w, r, res)
+			return
+		}
+		if !cfg.IsOwner(ga.From) || subtle.ConstantTimeCompare([]byte(ga.Digits), []byte(cfg.OutboundPIN)) != 1 {
+			requestLog(r).Warn("Rejected outbound call attempt with incorrect PIN", "from", ga.From)
+			attempts.Fail(ga.From)
+			res.Add(&twiml.Say{Voice: "woman", Text: "Sorry, that PIN is incorrect. Goodbye."}, &twiml.Hangup{})
+			writeResponse(w, r, res)
+			return
+		}
+		attempts.Reset(ga.From)
+		g := twiml.Gather{
+			Action:      "dial",
+			FinishOnKey: "#",
+			Timeout:     10,
+		}
+		g.Add(&twiml.Say{Voice: "woman", Text: "Enter the number you want to call, followed by the pound key."})
+		res.Add(&g, &twiml.Say{Voice: "woman", Text: "No number entered. Goodbye."}, &twiml.Hangup{})
+		writeResponse(w, r, res)
+	}
+}
+
+// OutboundDial connects the owner to the number they entered, using the virtual number as the caller ID
+func OutboundDial(cfg Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ga GatherActionRequest
+		if err := twiml.Bind(&ga, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		res := twiml.NewResponse()
+		if !cfg.IsOwner(ga.From) {
+			res.Add(&twiml.Hangup{})
+			writeResponse(w, r, res)
+			return
+		}
+		number, err := NormalizeNumber(ga.Digits, cfg.DefaultCountryCode)
+		if err != nil {
+			res.Add(&twiml.Say{Voice: "woman", Text: "Sorry, that is not a valid phone number. Goodbye."}, &twiml.Hangup{})
+			writeResponse(w, r, res)
+			return
+		}
+		if !cfg.OutboundAllowed(number) {
+			requestLog(r).Warn("Blocked outbound call", "from", ga.From, "to", number)
+			res.Add(&twiml.Say{Voice: "woman", Text: "Sorry, calls to that destination are not allowed. Goodbye."}, &twiml.Hangup{})
+			writeResponse(w, r, res)
+			return
+		}
+		requestLog(r).Info("Placing outbound call", "from", ga.To, "to", number)
+		res.Add(&twiml.Dial{
+			Number:   number,
+			CallerID: ga.To,
+		})
+		writeResponse(w, r, res)
+	}
+}
+
+// outboundPrompt asks the owner for their PIN when they call the virtual number
+func outboundPrompt() []twiml.Markup {
+	g := twiml.Gather{
+		Action:      "outbound/pin",
+		FinishOnKey: "#",
+		Timeout:     10,
+	}
+	g.Add(&twiml.Say{Voice: "woman", Text: "Enter your PIN, followed by the pound key."})
+	return []twiml.Markup{&g, &twiml.Hangup{}}
+}
+
+// NormalizeNumber converts digits entered on the keypad to an E.164 number.  Numbers
+// starting with an international prefix (00 or 011) are used as is, numbers starting with a
+// national trunk prefix (0) or 10 digit numbers in the North American Numbering Plan get the
+// default country code, and anything else is assumed to already include the country code.
+func NormalizeNumber(digits string, defaultCountryCode string) (string, error) {
+	n := digitsOnly(digits)
+	switch {
+	case strings.HasPrefix(n, "00"):
+		n = n[2:]
+	case strings.HasPrefix(n, "011") && defaultCountryCode == "1":
+		n = n[3:]
+	case strings.HasPrefix(n, "0"):
+		n = defaultCountryCode + n[1:]
+	case len(n) == 10 && defaultCountryCode == "1":
+		n = defaultCountryCode + n
+	}
+
+	// E.164 numbers have at most 15 digits, and no country code starts with 0
+	if len(n) < 8 || len(n) > 15 || n[0] == '0' {
+		return "", fmt.Errorf("%s is not a valid phone number", digits)
+	}
+	return "+" + n, nil
+}
+
+// IsOwner returns true if the number belongs to the owner of the virtual number or is one of
+// the forwarding numbers of a profile
+func (cfg *Config) IsOwner(number string) bool {
+	owners := append([]string{cfg.ForwardingNumber}, cfg.OwnerNumbers...)
+	for _, p := range cfg.Profiles {
+		owners = append(owners, p.ForwardingNumbers...)
+	}
+	for _, owner := range owners {
+		if len(owner) > 0 && digitsOnly(owner) == digitsOnly(number) {
+			return true
+		}
+	}
+	return false
+}
+
+// OutboundAllowed checks an E.164 number against the allowed and denied country codes.  Denied
+// codes take precedence.  When no allowed codes are configured, only calls within the default
+// country code are allowed.
+func (cfg *Config) OutboundAllowed(number string) bool {
+	n := strings.TrimPrefix(number, "+")
+	for _, code := range cfg.OutboundDenyCountries {
+		if strings.HasPrefix(n, code) {
+			return false
+		}
+	}
+	allowed := cfg.OutboundAllowCountries
+	if len(allowed) == 0 {
+		allowed = []string{cfg.DefaultCountryCode}
+	}
+	for _, code := range allowed {
+		if strings.HasPrefix(n, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func digitsOnly(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+}
@@ -0,0 +1,139 @@
+package main_test
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outbound calling", func() {
+	DescribeTable("NormalizeNumber",
+		func(digits string, countryCode string, expected string) {
+			n, err := NormalizeNumber(digits, countryCode)
+			if len(expected) == 0 {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(expected))
+		},
+		Entry("10 digit NANP number", "5551234567", "1", "+15551234567"),
+		Entry("NANP number with country code", "15551234567", "1", "+15551234567"),
+		Entry("NANP international prefix", "011447700900123", "1", "+447700900123"),
+		Entry("international prefix", "00447700900123", "44", "+447700900123"),
+		Entry("national trunk prefix", "07700900123", "44", "+447700900123"),
+		Entry("number with country code", "447700900123", "44", "+447700900123"),
+		Entry("too short", "12345", "1", ""),
+		Entry("too long", "0012345678901234567", "1", ""),
+		Entry("empty", "", "1", ""),
+	)
+
+	Describe("Config.OutboundAllowed", func() {
+		var cfg *Config
+
+		BeforeEach(func() {
+			cfg = &Config{DefaultCountryCode: "1"}
+		})
+
+		It("only allows the default country code when no list is set", func() {
+			Expect(cfg.OutboundAllowed("+15551234567")).To(BeTrue())
+			Expect(cfg.OutboundAllowed("+447700900123")).To(BeFalse())
+		})
+
+		It("allows configured country codes", func() {
+			cfg.OutboundAllowCountries = []string{"1", "44"}
+			Expect(cfg.OutboundAllowed("+447700900123")).To(BeTrue())
+			Expect(cfg.OutboundAllowed("+2348012345678")).To(BeFalse())
+		})
+
+		It("gives denied prefixes precedence", func() {
+			cfg.OutboundAllowCountries = []string{"1"}
+			cfg.OutboundDenyCountries = []string{"1900"}
+			Expect(cfg.OutboundAllowed("+19005551234")).To(BeFalse())
+			Expect(cfg.OutboundAllowed("+15551234567")).To(BeTrue())
+		})
+	})
+
+	Describe("Config.IsOwner", func() {
+		It("matches the forwarding number and owner numbers ignoring formatting", func() {
+			cfg := &Config{ForwardingNumber: "+1 (555) 123-4567", OwnerNumbers: []string{"+15557654321"}}
+			Expect(cfg.IsOwner("+15551234567")).To(BeTrue())
+			Expect(cfg.IsOwner("+15557654321")).To(BeTrue())
+			Expect(cfg.IsOwner("+15550000000")).To(BeFalse())
+		})
+	})
+
+	Describe("handlers", func() {
+		var cfg Config
+		var attempts *PINAttempts
+		var now time.Time
+
+		BeforeEach(func() {
+			now = time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+			cfg = testConfig()
+			cfg.ForwardingNumber = "+15551234567"
+			cfg.OutboundPIN = "2468"
+			cfg.Now = func() time.Time { return now }
+			Expect(cfg.Validate()).To(BeEmpty())
+			attempts = NewPINAttempts(cfg)
+		})
+
+		// enter sends the digits the caller entered to the handler and returns the TwiML
+		enter := func(handler http.HandlerFunc, from string, digits string) string {
+			form := url.Values{"CallSid": {"CA123"}, "From": {from}, "To": {"+15550001111"}, "Digits": {digits}}
+			return postForm(handler, "/call/outbound/pin", form)
+		}
+
+		It("asks the owner for the number to call after the right PIN", func() {
+			twiml := enter(OutboundPIN(cfg, attempts), "+15551234567", "2468")
+			Expect(twiml).To(ContainSubstring(`<Gather action="dial"`))
+			Expect(twiml).To(ContainSubstring("Enter the number you want to call"))
+		})
+
+		It("hangs up on a wrong PIN or a caller who isn't an owner", func() {
+			Expect(enter(OutboundPIN(cfg, attempts), "+15551234567", "1357")).To(ContainSubstring("that PIN is incorrect"))
+			Expect(enter(OutboundPIN(cfg, attempts), "+15559999999", "2468")).To(ContainSubstring("that PIN is incorrect"))
+		})
+
+		It("locks out a number after too many wrong PINs until the window has passed", func() {
+			handler := OutboundPIN(cfg, attempts)
+			for i := 0; i < attempts.MaxFailures; i++ {
+				Expect(enter(handler, "+15551234567", "0000")).To(ContainSubstring("incorrect"))
+			}
+			Expect(attempts.Locked("+1 (555) 123-4567")).To(BeTrue())
+			Expect(enter(handler, "+15551234567", "2468")).To(ContainSubstring("incorrect"))
+
+			now = now.Add(attempts.Window + time.Minute)
+			Expect(enter(handler, "+15551234567", "2468")).To(ContainSubstring("Enter the number you want to call"))
+		})
+
+		It("forgets wrong PINs once the right one is entered", func() {
+			handler := OutboundPIN(cfg, attempts)
+			for i := 0; i < attempts.MaxFailures-1; i++ {
+				enter(handler, "+15551234567", "0000")
+			}
+			enter(handler, "+15551234567", "2468")
+			enter(handler, "+15551234567", "0000")
+			Expect(attempts.Locked("+15551234567")).To(BeFalse())
+		})
+
+		It("dials the number entered from the virtual number", func() {
+			twiml := enter(OutboundDial(cfg), "+15551234567", "5557654321")
+			Expect(twiml).To(ContainSubstring(`<Dial callerId="+15550001111">+15557654321</Dial>`))
+		})
+
+		It("refuses invalid numbers, denied destinations and callers who aren't owners", func() {
+			Expect(enter(OutboundDial(cfg), "+15551234567", "123")).To(ContainSubstring("not a valid phone number"))
+			Expect(enter(OutboundDial(cfg), "+15551234567", "011447700900123")).To(ContainSubstring("not allowed"))
+			twiml := enter(OutboundDial(cfg), "+15559999999", "5557654321")
+			Expect(twiml).To(ContainSubstring("<Hangup>"))
+			Expect(twiml).ToNot(ContainSubstring("<Dial"))
+		})
+	})
+})
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutboxEntry is a notification waiting in the outbox to be sent
+type OutboxEntry struct {
+	ID           string       `json:"id"`
+	Notification Notification `json:"notification"`
+	// Channels are the notifiers still to send on, or every notifier if empty
+	Channels    []string  `json:"channels,omitempty"`
+	Attempts    int       `json:"attempts"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	// RecordingChecked is set once the recording of a voicemail has been downloaded to attach,
+	// or couldn't be, so that retries don't download it again
+	RecordingChecked bool `json:"recording_checked,omitempty"`
+}
+
+// Outbox saves notifications to disk before they are sent, so that they aren't lost when a
+// channel is down or the server restarts.  A background worker sends them, retrying failed
+// channels with exponential backoff, and moves a notification to the dead letter directory after
+// the last attempt.
+type Outbox struct {
+	// MaxAttempts is how many times a notification is tried before it is given up on
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry, doubling for each retry after that
+	Backoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+	// Store has the voicemail audio downloaded by the archiver, attached to voicemail emails
+	// instead of downloading the recording again
+	Store VoicemailStore
+
+	cfg  Config
+	dir  string
+	now  func() time.Time
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+	// unsaved are the entries whose retry couldn't be saved, kept by the worker so that they
+	// still wait for their next attempt
+	unsaved map[string]OutboxEntry
+}
+
+// NewOutbox returns an outbox that keeps notifications in dir, with the dead letters in its dead
+// subdirectory
+func NewOutbox(cfg Config, dir string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "dead"), 0700); err != nil {
+		return nil, err
+	}
+	return &Outbox{
+		MaxAttempts: cfg.OutboxMaxAttempts,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  time.Hour,
+		cfg:         cfg,
+		dir:         dir,
+		now:         cfg.now,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		unsaved:     make(map[string]OutboxEntry),
+	}, nil
+}
+
+// Start sends notifications in the background, beginning with any left from before a restart
+func (o *Outbox) Start() {
+	o.wg.Add(1)
+	go o.run()
+}
+
+// Stop waits for the notification being sent to finish and stops the worker
+func (o *Outbox) Stop() {
+	close(o.done)
+	o.wg.Wait()
+}
+
+// Send queues the notification of a voicemail
+func (o *Outbox) Send(cfg Config, profile Profile, v VoicemailRecord, call CallRecord) error {
+	n, err := VoicemailNotification(cfg, profile, v, call)
+	if err != nil {
+		return err
+	}
+	return o.Enqueue(n)
+}
+
+// SendMessage queues the notification of a text message
+func (o *Outbox) SendMessage(cfg Config, profile Profile, msg MessageRequest) error {
+	n, err := MessageNotification(cfg, profile, msg)
+	if err != nil {
+		return err
+	}
+	return o.Enqueue(n)
+}
+
+// SendMissedCall queues the notification of a missed call
+func (o *Outbox) SendMissedCall(cfg Config, profile Profile, call CallRecord) error {
+	n, err := MissedCallNotification(cfg, profile, call)
+	if err != nil {
+		return err
+	}
+	return o.Enqueue(n)
+}
+
+// Enqueue saves the notification to the outbox and wakes the worker to send it
+func (o *Outbox) Enqueue(n Notification) error {
+	now := o.now()
+	b := make([]byte, 4)
+	rand.Read(b)
+	e := OutboxEntry{
+		ID:           fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(b)),
+		Notification: n,
+		CreatedAt:    now,
+		NextAttempt:  now,
+	}
+	if err := writeEntry(o.dir, e); err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *Outbox) run() {
+	defer o.wg.Done()
+	for {
+		wait := time.Minute
+		attempted := false
+		entries, err := ReadOutbox(o.dir)
+		if err != nil {
+			logger.Error("Unable to read the outbox", "error", err)
+		}
+		for _, e := range entries {
+			select {
+			case <-o.done:
+				return
+			default:
+			}
+			if unsaved, ok := o.unsaved[e.ID]; ok {
+				e = unsaved
+			}
+			if until := e.NextAttempt.Sub(o.now()); until > 0 {
+				if until < wait {
+					wait = until
+				}
+				continue
+			}
+			o.attempt(e)
+			attempted = true
+		}
+		if attempted {
+			// look again for the soonest retry, including those just scheduled
+			continue
+		}
+		select {
+		case <-o.done:
+			return
+		case <-o.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt sends the notification on the channels it hasn't been sent on yet, then removes it
+// from the outbox, schedules a retry, or moves it to the dead letters
+func (o *Outbox) attempt(e OutboxEntry) {
+	l := logger.With("notification_id", e.ID, "kind", e.Notification.Kind)
+	notifiers := o.channels(e)
+	if !e.RecordingChecked && needsRecording(o.cfg, notifiers, e.Notification) {
+		attachRecording(o.cfg, o.Store, &e.Notification)
+		e.RecordingChecked = true
+	}
+	err := Notify(notifiers, e.Notification)
+	e.Attempts++
+	if err == nil {
+		delete(o.unsaved, e.ID)
+		if err := os.Remove(filepath.Join(o.dir, e.ID+".json")); err != nil {
+			l.Error("Unable to remove notification from the outbox", "error", err)
+		}
+		return
+	}
+
+	e.LastError = err.Error()
+	e.Channels = nil
+	if failed, ok := err.(NotifyError); ok {
+		for name := range failed {
+			e.Channels = append(e.Channels, name)
+		}
+		sort.Strings(e.Channels)
+	} else {
+		for _, n := range notifiers {
+			e.Channels = append(e.Channels, n.Name())
+		}
+	}
+	e.NextAttempt = o.now().Add(o.backoff(e.Attempts))
+	if e.Attempts >= o.MaxAttempts {
+		l.Error("Giving up on notification", "attempts", e.Attempts, "error", err)
+		if err := writeEntry(filepath.Join(o.dir, "dead"), e); err != nil {
+			l.Error("Unable to save dead notification", "error", err)
+			o.unsaved[e.ID] = e
+			return
+		}
+		delete(o.unsaved, e.ID)
+		os.Remove(filepath.Join(o.dir, e.ID+".json"))
+		return
+	}
+	l.Warn("Retrying notification", "channels", e.Channels, "next_attempt", e.NextAttempt)
+	if err := writeEntry(o.dir, e); err != nil {
+		l.Error("Unable to save notification", "error", err)
+		o.unsaved[e.ID] = e
+		return
+	}
+	delete(o.unsaved, e.ID)
+}
+
+// channels returns the notifiers the entry still has to be sent on.  Channels that have been
+// removed from the config since are skipped.
+func (o *Outbox) channels(e OutboxEntry) []Notifier {
+	if len(e.Channels) == 0 {
+		return o.cfg.notifiers
+	}
+	var notifiers []Notifier
+	for _, name := range e.Channels {
+		found := false
+		for _, n := range o.cfg.notifiers {
+			if n.Name() == name {
+				notifiers = append(notifiers, n)
+				found = true
+			}
+		}
+		if !found {
+			logger.Warn("Skipping notifier that is no longer configured", "notifier", name, "notification_id", e.ID)
+		}
+	}
+	return notifiers
+}
+
+// backoff returns how long to wait before the next attempt.  The wait doubles with each attempt,
+// with up to half of it taken off at random so that retries after an outage are spread out.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < attempts && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - time.Duration(mrand.Int63n(int64(d)/2+1))
+}
+
+// ReadOutbox returns the entries in the outbox directory, oldest first
+func ReadOutbox(dir string) ([]OutboxEntry, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []OutboxEntry
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var e OutboxEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			logger.Warn("Skipping unreadable notification", "file", filepath.Join(dir, f.Name()), "error", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// ReplayDead moves dead notifications in the outbox at dir back to be sent again, with their
+// attempts reset.  With no ids, every dead notification is replayed.  It returns the
+// notifications replayed.
+func ReplayDead(cfg Config, dir string, ids ...string) ([]OutboxEntry, error) {
+	dead, err := ReadOutbox(filepath.Join(dir, "dead"))
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var replayed []OutboxEntry
+	for _, e := range dead {
+		if len(ids) > 0 && !wanted[e.ID] {
+			continue
+		}
+		delete(wanted, e.ID)
+		e.Attempts, e.NextAttempt, e.LastError = 0, cfg.now(), ""
+		if err := writeEntry(dir, e); err != nil {
+			return replayed, err
+		}
+		if err := os.Remove(filepath.Join(dir, "dead", e.ID+".json")); err != nil {
+			return replayed, err
+		}
+		replayed = append(replayed, e)
+	}
+	for id := range wanted {
+		return replayed, fmt.Errorf("no dead notification %s", id)
+	}
+	return replayed, nil
+}
+
+// writeEntry saves the entry to dir, replacing any earlier version
+func writeEntry(dir string, e OutboxEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, e.ID+".json")
+	if err := ioutil.WriteFile(file+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -0,0 +1,165 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// flakyWebhook is a webhook that fails until it has been called a number of times
+type flakyWebhook struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func newFlakyWebhook(failures int) *flakyWebhook {
+	wh := &flakyWebhook{failures: failures}
+	wh.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wh.mu.Lock()
+		defer wh.mu.Unlock()
+		wh.calls++
+		if wh.calls <= wh.failures {
+			http.Error(w, "down", 503)
+		}
+	}))
+	return wh
+}
+
+func (wh *flakyWebhook) Calls() int {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	return wh.calls
+}
+
+var _ = Describe("Outbox", func() {
+	var dir string
+	var cfg *Config
+	var good, flaky *flakyWebhook
+	var outbox *Outbox
+
+	open := func(failures int) {
+		good, flaky = newFlakyWebhook(0), newFlakyWebhook(failures)
+		cfg.Notifiers = []NotifierConfig{
+			{Type: NotifierWebhook, Name: "good", URL: good.URL},
+			{Type: NotifierWebhook, Name: "flaky", URL: flaky.URL},
+		}
+		Expect(cfg.Validate()).To(BeEmpty())
+		var err error
+		outbox, err = NewOutbox(*cfg, dir)
+		Expect(err).ToNot(HaveOccurred())
+		outbox.Backoff = time.Millisecond
+	}
+	queued := func() []OutboxEntry {
+		entries, err := ReadOutbox(dir)
+		Expect(err).ToNot(HaveOccurred())
+		return entries
+	}
+	dead := func() []OutboxEntry {
+		entries, err := ReadOutbox(filepath.Join(dir, "dead"))
+		Expect(err).ToNot(HaveOccurred())
+		return entries
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "outbox")
+		Expect(err).ToNot(HaveOccurred())
+		c := testConfig()
+		c.OutboxMaxAttempts = 3
+		cfg = &c
+	})
+
+	AfterEach(func() {
+		good.Close()
+		flaky.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("saves notifications before sending them", func() {
+		open(0)
+		profile, _ := cfg.Mailbox("default")
+		Expect(outbox.SendMessage(*cfg, profile, MessageRequest{From: "+15557654321", Body: "Running late"})).To(Succeed())
+
+		entries := queued()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Notification.Kind).To(Equal(NotifyMessage))
+		Expect(entries[0].Notification.Emails).To(Equal([]string{"me@example.com"}))
+		Expect(good.Calls()).To(Equal(0))
+
+		outbox.Start()
+		defer outbox.Stop()
+		Eventually(queued).Should(BeEmpty())
+		Expect(good.Calls()).To(Equal(1))
+		Expect(flaky.Calls()).To(Equal(1))
+	})
+
+	It("retries only the channels that failed", func() {
+		open(2)
+		outbox.Start()
+		defer outbox.Stop()
+		Expect(outbox.Enqueue(Notification{Kind: NotifyMissedCall, From: "+15557654321"})).To(Succeed())
+
+		Eventually(flaky.Calls).Should(Equal(3))
+		Eventually(queued).Should(BeEmpty())
+		Expect(good.Calls()).To(Equal(1))
+		Expect(dead()).To(BeEmpty())
+	})
+
+	It("waits to retry a notification whose retry couldn't be saved", func() {
+		open(10)
+		outbox.Backoff = time.Hour
+		Expect(outbox.Enqueue(Notification{Kind: NotifyMissedCall, From: "+15557654321"})).To(Succeed())
+		// a directory in the way of the temporary file fails the save
+		Expect(os.Mkdir(filepath.Join(dir, queued()[0].ID+".json.tmp"), 0700)).To(Succeed())
+
+		outbox.Start()
+		defer outbox.Stop()
+		Eventually(flaky.Calls).Should(Equal(1))
+		Consistently(flaky.Calls, "100ms").Should(Equal(1))
+		Expect(queued()[0].Attempts).To(Equal(0))
+	})
+
+	It("moves notifications to the dead letters after the last attempt and replays them", func() {
+		open(3)
+		outbox.Start()
+		Expect(outbox.Enqueue(Notification{Kind: NotifyMissedCall, From: "+15557654321"})).To(Succeed())
+
+		Eventually(dead).Should(HaveLen(1))
+		outbox.Stop()
+		Expect(queued()).To(BeEmpty())
+		entry := dead()[0]
+		Expect(entry.Attempts).To(Equal(3))
+		Expect(entry.Channels).To(Equal([]string{"flaky"}))
+		Expect(entry.LastError).To(ContainSubstring("503"))
+
+		replayedAt := time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		cfg.Now = func() time.Time { return replayedAt }
+		_, err := ReplayDead(*cfg, dir, "nonexistent")
+		Expect(err).To(MatchError("no dead notification nonexistent"))
+		replayed, err := ReplayDead(*cfg, dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replayed).To(HaveLen(1))
+		Expect(dead()).To(BeEmpty())
+		Expect(queued()[0].Attempts).To(Equal(0))
+		Expect(queued()[0].NextAttempt).To(BeTemporally("==", replayedAt))
+
+		outbox, err = NewOutbox(*cfg, dir)
+		Expect(err).ToNot(HaveOccurred())
+		outbox.Start()
+		defer outbox.Stop()
+		Eventually(queued).Should(BeEmpty())
+		Expect(flaky.Calls()).To(Equal(4))
+		Expect(good.Calls()).To(Equal(1))
+	})
+})
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Profile holds the routing settings for one virtual number.  Profiles are configured in the
+// config file keyed by the virtual number, and any setting left out is taken from the default
+// profile made up of the top level settings.
+type Profile struct {
+	Name               string     `json:"name"`
+	ForwardingNumbers  []string   `json:"forwarding_numbers"`
+	VoicemailScript    string     `json:"voicemail_script"`
+	VoicemailFile      string     `json:"voicemail_file"`
+	DialTimeout        int        `json:"dial_timeout"`
+	NotificationEmails []string   `json:"notification_emails"`
+	Schedule           *Schedule  `json:"schedule"`
+	RingGroup          *RingGroup `json:"ring_group"`
+	Screen             bool       `json:"screen"`
+	Menu               string     `json:"menu"`
+	TemplateDir        string     `json:"template_dir"`
+
+	// Mailbox is set when the call was routed to the profile from a menu, and names the profile
+	// in callback URLs since the called number would route to a different profile
+	Mailbox string `json:"-"`
+	// PromptURL is the URL of the custom voicemail prompt, if there is one
+	PromptURL string `json:"-"`
+	// PromptPath is the location of the custom voicemail prompt on disk
+	PromptPath string `json:"-"`
+	// templates are the notification templates loaded from TemplateDir
+	templates notificationTemplates
+}
+
+// DefaultProfile returns the profile used for calls to numbers without a profile of their own
+func (cfg *Config) DefaultProfile() Profile {
+	p := Profile{
+		Name:            "default",
+		VoicemailScript: cfg.VoicemailScript,
+		VoicemailFile:   cfg.VoicemailFile,
+		DialTimeout:     cfg.DialTimeout,
+		Schedule:        cfg.Schedule,
+		RingGroup:       cfg.RingGroup,
+		Screen:          cfg.ScreenCalls,
+		Menu:            cfg.Menu,
+		TemplateDir:     cfg.TemplateDir,
+		templates:       cfg.templates,
+	}
+	if len(cfg.ForwardingNumber) > 0 {
+		p.ForwardingNumbers = []string{cfg.ForwardingNumber}
+	}
+	if len(cfg.NotificationEmail) > 0 {
+		p.NotificationEmails = []string{cfg.NotificationEmail}
+	}
+	if cfg.EnableCustomPrompt {
+		p.PromptURL = fmt.Sprintf("/prompt/%s", cfg.VoiceFileName)
+		p.PromptPath = path.Join(cfg.ServeDirectory, cfg.VoiceFileName)
+	}
+	return p
+}
+
+// Profile returns the routing profile for the virtual number that was called
+func (cfg *Config) Profile(called string) Profile {
+	for number, p := range cfg.Profiles {
+		if digitsOnly(number) == digitsOnly(called) {
+			return p
+		}
+	}
+	return cfg.DefaultProfile()
+}
+
+// Mailbox returns the profile named by its virtual number, its name, or "default" for the default
+// profile, and false if there is no such profile
+func (cfg *Config) Mailbox(name string) (Profile, bool) {
+	if name == "default" {
+		p := cfg.DefaultProfile()
+		p.Mailbox = name
+		return p, true
+	}
+	for number, p := range cfg.Profiles {
+		if p.Name == name || (len(digitsOnly(name)) > 0 && digitsOnly(number) == digitsOnly(name)) {
+			p.Mailbox = name
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// requestProfile returns the profile a callback is for, which is the mailbox in the URL when the
+// call was routed from a menu, or otherwise the profile of the called number
+func (cfg *Config) requestProfile(r *http.Request, called string) Profile {
+	if name := r.URL.Query().Get("mailbox"); len(name) > 0 {
+		if p, ok := cfg.Mailbox(name); ok {
+			return p
+		}
+	}
+	return cfg.Profile(called)
+}
+
+// withMailbox adds the mailbox of the profile to a callback URL when the call was routed to the
+// profile from a menu
+func (p Profile) withMailbox(u string) string {
+	if len(p.Mailbox) == 0 {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return u + sep + "mailbox=" + url.QueryEscape(p.Mailbox)
+}
+
+// validateProfiles fills in each profile from the default profile and checks its voicemail prompt
+func (cfg *Config) validateProfiles() (errors []error) {
+	def := cfg.DefaultProfile()
+	errors = append(errors, cfg.duplicateProfiles()...)
+	for number, p := range cfg.Profiles {
+		if len(digitsOnly(number)) == 0 {
+			errors = append(errors, fmt.Errorf("%s: profiles: %q is not a phone number", cfg.File, number))
+			continue
+		}
+		if len(p.Name) == 0 {
+			p.Name = number
+		}
+		if len(p.ForwardingNumbers) == 0 && p.RingGroup == nil {
+			p.ForwardingNumbers = def.ForwardingNumbers
+			p.RingGroup = def.RingGroup
+			if len(p.Menu) == 0 {
+				p.Menu = def.Menu
+			}
+		}
+		if len(p.NotificationEmails) == 0 {
+			p.NotificationEmails = def.NotificationEmails
+		}
+		if p.DialTimeout == 0 {
+			p.DialTimeout = def.DialTimeout
+		}
+		if len(p.TemplateDir) == 0 {
+			p.TemplateDir = def.TemplateDir
+		}
+		p.Screen = p.Screen || def.Screen
+		if p.Schedule == nil {
+			p.Schedule = def.Schedule
+		} else {
+			for _, err := range p.Schedule.Compile() {
+				errors = append(errors, fmt.Errorf("%s: profiles.%s.schedule.%s", cfg.File, number, err))
+			}
+		}
+		if p.DialTimeout < 0 {
+			errors = append(errors, fmt.Errorf("%s: profiles.%s.dial_timeout: must be a positive number of seconds", cfg.File, number))
+		}
+		if p.RingGroup != nil && p.RingGroup != def.RingGroup {
+			for _, err := range p.RingGroup.compile(p.DialTimeout) {
+				errors = append(errors, fmt.Errorf("%s: profiles.%s.ring_group.%s", cfg.File, number, err))
+			}
+			if len(p.ForwardingNumbers) == 0 {
+				for _, m := range p.RingGroup.Members {
+					p.ForwardingNumbers = append(p.ForwardingNumbers, m.Number)
+				}
+			}
+		}
+		if len(p.VoicemailFile) > 0 {
+			if full, ok := promptFile(p.VoicemailFile); ok {
+				p.PromptPath = full
+				p.PromptURL = fmt.Sprintf("/prompt/%s/%s", digitsOnly(number), path.Base(full))
+			} else {
+				logger.Warn("Voicemail file not found, falling back to voice prompt", "profile", p.Name, "file", p.VoicemailFile)
+				p.VoicemailFile = ""
+			}
+		}
+		if len(p.VoicemailFile) == 0 {
+			p.PromptURL, p.PromptPath = def.PromptURL, def.PromptPath
+			if len(p.VoicemailScript) == 0 {
+				p.VoicemailScript = def.VoicemailScript
+			}
+		}
+		cfg.Profiles[number] = p
+	}
+	return
+}
+
+// duplicateProfiles returns an error for each set of profiles keyed by the same number written
+// differently, since only one of them could ever answer a call
+func (cfg *Config) duplicateProfiles() (errors []error) {
+	keys := make(map[string][]string)
+	for number := range cfg.Profiles {
+		if digits := digitsOnly(number); len(digits) > 0 {
+			keys[digits] = append(keys[digits], number)
+		}
+	}
+	var dups []string
+	for digits, numbers := range keys {
+		if len(numbers) > 1 {
+			dups = append(dups, digits)
+		}
+	}
+	sort.Strings(dups)
+	for _, digits := range dups {
+		numbers := keys[digits]
+		sort.Strings(numbers)
+		errors = append(errors, fmt.Errorf("%s: profiles: %q are the same number", cfg.File, numbers))
+	}
+	return
+}
+
+// promptFile returns the full path to a voicemail prompt relative to the working directory, and
+// whether the file exists
+func promptFile(file string) (string, bool) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		workingDir = ""
+	}
+	full := path.Join(workingDir, file)
+	if stat, err := os.Stat(full); err != nil || stat.IsDir() {
+		return full, false
+	}
+	return full, true
+}
+
+// Prompts returns the URLs of the custom voicemail prompts for each profile mapped to the files
+// to serve
+func (cfg *Config) Prompts() map[string]string {
+	prompts := make(map[string]string)
+	for _, p := range cfg.Profiles {
+		if len(p.PromptURL) > 0 {
+			prompts[p.PromptURL] = p.PromptPath
+		}
+	}
+	return prompts
+}
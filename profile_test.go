@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+	var cfg *Config
+
+	BeforeEach(func() {
+		cfg = &Config{
+			MailgunPublicKey:  "abc123",
+			MailgunSecretKey:  "pancakes",
+			MailgunDomain:     "example.com",
+			ForwardingNumber:  "+15555555",
+			NotificationEmail: "voicemail@example.com",
+			TwilioAuthToken:   "12345",
+			Profiles: map[string]Profile{
+				"+15550001111": {
+					Name:              "sales",
+					ForwardingNumbers: []string{"+15551111111", "+15552222222"},
+					VoicemailScript:   "You have reached sales",
+					DialTimeout:       25,
+				},
+				"+1 (555) 000-2222": {
+					NotificationEmails: []string{"support@example.com"},
+				},
+			},
+		}
+		Expect(cfg.Validate()).To(BeEmpty())
+	})
+
+	It("resolves the profile for the called number", func() {
+		p := cfg.Profile("+15550001111")
+		Expect(p.Name).To(Equal("sales"))
+		Expect(p.ForwardingNumbers).To(Equal([]string{"+15551111111", "+15552222222"}))
+		Expect(p.VoicemailScript).To(Equal("You have reached sales"))
+		Expect(p.DialTimeout).To(Equal(25))
+		Expect(p.NotificationEmails).To(Equal([]string{"voicemail@example.com"}))
+	})
+
+	It("matches numbers regardless of formatting", func() {
+		p := cfg.Profile("+15550002222")
+		Expect(p.NotificationEmails).To(Equal([]string{"support@example.com"}))
+	})
+
+	It("fills in missing settings from the default profile", func() {
+		p := cfg.Profile("+15550002222")
+		Expect(p.ForwardingNumbers).To(Equal([]string{"+15555555"}))
+		Expect(p.VoicemailScript).To(Equal("Please leave a message"))
+		Expect(p.DialTimeout).To(Equal(15))
+	})
+
+	It("falls back to the default profile for unknown numbers", func() {
+		p := cfg.Profile("+15559999999")
+		Expect(p.Name).To(Equal("default"))
+		Expect(p.ForwardingNumbers).To(Equal([]string{"+15555555"}))
+		Expect(p.NotificationEmails).To(Equal([]string{"voicemail@example.com"}))
+	})
+
+	It("returns error when a profile is not keyed by a phone number", func() {
+		cfg.Profiles["sales"] = Profile{}
+		Expect(cfg.Validate()).To(ContainElement(MatchError(MatchRegexp(`profiles: "sales" is not a phone number`))))
+	})
+
+	It("returns error when two profiles are keyed by the same number", func() {
+		cfg.Profiles["+1 (555) 000-1111"] = Profile{Name: "other"}
+		cfg.Profiles["15550001111"] = Profile{}
+		Expect(cfg.Validate()).To(ContainElement(MatchError(HaveSuffix(`profiles: ["+1 (555) 000-1111" "+15550001111" "15550001111"] are the same number`))))
+	})
+})
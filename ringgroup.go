@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/BTBurke/twiml"
+)
+
+// Ring group strategies
+const (
+	RingSimultaneous = "simultaneous"
+	RingSequential   = "sequential"
+)
+
+// RingGroup is a set of phones to ring for a profile.  A simultaneous group rings every member at
+// once for the dial timeout of the profile.  A sequential group rings each member in turn for
+// its own timeout, moving on to the next member when a call is not answered, and falls back to
+// voicemail after the last.
+type RingGroup struct {
+	Strategy string       `json:"strategy"`
+	Members  []RingMember `json:"members"`
+}
+
+// RingMember is a phone in a ring group.  Screen asks the member to accept each call before the
+// caller is connected.  ScreenURL is optional and is the URL of custom TwiML to run for the
+// member when they answer instead.
+type RingMember struct {
+	Number    string `json:"number"`
+	Timeout   int    `json:"timeout"`
+	Screen    bool   `json:"screen"`
+	ScreenURL string `json:"screen_url"`
+}
+
+// compile checks the ring group, filling in member timeouts from the profile
+func (g *RingGroup) compile(dialTimeout int) (errors []error) {
+	switch g.Strategy {
+	case "":
+		g.Strategy = RingSimultaneous
+	case RingSimultaneous, RingSequential:
+	default:
+		errors = append(errors, fmt.Errorf("strategy: must be %s or %s", RingSimultaneous, RingSequential))
+	}
+	if len(g.Members) == 0 {
+		errors = append(errors, fmt.Errorf("members: at least one member is required"))
+	}
+	for i := range g.Members {
+		m := &g.Members[i]
+		if len(digitsOnly(m.Number)) == 0 {
+			errors = append(errors, fmt.Errorf("members.%d.number: %q is not a phone number", i, m.Number))
+		}
+		if m.Timeout == 0 {
+			m.Timeout = dialTimeout
+		}
+		if m.Timeout < 0 {
+			errors = append(errors, fmt.Errorf("members.%d.timeout: must be a positive number of seconds", i))
+		}
+	}
+	return
+}
+
+// ringGroup returns the ring group of the profile, or a simultaneous group of its forwarding
+// numbers if it doesn't have one
+func (p Profile) ringGroup() *RingGroup {
+	if p.RingGroup != nil {
+		return p.RingGroup
+	}
+	g := RingGroup{Strategy: RingSimultaneous}
+	for _, n := range p.ForwardingNumbers {
+		g.Members = append(g.Members, RingMember{Number: n, Timeout: p.DialTimeout})
+	}
+	return &g
+}
+
+// dialNumbers is a Dial verb that rings several numbers at once.  twiml.Dial requires a single
+// number as its body, so the numbers are added as Number nouns here instead.
+type dialNumbers struct {
+	XMLName  xml.Name `xml:"Dial"`
+	Action   string   `xml:"action,attr,omitempty"`
+	Timeout  int      `xml:"timeout,attr,omitempty"`
+	CallerID string   `xml:"callerId,attr,omitempty"`
+	Numbers  []*twiml.Number
+}
+
+func (d *dialNumbers) Validate() error {
+	if len(d.Numbers) == 0 {
+		return fmt.Errorf("Dial did not pass validation")
+	}
+	for _, n := range d.Numbers {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dialNumbers) Type() string {
+	return "Dial"
+}
+
+// dialMembers returns the Dial verb that rings the members at once
+func dialMembers(members []RingMember, timeout int, action string, callerID string) twiml.Markup {
+	if len(members) == 1 && len(members[0].ScreenURL) == 0 {
+		return &twiml.Dial{
+			Number:   members[0].Number,
+			Action:   action,
+			Timeout:  timeout,
+			CallerID: callerID,
+		}
+	}
+	d := dialNumbers{
+		Action:   action,
+		Timeout:  timeout,
+		CallerID: callerID,
+	}
+	for _, m := range members {
+		d.Numbers = append(d.Numbers, &twiml.Number{Number: m.Number, URL: m.ScreenURL})
+	}
+	return &d
+}
+
+// dialProfile returns the Dial verb that starts ringing the ring group of the profile
+func dialProfile(cfg Config, p Profile, call twiml.VoiceRequest) twiml.Markup {
+	g := p.ringGroup()
+	if g.Strategy == RingSequential {
+		return dialStep(cfg, p, 0, call)
+	}
+	return dialMembers(screened(cfg, p, g.Members, call), p.DialTimeout, p.withMailbox("action/"), call.To)
+}
+
+// dialStep returns the Dial verb that rings a single member of a sequential ring group.  The
+// dial action records the step so that the next member can be tried if nobody answers.
+func dialStep(cfg Config, p Profile, step int, call twiml.VoiceRequest) twiml.Markup {
+	m := p.ringGroup().Members[step]
+	return dialMembers(screened(cfg, p, []RingMember{m}, call), m.Timeout, p.withMailbox("/call/action/?step="+strconv.Itoa(step+1)), call.To)
+}
+
+// screened points members who screen their calls at the screening prompt for this call
+func screened(cfg Config, p Profile, members []RingMember, call twiml.VoiceRequest) []RingMember {
+	screen := make([]RingMember, len(members))
+	for i, m := range members {
+		if (m.Screen || p.Screen) && len(m.ScreenURL) == 0 {
+			m.ScreenURL = screenURL(cfg, call)
+		}
+		screen[i] = m
+	}
+	return screen
+}
+
+// nextStep returns the step of a sequential ring group to try after a dial action, and false when
+// there are no more members to try
+func nextStep(p Profile, step string) (int, bool) {
+	g := p.ringGroup()
+	if g.Strategy != RingSequential || len(step) == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(step)
+	if err != nil || n < 1 || n >= len(g.Members) {
+		return 0, false
+	}
+	return n, true
+}
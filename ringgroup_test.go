@@ -0,0 +1,105 @@
+package main_test
+
+import (
+	"net/url"
+	"path/filepath"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ring groups", func() {
+	var f *fixture
+	var blocklist *Blocklist
+
+	BeforeEach(func() {
+		cfg := testConfig()
+		cfg.VoicemailScript = "Please leave a message"
+		cfg.Profiles = map[string]Profile{
+			"+15550002222": {
+				Name:        "support",
+				DialTimeout: 20,
+				RingGroup: &RingGroup{Strategy: RingSequential, Members: []RingMember{
+					{Number: "+15552221111", Timeout: 10},
+					{Number: "+15552222222"},
+					{Number: "+15552223333", Timeout: 30, Screen: true},
+				}},
+			},
+			"+15550001111": {
+				Name:        "sales",
+				DialTimeout: 25,
+				RingGroup: &RingGroup{Members: []RingMember{
+					{Number: "+15551111111"},
+					{Number: "+15551112222", Timeout: 5},
+				}},
+			},
+		}
+		f = newFixture(cfg)
+		var err error
+		blocklist, err = OpenBlocklist(f.cfg, filepath.Join(f.dir, "blocklist.json"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		f.close()
+	})
+
+	call := func(to string, extra ...string) url.Values {
+		form := url.Values{"CallSid": {"CA123"}, "From": {"+15557654321"}, "To": {to}, "CallStatus": {twiml.Ringing}}
+		for i := 0; i < len(extra); i += 2 {
+			form.Set(extra[i], extra[i+1])
+		}
+		return form
+	}
+	dialed := func(target string, to string, status string) string {
+		form := call(to, "CallStatus", twiml.InProgress, "DialCallSid", "CA456", "DialCallStatus", status)
+		return postForm(DialAction(f.cfg, NewScreening(f.cfg), f.calls), target, form)
+	}
+
+	It("rings the first member of a sequential group for its own timeout", func() {
+		res := postForm(CallRequest(f.cfg, blocklist, f.calls), "/call/", call("+15550002222"))
+		Expect(res).To(ContainSubstring(`<Dial action="/call/action/?step=1" timeout="10" callerId="+15550002222">+15552221111</Dial>`))
+	})
+
+	DescribeTable("moving on when a member doesn't answer",
+		func(target string, status string, expected string) {
+			Expect(dialed(target, "+15550002222", status)).To(ContainSubstring(expected))
+		},
+		Entry("no answer from the first member rings the second for the profile's timeout", "/call/action/?step=1", twiml.NoAnswer,
+			`<Dial action="/call/action/?step=2" timeout="20" callerId="+15550002222">+15552222222</Dial>`),
+		Entry("busy second member rings the third with screening", "/call/action/?step=2", twiml.Busy,
+			`<Dial action="/call/action/?step=3" timeout="30" callerId="+15550002222"><Number url="`),
+		Entry("failed second member", "/call/action/?step=2", twiml.Failed, `+15552223333</Number>`),
+		Entry("no answer from the last member goes to voicemail", "/call/action/?step=3", twiml.NoAnswer,
+			`<Say voice="woman">Please leave a message</Say>`),
+		Entry("a step past the end goes to voicemail", "/call/action/?step=7", twiml.NoAnswer, "<Record"),
+		Entry("a step that isn't a number goes to voicemail", "/call/action/?step=two", twiml.NoAnswer, "<Record"),
+		Entry("a dial without a step goes to voicemail", "/call/action/", twiml.NoAnswer, "<Record"),
+	)
+
+	It("stops when a member answers", func() {
+		Expect(dialed("/call/action/?step=1", "+15550002222", twiml.Completed)).To(BeEmpty())
+	})
+
+	It("rings every member of a simultaneous group for the profile's timeout", func() {
+		res := postForm(CallRequest(f.cfg, blocklist, f.calls), "/call/", call("+15550001111"))
+		Expect(res).To(ContainSubstring(`<Dial action="action/" timeout="25" callerId="+15550001111"><Number>+15551111111</Number><Number>+15551112222</Number></Dial>`))
+	})
+
+	It("sends a simultaneous group to voicemail without trying the members again", func() {
+		res := dialed("/call/action/?step=1", "+15550001111", twiml.NoAnswer)
+		Expect(res).ToNot(ContainSubstring("<Dial"))
+		Expect(res).To(ContainSubstring("<Record"))
+	})
+
+	It("fills in member timeouts from the profile", func() {
+		p := f.cfg.Profile("+15550002222")
+		Expect(p.RingGroup.Members[0].Timeout).To(Equal(10))
+		Expect(p.RingGroup.Members[1].Timeout).To(Equal(20))
+		Expect(p.ForwardingNumbers).To(Equal([]string{"+15552221111", "+15552222222", "+15552223333"}))
+	})
+})
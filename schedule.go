@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// After hours actions
+const (
+	AfterHoursVoicemail = "voicemail"
+	AfterHoursMessage   = "message"
+	AfterHoursForward   = "forward"
+)
+
+// Schedule holds the business hours of a virtual number.  Hours are listed for each day of the
+// week as ranges like "09:00-17:00" in the schedule's time zone, and the number is closed all
+// day on holidays listed as dates like "2017-12-25".  A range that ends before it starts, like
+// "22:00-06:00", runs past midnight into the next day.
+type Schedule struct {
+	TimeZone   string              `json:"time_zone"`
+	Hours      map[string][]string `json:"hours"`
+	Holidays   []string            `json:"holidays"`
+	AfterHours AfterHours          `json:"after_hours"`
+
+	location *time.Location
+	open     map[time.Weekday][]hoursRange
+	holidays map[string]bool
+}
+
+// AfterHours is what happens to calls outside business hours.  Action is one of voicemail, to
+// send the caller straight to voicemail, message, to play Message then hang up, or forward, to
+// ring ForwardingNumber instead.
+type AfterHours struct {
+	Action           string `json:"action"`
+	Message          string `json:"message"`
+	ForwardingNumber string `json:"forwarding_number"`
+}
+
+// hoursRange is a range of minutes after midnight
+type hoursRange struct {
+	start int
+	end   int
+}
+
+var weekdays = map[string][]time.Weekday{
+	"sunday":    {time.Sunday},
+	"monday":    {time.Monday},
+	"tuesday":   {time.Tuesday},
+	"wednesday": {time.Wednesday},
+	"thursday":  {time.Thursday},
+	"friday":    {time.Friday},
+	"saturday":  {time.Saturday},
+	"weekdays":  {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends":  {time.Saturday, time.Sunday},
+}
+
+// Compile checks the schedule and prepares it to be evaluated.  It must be called before Open.
+func (s *Schedule) Compile() (errors []error) {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("time_zone: unknown time zone %q", s.TimeZone))
+		loc = time.UTC
+	}
+	s.location = loc
+
+	s.open = make(map[time.Weekday][]hoursRange)
+	for day, ranges := range s.Hours {
+		days, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			errors = append(errors, fmt.Errorf("hours: %q is not a day of the week", day))
+			continue
+		}
+		for _, r := range ranges {
+			hr, err := parseHoursRange(r)
+			if err != nil {
+				errors = append(errors, fmt.Errorf("hours.%s: %s", day, err))
+				continue
+			}
+			for _, d := range days {
+				if hr.end > hr.start {
+					s.open[d] = append(s.open[d], hr)
+					continue
+				}
+				next := (d + 1) % 7
+				s.open[d] = append(s.open[d], hoursRange{start: hr.start, end: 24 * 60})
+				s.open[next] = append(s.open[next], hoursRange{start: 0, end: hr.end})
+			}
+		}
+	}
+
+	s.holidays = make(map[string]bool)
+	for _, h := range s.Holidays {
+		if _, err := time.Parse("2006-01-02", h); err != nil {
+			errors = append(errors, fmt.Errorf("holidays: %q is not a date like 2017-12-25", h))
+			continue
+		}
+		s.holidays[h] = true
+	}
+
+	switch s.AfterHours.Action {
+	case "":
+		s.AfterHours.Action = AfterHoursVoicemail
+	case AfterHoursVoicemail:
+	case AfterHoursMessage:
+		if len(s.AfterHours.Message) == 0 {
+			s.AfterHours.Message = "Sorry, we're closed right now. Please call back during business hours."
+		}
+	case AfterHoursForward:
+		if len(s.AfterHours.ForwardingNumber) == 0 {
+			errors = append(errors, fmt.Errorf("after_hours.forwarding_number: required to forward calls after hours"))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("after_hours.action: must be %s, %s or %s", AfterHoursVoicemail, AfterHoursMessage, AfterHoursForward))
+	}
+	return
+}
+
+// Open returns true if t is within business hours
+func (s *Schedule) Open(t time.Time) bool {
+	local := t.In(s.location)
+	if s.holidays[local.Format("2006-01-02")] {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	for _, r := range s.open[local.Weekday()] {
+		if minute >= r.start && minute < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHoursRange parses a range of hours like "09:00-17:00".  The end is before the start for a
+// range that runs past midnight.
+func parseHoursRange(r string) (hoursRange, error) {
+	parts := strings.Split(r, "-")
+	if len(parts) != 2 {
+		return hoursRange{}, fmt.Errorf("%q is not a range of hours like 09:00-17:00", r)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return hoursRange{}, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return hoursRange{}, err
+	}
+	if start == 24*60 {
+		return hoursRange{}, fmt.Errorf("%q starts at the end of the day", r)
+	}
+	if end == 0 {
+		end = 24 * 60
+	}
+	if end == start {
+		return hoursRange{}, fmt.Errorf("%q ends when it starts", r)
+	}
+	return hoursRange{start: start, end: end}, nil
+}
+
+// parseClock parses a time of day like "17:30" into minutes after midnight.  24:00 is allowed as
+// the end of the day.
+func parseClock(c string) (int, error) {
+	c = strings.TrimSpace(c)
+	if c == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", c)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 17:30", c)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// afterHours returns the TwiML for a call outside the business hours of the profile
+func afterHours(p Profile, callerID string) []twiml.Markup {
+	switch p.Schedule.AfterHours.Action {
+	case AfterHoursMessage:
+		return []twiml.Markup{
+			&twiml.Say{Voice: "woman", Text: p.Schedule.AfterHours.Message},
+			&twiml.Hangup{},
+		}
+	case AfterHoursForward:
+		return []twiml.Markup{&twiml.Dial{
+			Number:   p.Schedule.AfterHours.ForwardingNumber,
+			Action:   p.withMailbox("action/"),
+			Timeout:  p.DialTimeout,
+			CallerID: callerID,
+		}}
+	default:
+		return voicemailPrompt(p)
+	}
+}
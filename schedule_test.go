@@ -0,0 +1,92 @@
+package main_test
+
+import (
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schedule", func() {
+	var schedule *Schedule
+
+	BeforeEach(func() {
+		schedule = &Schedule{
+			TimeZone: "America/New_York",
+			Hours: map[string][]string{
+				"weekdays": {"09:00-12:00", "13:00-17:30"},
+				"saturday": {"10:00-14:00"},
+			},
+			Holidays: []string{"2017-12-25"},
+		}
+		Expect(schedule.Compile()).To(BeEmpty())
+	})
+
+	DescribeTable("Open",
+		func(at string, open bool) {
+			t, err := time.Parse(time.RFC3339, at)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Open(t)).To(Equal(open))
+		},
+		Entry("weekday morning", "2017-12-20T09:00:00-05:00", true),
+		Entry("weekday before opening", "2017-12-20T08:59:00-05:00", false),
+		Entry("weekday lunch break", "2017-12-20T12:30:00-05:00", false),
+		Entry("weekday just before closing", "2017-12-20T17:29:00-05:00", true),
+		Entry("weekday at closing", "2017-12-20T17:30:00-05:00", false),
+		Entry("weekday at 3am", "2017-12-20T03:00:00-05:00", false),
+		Entry("in another time zone", "2017-12-20T15:00:00Z", true),
+		Entry("open in UTC but closed locally", "2017-12-20T23:00:00Z", false),
+		Entry("saturday", "2017-12-23T11:00:00-05:00", true),
+		Entry("sunday", "2017-12-24T11:00:00-05:00", false),
+		Entry("holiday", "2017-12-25T10:00:00-05:00", false),
+	)
+
+	Describe("overnight hours", func() {
+		BeforeEach(func() {
+			schedule = &Schedule{
+				TimeZone: "UTC",
+				Hours: map[string][]string{
+					"friday":   {"22:00-06:00"},
+					"saturday": {"18:00-00:00"},
+				},
+			}
+			Expect(schedule.Compile()).To(BeEmpty())
+		})
+
+		DescribeTable("Open",
+			func(at string, open bool) {
+				t, err := time.Parse(time.RFC3339, at)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(schedule.Open(t)).To(Equal(open))
+			},
+			Entry("friday before opening", "2017-12-22T21:59:00Z", false),
+			Entry("friday night", "2017-12-22T23:00:00Z", true),
+			Entry("saturday after midnight", "2017-12-23T00:30:00Z", true),
+			Entry("saturday at closing", "2017-12-23T06:00:00Z", false),
+			Entry("saturday evening until midnight", "2017-12-23T23:59:00Z", true),
+			Entry("sunday after midnight", "2017-12-24T00:30:00Z", false),
+			Entry("thursday night", "2017-12-21T23:00:00Z", false),
+		)
+	})
+
+	It("defaults the after hours action to voicemail", func() {
+		Expect(schedule.AfterHours.Action).To(Equal(AfterHoursVoicemail))
+	})
+
+	DescribeTable("Compile errors",
+		func(s Schedule, expected string) {
+			Expect(s.Compile()).To(ContainElement(MatchError(MatchRegexp(expected))))
+		},
+		Entry("unknown time zone", Schedule{TimeZone: "Mars/Olympus_Mons"}, "time_zone: unknown time zone"),
+		Entry("unknown day", Schedule{Hours: map[string][]string{"caturday": {"09:00-17:00"}}}, `hours: "caturday" is not a day`),
+		Entry("malformed range", Schedule{Hours: map[string][]string{"monday": {"9am to 5pm"}}}, "hours.monday: .* is not a range"),
+		Entry("empty range", Schedule{Hours: map[string][]string{"monday": {"09:00-09:00"}}}, "hours.monday: .* ends when it starts"),
+		Entry("range starting at the end of the day", Schedule{Hours: map[string][]string{"monday": {"24:00-06:00"}}}, "hours.monday: .* starts at the end of the day"),
+		Entry("malformed holiday", Schedule{Holidays: []string{"Christmas"}}, "holidays: .* is not a date"),
+		Entry("unknown action", Schedule{AfterHours: AfterHours{Action: "panic"}}, "after_hours.action: must be"),
+		Entry("forward without a number", Schedule{AfterHours: AfterHours{Action: AfterHoursForward}}, "after_hours.forwarding_number: required"),
+	)
+})
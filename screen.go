@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BTBurke/twiml"
+)
+
+// ScreenRequest represents the request Twilio makes for the forwarded leg of a call when it is
+// answered and when the callee responds to the screening prompt
+type ScreenRequest struct {
+	GatherActionRequest
+	ParentCallSid string
+}
+
+// Screening remembers the forwarded legs that were declined during screening until the dial
+// action for the call comes in.  Legs are kept by their own CallSid rather than the caller's, so
+// that when one member of a group declines and another accepts, the call is still connected.
+type Screening struct {
+	mu       sync.Mutex
+	declined map[string]time.Time
+	now      func() time.Time
+}
+
+// NewScreening returns an empty set of declined calls
+func NewScreening(cfg Config) *Screening {
+	return &Screening{declined: make(map[string]time.Time), now: cfg.now}
+}
+
+// Decline records that the forwarded leg was declined by the callee
+func (s *Screening) Decline(callSid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for sid, at := range s.declined {
+		if now.Sub(at) > time.Hour {
+			delete(s.declined, sid)
+		}
+	}
+	s.declined[callSid] = now
+}
+
+// Declined returns true if the forwarded leg was declined, and forgets about it
+func (s *Screening) Declined(callSid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.declined[callSid]
+	delete(s.declined, callSid)
+	return ok
+}
+
+// screenURL returns the URL Twilio fetches when a screened member answers, carrying the details
+// of the original call since the forwarded leg only knows the virtual number
+func screenURL(cfg Config, call twiml.VoiceRequest) string {
+	v := url.Values{}
+	v.Set("caller", call.From)
+	v.Set("name", call.CallerName)
+	v.Set("called", cfg.Profile(call.To).Name)
+	if v.Get("called") == "default" {
+		v.Set("called", call.To)
+	}
+	return "/call/screen?" + v.Encode()
+}
+
+// Screen whispers who is calling to the person answering a forwarded call and asks them to press
+// 1 to accept it
+func Screen(cfg Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sr ScreenRequest
+		if err := twiml.Bind(&sr, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		q := r.URL.Query()
+		caller := q.Get("name")
+		if len(caller) == 0 {
+			caller = sayNumber(q.Get("caller"))
+		}
+		called := q.Get("called")
+		if len(digitsOnly(called)) > 0 {
+			called = sayNumber(called)
+		}
+
+		res := twiml.NewResponse()
+		g := twiml.Gather{
+			Action:    "/call/screen/answer",
+			NumDigits: 1,
+			Timeout:   5,
+		}
+		g.Add(&twiml.Say{Voice: "woman", Text: fmt.Sprintf("Call from %s to %s. Press 1 to accept.", caller, called)})
+		res.Add(&g, &twiml.Redirect{URL: "/call/screen/answer"})
+		writeResponse(w, r, res)
+	}
+}
+
+// ScreenAnswer connects the call if the callee pressed 1.  Anything else, including no input,
+// declines the call on this phone.  Other phones in the group keep ringing, and if none of them
+// accept the call falls through to the dial action and voicemail.
+func ScreenAnswer(cfg Config, screening *Screening) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sr ScreenRequest
+		if err := twiml.Bind(&sr, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		res := twiml.NewResponse()
+		if sr.Digits == "1" {
+			res.Add(&twiml.Say{Voice: "woman", Text: "Connecting."})
+			writeResponse(w, r, res)
+			return
+		}
+		requestLog(r).Info("Call declined during screening", "call_sid", sr.CallSid, "parent_call_sid", sr.ParentCallSid, "number", sr.To)
+		screening.Decline(sr.CallSid)
+		res.Add(&twiml.Hangup{})
+		writeResponse(w, r, res)
+	}
+}
+
+// sayNumber spaces out the digits of a phone number so they are read one at a time
+func sayNumber(number string) string {
+	d := digitsOnly(number)
+	if len(d) == 0 {
+		return "an unknown number"
+	}
+	return strings.Join(strings.Split(d, ""), " ")
+}
@@ -0,0 +1,118 @@
+package main_test
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twiml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Call screening", func() {
+	var f *fixture
+	var screening *Screening
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2017, 12, 20, 9, 30, 0, 0, time.UTC)
+		cfg := testConfig()
+		cfg.VoicemailScript = "Please leave a message"
+		cfg.Profiles = map[string]Profile{
+			"+15550001111": {
+				Name: "sales",
+				RingGroup: &RingGroup{Members: []RingMember{
+					{Number: "+15551111111", Screen: true},
+					{Number: "+15551112222", Screen: true},
+				}},
+			},
+		}
+		cfg.Now = func() time.Time { return now }
+		f = newFixture(cfg)
+		screening = NewScreening(f.cfg)
+	})
+
+	AfterEach(func() {
+		f.close()
+	})
+
+	// leg is the forwarded leg of the call CA123 to a member of the ring group
+	leg := func(callSid string, to string, digits string) url.Values {
+		return url.Values{
+			"CallSid":       {callSid},
+			"ParentCallSid": {"CA123"},
+			"From":          {"+15550001111"},
+			"To":            {to},
+			"CallStatus":    {twiml.InProgress},
+			"Digits":        {digits},
+		}
+	}
+	// dialed is the dial action of the call CA123 with the leg that was bridged
+	dialed := func(dialCallSid string) string {
+		form := url.Values{
+			"CallSid":        {"CA123"},
+			"From":           {"+15557654321"},
+			"To":             {"+15550001111"},
+			"CallStatus":     {twiml.InProgress},
+			"DialCallSid":    {dialCallSid},
+			"DialCallStatus": {twiml.Completed},
+		}
+		return postForm(DialAction(f.cfg, screening, f.calls), "/call/action/", form)
+	}
+
+	It("tells the person answering who is calling and which number they called", func() {
+		res := postForm(Screen(f.cfg), "/call/screen?caller=%2B15557654321&called=sales", leg("CA456", "+15551111111", ""))
+		Expect(res).To(ContainSubstring("Call from 1 5 5 5 7 6 5 4 3 2 1 to sales. Press 1 to accept."))
+		Expect(res).To(ContainSubstring(`<Gather action="/call/screen/answer" timeout="5" numDigits="1">`))
+		Expect(res).To(ContainSubstring("<Redirect>/call/screen/answer</Redirect>"))
+	})
+
+	It("uses the caller's name and reads out a called number without a profile", func() {
+		res := postForm(Screen(f.cfg), "/call/screen?caller=%2B15557654321&name=Jane+Doe&called=%2B15550009999", leg("CA456", "+15551111111", ""))
+		Expect(res).To(ContainSubstring("Call from Jane Doe to 1 5 5 5 0 0 0 9 9 9 9."))
+	})
+
+	It("connects the call when 1 is pressed", func() {
+		res := postForm(ScreenAnswer(f.cfg, screening), "/call/screen/answer", leg("CA456", "+15551111111", "1"))
+		Expect(res).To(ContainSubstring("Connecting."))
+		Expect(res).ToNot(ContainSubstring("<Hangup"))
+		Expect(dialed("CA456")).To(BeEmpty())
+	})
+
+	It("hangs up the leg and sends the caller to voicemail when the call is declined", func() {
+		res := postForm(ScreenAnswer(f.cfg, screening), "/call/screen/answer", leg("CA456", "+15551111111", "2"))
+		Expect(res).To(ContainSubstring("<Hangup>"))
+		Expect(dialed("CA456")).To(ContainSubstring("<Record"))
+
+		records := f.calls.Records()
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].DialCallStatus).To(Equal(twiml.NoAnswer))
+		Expect(records[0].Outcome).ToNot(Equal(OutcomeAnswered))
+	})
+
+	It("declines when nothing is pressed", func() {
+		postForm(ScreenAnswer(f.cfg, screening), "/call/screen/answer", leg("CA456", "+15551111111", ""))
+		Expect(screening.Declined("CA456")).To(BeTrue())
+		Expect(screening.Declined("CA123")).To(BeFalse())
+	})
+
+	It("forgets declined legs after an hour", func() {
+		screening.Decline("CA456")
+		now = now.Add(61 * time.Minute)
+		screening.Decline("CA789")
+		Expect(screening.Declined("CA456")).To(BeFalse())
+		Expect(screening.Declined("CA789")).To(BeTrue())
+	})
+
+	It("connects the call when one member declines and another accepts", func() {
+		postForm(ScreenAnswer(f.cfg, screening), "/call/screen/answer", leg("CA456", "+15551111111", "2"))
+		postForm(ScreenAnswer(f.cfg, screening), "/call/screen/answer", leg("CA789", "+15551112222", "1"))
+		Expect(dialed("CA789")).To(BeEmpty())
+
+		records := f.calls.Records()
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].Outcome).To(Equal(OutcomeAnswered))
+	})
+})
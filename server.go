@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Server serves the webhooks on the listen address of the config, over TLS when a certificate
+// is configured
+type Server struct {
+	// ShutdownTimeout is how long to wait for requests in progress to finish when shutting down
+	ShutdownTimeout time.Duration
+
+	http  *http.Server
+	certs *certReloader
+}
+
+// NewServer returns a server for the handler, loading the TLS certificate if there is one
+func NewServer(cfg Config, handler http.Handler) (*Server, error) {
+	s := &Server{
+		ShutdownTimeout: 30 * time.Second,
+		http:            &http.Server{Addr: cfg.ListenAddr, Handler: handler},
+	}
+	if len(cfg.TLSCertFile) > 0 {
+		s.certs = &certReloader{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+		if err := s.certs.reload(); err != nil {
+			return nil, err
+		}
+		s.http.TLSConfig = &tls.Config{GetCertificate: s.certs.GetCertificate}
+	}
+	return s, nil
+}
+
+// ListenAndServe listens on the listen address and serves requests until the server is shut
+// down, when it returns nil
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves requests on the listener until the server is shut down, when it returns nil
+func (s *Server) Serve(l net.Listener) error {
+	var err error
+	if s.certs != nil {
+		logger.Info("Listening", "addr", l.Addr(), "tls", true)
+		err = s.http.ServeTLS(l, "", "")
+	} else {
+		logger.Info("Listening", "addr", l.Addr())
+		err = s.http.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the requests in progress to finish, up to
+// the shutdown timeout
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	return s.http.Shutdown(ctx)
+}
+
+// certReloader serves the certificate in the certificate and key files, loading them again when
+// either changes so that a renewed certificate is used without restarting the server
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// GetCertificate returns the latest certificate for a TLS handshake.  If the files have changed
+// but can't be loaded, such as while they're being replaced, the previous certificate is used.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := c.reload(); err != nil {
+		logger.Error("Unable to reload TLS certificate", "file", c.certFile, "error", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
+
+// reload loads the certificate if it hasn't been loaded or the files have changed since
+func (c *certReloader) reload() error {
+	var modified time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && modified.Equal(c.modified) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if c.cert != nil {
+		logger.Info("Reloaded TLS certificate", "file", c.certFile)
+	}
+	c.cert, c.modified = &cert, modified
+	return nil
+}
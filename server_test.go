@@ -0,0 +1,129 @@
+package main_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var dir string
+	var listener net.Listener
+	var served chan error
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "server")
+		Expect(err).ToNot(HaveOccurred())
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		served = make(chan error, 1)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	})
+
+	// writeCertificate writes a new certificate and its key, dated some time from now so that
+	// the change is seen even on file systems with coarse timestamps
+	writeCertificate := func(certFile string, keyFile string, age time.Duration) []byte {
+		cert, caFile := testCertificate(dir)
+		Expect(os.Rename(caFile, certFile)).To(Succeed())
+		der, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)).To(Succeed())
+		for _, file := range []string{certFile, keyFile} {
+			Expect(os.Chtimes(file, time.Now().Add(age), time.Now().Add(age))).To(Succeed())
+		}
+		return cert.Certificate[0]
+	}
+
+	// servedCertificate returns the certificate the server presents to a new connection
+	servedCertificate := func() []byte {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get("https://" + listener.Addr().String() + "/")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(200))
+		return resp.TLS.PeerCertificates[0].Raw
+	}
+
+	It("serves over TLS and picks up a renewed certificate", func() {
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		first := writeCertificate(certFile, keyFile, 0)
+		_, err := NewServer(Config{TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: keyFile}, http.NotFoundHandler())
+		Expect(err).To(HaveOccurred())
+		server, err := NewServer(Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		Expect(err).ToNot(HaveOccurred())
+		go func() { served <- server.Serve(listener) }()
+		Expect(servedCertificate()).To(Equal(first))
+
+		renewed := writeCertificate(certFile, keyFile, time.Minute)
+		Expect(servedCertificate()).To(Equal(renewed))
+
+		Expect(ioutil.WriteFile(keyFile, []byte("half written"), 0600)).To(Succeed())
+		Expect(os.Chtimes(keyFile, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))).To(Succeed())
+		Expect(servedCertificate()).To(Equal(renewed))
+
+		Expect(server.Shutdown()).To(Succeed())
+		Eventually(served).Should(Receive(BeNil()))
+	})
+
+	It("finishes the requests in progress when shutting down", func() {
+		started, release := make(chan struct{}), make(chan struct{})
+		server, err := NewServer(Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("done"))
+		}))
+		Expect(err).ToNot(HaveOccurred())
+		go func() { served <- server.Serve(listener) }()
+
+		responses := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			resp, err := http.Get("http://" + listener.Addr().String() + "/")
+			Expect(err).ToNot(HaveOccurred())
+			responses <- resp
+		}()
+		Eventually(started).Should(BeClosed())
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- server.Shutdown() }()
+		Consistently(stopped, 100*time.Millisecond).ShouldNot(Receive())
+		_, err = http.Get("http://" + listener.Addr().String() + "/")
+		Expect(err).To(HaveOccurred())
+
+		close(release)
+		Eventually(stopped).Should(Receive(BeNil()))
+		Eventually(served).Should(Receive(BeNil()))
+		var resp *http.Response
+		Eventually(responses).Should(Receive(&resp))
+		body, _ := ioutil.ReadAll(resp.Body)
+		Expect(string(body)).To(Equal("done"))
+	})
+
+	It("requires both the certificate and the key for TLS", func() {
+		cfg := testConfig()
+		cfg.TLSCertFile = "cert.pem"
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("TLS_KEY_FILE"))))
+		cfg.TLSCertFile, cfg.ListenAddr = "", "8080"
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("LISTEN_ADDR"))))
+	})
+})
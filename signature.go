@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Signature modes control what happens when a webhook fails verification
+const (
+	SignatureEnforce = "enforce"
+	SignatureLogOnly = "log"
+)
+
+// Signature computes the value Twilio sends in the X-Twilio-Signature header for a request
+// to the full URL u with the POST parameters params
+func Signature(authToken string, u string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBufferString(u)
+	for _, k := range keys {
+		values := append([]string(nil), params[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			buf.WriteString(k)
+			buf.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write(buf.Bytes())
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature is middleware that rejects webhook requests which were not signed by Twilio
+// with the configured auth token.  In log-only mode failures are logged and the request continues.
+func VerifySignature(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, http.StatusText(400), 400)
+				return
+			}
+			u := ExternalURL(cfg, r)
+			expected := Signature(cfg.TwilioAuthToken, u, r.PostForm)
+			actual := r.Header.Get("X-Twilio-Signature")
+			if !hmac.Equal([]byte(expected), []byte(actual)) {
+				if cfg.SignatureMode == SignatureLogOnly {
+					requestLog(r).Warn("Invalid Twilio signature, allowing request in log-only mode", "url", u)
+					next.ServeHTTP(w, r)
+					return
+				}
+				requestLog(r).Warn("Rejected request with invalid Twilio signature", "url", u)
+				http.Error(w, http.StatusText(403), 403)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ExternalURL reconstructs the URL that Twilio used to reach this server.  When PublicURL is set
+// it is used as the base, otherwise the scheme and host are taken from proxy headers set by ngrok
+// or a reverse proxy, falling back to the request itself.
+func ExternalURL(cfg Config, r *http.Request) string {
+	if len(cfg.PublicURL) > 0 {
+		return strings.TrimRight(cfg.PublicURL, "/") + r.URL.RequestURI()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); len(proto) > 0 {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); len(fwd) > 0 {
+		host = strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return scheme + "://" + host + r.URL.RequestURI()
+}
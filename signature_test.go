@@ -0,0 +1,103 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signature", func() {
+	callParams := url.Values{
+		"CallSid":    {"CA1234567890ABCDE"},
+		"CallStatus": {"ringing"},
+		"From":       {"+15551234567"},
+		"To":         {"+15557654321"},
+	}
+
+	DescribeTable("computes Twilio request signatures",
+		func(u string, params url.Values, expected string) {
+			Expect(Signature("12345", u, params)).To(Equal(expected))
+		},
+		Entry("Twilio documentation example", "https://mycompany.com/myapp.php?foo=1&bar=2", url.Values{
+			"CallSid": {"CA1234567890ABCDE"},
+			"Caller":  {"+12349013030"},
+			"Digits":  {"1234"},
+			"From":    {"+12349013030"},
+			"To":      {"+18005551212"},
+		}, "0/KCTR6DLpKmkAf8muzZqo1nDgQ="),
+		Entry("call webhook through ngrok", "https://60abbe91.ngrok.io/call/", callParams, "ff1dPynt70G3FneXWZhRU1dwOoY="),
+		Entry("call webhook on public URL", "https://voice.example.com/call/", callParams, "Y1fjjfauWy5aHUNGzZitWk88DFw="),
+		Entry("request with no parameters", "https://60abbe91.ngrok.io/call/", url.Values{}, "vhEap2/7goo0NGYrz3Ad0/AZZmk="),
+	)
+})
+
+var _ = Describe("VerifySignature", func() {
+	var cfg Config
+
+	BeforeEach(func() {
+		cfg = Config{
+			TwilioAuthToken: "12345",
+			SignatureMode:   SignatureEnforce,
+		}
+	})
+
+	type request struct {
+		headers   map[string]string
+		signature string
+	}
+
+	serve := func(req request) int {
+		body := "CallSid=CA1234567890ABCDE&CallStatus=ringing&From=%2B15551234567&To=%2B15557654321"
+		r := httptest.NewRequest("POST", "http://localhost:8080/call/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", req.signature)
+		for k, v := range req.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+		})
+		VerifySignature(cfg)(next).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	DescribeTable("in enforce mode",
+		func(publicURL string, req request, status int) {
+			cfg.PublicURL = publicURL
+			Expect(serve(req)).To(Equal(status))
+		},
+		Entry("accepts a direct request", "", request{
+			signature: "eomiSdwr0GVqp4e0JEhs6QcefEM=",
+		}, 200),
+		Entry("accepts a request forwarded by ngrok", "", request{
+			headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "60abbe91.ngrok.io",
+			},
+			signature: "ff1dPynt70G3FneXWZhRU1dwOoY=",
+		}, 200),
+		Entry("accepts a request signed for the configured public URL", "https://voice.example.com/", request{
+			signature: "Y1fjjfauWy5aHUNGzZitWk88DFw=",
+		}, 200),
+		Entry("rejects a request signed for a different URL", "https://voice.example.com", request{
+			signature: "ff1dPynt70G3FneXWZhRU1dwOoY=",
+		}, 403),
+		Entry("rejects a request with a bad signature", "", request{
+			signature: "not-a-signature",
+		}, 403),
+		Entry("rejects a request without a signature", "", request{}, 403),
+	)
+
+	It("allows invalid requests in log-only mode", func() {
+		cfg.SignatureMode = SignatureLogOnly
+		Expect(serve(request{signature: "not-a-signature"})).To(Equal(200))
+	})
+})
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BTBurke/twilio-voice/simulator"
+)
+
+// Simulate runs a call through the server with the simulator playing Twilio, and writes the
+// TwiML returned by each webhook and the notifications that were sent.  The server runs in
+// process with its state in a temporary directory, starting from a copy of the blocklist, and
+// its notifications are caught by the simulator instead of being delivered.
+func Simulate(w io.Writer, cfg Config, call simulator.Call) error {
+	dir, err := ioutil.TempDir("", "twilio-voice-simulate")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	blocklist := filepath.Join(dir, "blocklist.json")
+	if b, err := ioutil.ReadFile(cfg.BlocklistPath()); err == nil {
+		if err := ioutil.WriteFile(blocklist, b, 0600); err != nil {
+			return err
+		}
+	}
+	if len(cfg.TwilioAuthToken) == 0 {
+		cfg.TwilioAuthToken = "simulator"
+	}
+
+	twilio := simulator.New("", cfg.TwilioAuthToken)
+	defer twilio.Close()
+	cfg.BlocklistFile = blocklist
+	cfg.VoicemailDir = filepath.Join(dir, "voicemails")
+	cfg.CallLogFile = filepath.Join(dir, "calls.jsonl")
+	cfg.OutboxDir = filepath.Join(dir, "outbox")
+	cfg.PublicURL, cfg.AttachAudio = "", false
+	cfg.Notifiers = []NotifierConfig{{Type: NotifierWebhook, URL: twilio.NotifierURL()}}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	logger = NewLogger(os.Stderr, cfg)
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		return err
+	}
+	app.Missed.Wait = 0
+	app.Start()
+	defer app.Stop()
+	server := httptest.NewServer(app.Handler())
+	defer server.Close()
+	twilio.URL = server.URL
+
+	result, err := twilio.Call(call)
+	for _, step := range result.Steps {
+		u, _ := url.Parse(step.URL)
+		fmt.Fprintf(w, "POST %s", u.RequestURI())
+		for _, key := range []string{"CallStatus", "DialCallStatus", "Digits", "RecordingStatus", "TranscriptionText"} {
+			if v := step.Params.Get(key); len(v) > 0 {
+				fmt.Fprintf(w, " %s=%q", key, v)
+			}
+		}
+		fmt.Fprintf(w, "\n%d %s\n\n", step.Status, strings.TrimSpace(step.TwiML))
+	}
+	if err != nil {
+		return err
+	}
+	record, _ := app.Calls.Record(result.CallSid)
+	fmt.Fprintf(w, "Call %s ended %s, outcome %s\n", result.CallSid, result.Status, record.Outcome)
+
+	if err := waitForOutbox(cfg.OutboxPath(), 10*time.Second); err != nil {
+		return err
+	}
+	for _, n := range twilio.Notifications() {
+		fmt.Fprintf(w, "\nNotification %s for %s: %s\n%s\n", n.Kind, n.Mailbox, n.Subject, n.Text)
+	}
+	return nil
+}
+
+// waitForOutbox waits for the outbox to be sent, checking that it stays empty long enough for a
+// missed call to be queued after the call ends
+func waitForOutbox(dir string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	empty := 0
+	for empty < 2 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("notifications were still queued after %s", timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+		entries, err := ReadOutbox(dir)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			empty = 0
+			continue
+		}
+		empty++
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+	"github.com/BTBurke/twilio-voice/simulator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulated calls", func() {
+	var dir string
+	var cfg Config
+	var twilio *simulator.Twilio
+	var stop func()
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "simulate")
+		Expect(err).ToNot(HaveOccurred())
+		twilio = simulator.New("", "12345")
+		stop = func() {}
+		cfg = testConfig()
+		cfg.BlocklistFile = filepath.Join(dir, "blocklist.json")
+		cfg.VoicemailDir = filepath.Join(dir, "voicemails")
+		cfg.CallLogFile = filepath.Join(dir, "calls.jsonl")
+		cfg.OutboxDir = filepath.Join(dir, "outbox")
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierWebhook, URL: twilio.NotifierURL()}}
+		cfg.Profiles = map[string]Profile{
+			"+15550002222": {
+				Name: "support",
+				RingGroup: &RingGroup{Strategy: RingSequential, Members: []RingMember{
+					{Number: "+15550003333"},
+					{Number: "+15550004444", Screen: true},
+				}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		stop()
+		twilio.Close()
+		os.RemoveAll(dir)
+	})
+
+	// start runs the server for the config with the simulator pointed at it
+	start := func() *App {
+		Expect(cfg.Validate()).To(BeEmpty())
+		app, err := NewApp(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		app.Start()
+		server := httptest.NewServer(app.Handler())
+		stop = func() {
+			server.Close()
+			app.Stop()
+		}
+		twilio.URL = server.URL
+		return app
+	}
+
+	It("sends an unanswered call to voicemail and notifies with the transcript", func() {
+		app := start()
+		result, err := twilio.Call(simulator.Call{
+			From:       "+15557654321",
+			To:         "+15550001111",
+			Transcript: "Call me back about the invoice",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Verbs).To(Equal([]string{"Dial", "Say", "Record"}))
+
+		notifications, err := twilio.WaitForNotifications(1, 5*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(notifications).To(HaveLen(1))
+		Expect(notifications[0].Kind).To(Equal("voicemail"))
+		Expect(notifications[0].From).To(Equal("+15557654321"))
+		Expect(notifications[0].Transcript).To(Equal("Call me back about the invoice"))
+		Expect(notifications[0].RecordingURL).ToNot(BeEmpty())
+
+		call, ok := app.Calls.Record(result.CallSid)
+		Expect(ok).To(BeTrue())
+		Expect(call.Outcome).To(Equal(OutcomeVoicemail))
+	})
+
+	It("connects an answered call without a notification", func() {
+		app := start()
+		result, err := twilio.Call(simulator.Call{
+			From:         "+15557654321",
+			To:           "+15550001111",
+			DialStatuses: []string{"completed"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Verbs).To(Equal([]string{"Dial"}))
+		call, _ := app.Calls.Record(result.CallSid)
+		Expect(call.Outcome).To(Equal(OutcomeAnswered))
+		Expect(call.DialCallDuration).To(Equal(60))
+		Consistently(twilio.Notifications, 200*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("rejects a blocked caller", func() {
+		app := start()
+		Expect(app.Blocklist.Add(BlockRule{Pattern: "+15557654321", Action: BlockBusy})).To(Succeed())
+		result, err := twilio.Call(simulator.Call{From: "+15557654321", To: "+15550001111"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Verbs).To(Equal([]string{"Reject"}))
+		Expect(result.Status).To(Equal("busy"))
+		call, _ := app.Calls.Record(result.CallSid)
+		Expect(call.Outcome).To(Equal(OutcomeBlocked))
+	})
+
+	It("moves through a sequential ring group and takes a message when screening declines", func() {
+		start()
+		result, err := twilio.Call(simulator.Call{
+			From:         "+15557654321",
+			To:           "+15550002222",
+			DialStatuses: []string{"no-answer", "completed"},
+			ScreenDigits: []string{"2"},
+			Transcript:   "Is the shop open on Sunday?",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Verbs).To(Equal([]string{"Dial", "Dial", "Say", "Record"}))
+		var urls []string
+		for _, step := range result.Steps {
+			urls = append(urls, step.URL[len(twilio.URL):])
+		}
+		Expect(urls).To(ContainElement("/call/action/?step=1"))
+		Expect(urls).To(ContainElement("/call/screen/answer"))
+
+		notifications, err := twilio.WaitForNotifications(1, 5*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(notifications[0].Mailbox).To(Equal("support"))
+		Expect(notifications[0].Transcript).To(Equal("Is the shop open on Sunday?"))
+	})
+
+	It("prints the TwiML and notifications of a call from the command", func() {
+		cfg.LogLevel = LevelError
+		out := new(bytes.Buffer)
+		Expect(Simulate(out, cfg, simulator.Call{From: "+15557654321", To: "+15550001111", Transcript: "Running late"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`POST /call/action/ CallStatus="in-progress" DialCallStatus="no-answer"`))
+		Expect(out.String()).To(ContainSubstring("<Record"))
+		Expect(out.String()).To(ContainSubstring("outcome voicemail"))
+		Expect(out.String()).To(ContainSubstring("Notification voicemail for default"))
+	})
+})
@@ -0,0 +1,529 @@
+// Package simulator plays the part of Twilio against a running twilio-voice server, so that whole
+// calls can be tested without a phone.  It posts the incoming call webhook, reads the TwiML that
+// comes back and follows it the way Twilio would: dialing with a scripted outcome, pressing
+// digits at a Gather, and leaving a voicemail at a Record.  Notifications are caught by a
+// webhook receiver that the server under test is configured to send to.
+package simulator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxRequests is how many webhooks a call can make before the simulator gives up on it ending,
+// which catches a Redirect or menu that loops forever
+const MaxRequests = 50
+
+// Twilio sends webhooks to the server at URL, signed with the auth token, and receives the
+// notifications the server sends to NotifierURL
+type Twilio struct {
+	// URL is the base URL of the server, like http://localhost:8080
+	URL string
+	// StatusCallback is the path the final call status is posted to, or empty to not send it
+	StatusCallback string
+	// AccountSid is sent with every webhook
+	AccountSid string
+
+	authToken string
+	client    *http.Client
+	receiver  *httptest.Server
+
+	mu            sync.Mutex
+	notifications []Notification
+	received      chan struct{}
+}
+
+// Call is the script for a simulated call: who is calling, what happens to each Dial, and what
+// the caller does when asked
+type Call struct {
+	From        string
+	To          string
+	CallerName  string
+	FromCity    string
+	FromState   string
+	FromCountry string
+
+	// DialStatuses is the DialCallStatus of each Dial in turn, like completed, busy or
+	// no-answer.  Dials after the last are not answered.
+	DialStatuses []string
+	// TalkSeconds is how long an answered Dial lasts, 60 seconds by default
+	TalkSeconds int
+	// Digits are pressed by the caller at each Gather in turn.  A Gather after the last times
+	// out without any input.
+	Digits []string
+	// ScreenDigits are pressed by the person answering at each Gather of a screening prompt
+	ScreenDigits []string
+	// Transcript is what the caller says when a Record asks them to leave a message
+	Transcript string
+	// RecordingSeconds is the length of the message, 10 seconds by default
+	RecordingSeconds int
+}
+
+// Step is a webhook sent during a call and the response from the server
+type Step struct {
+	URL    string
+	Params url.Values
+	Status int
+	TwiML  string
+}
+
+// Result is what happened on a simulated call
+type Result struct {
+	CallSid string
+	// Status is the final status of the call, like completed or busy
+	Status string
+	// Steps are the webhooks in the order they were sent
+	Steps []Step
+	// Verbs are the names of the TwiML verbs the caller went through, like Say, Dial and Record
+	Verbs []string
+}
+
+// Notification is a notification the server sent to the webhook receiver
+type Notification struct {
+	Kind         string   `json:"kind"`
+	Mailbox      string   `json:"mailbox"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Subject      string   `json:"subject"`
+	Text         string   `json:"text"`
+	Transcript   string   `json:"transcript"`
+	RecordingURL string   `json:"recording_url"`
+	MediaURLs    []string `json:"media_urls"`
+}
+
+// Verb is an element of a TwiML response, with its attributes, text and nested nouns or verbs
+type Verb struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []Verb     `xml:",any"`
+}
+
+// Attr returns the value of an attribute, or an empty string if it isn't set
+func (v Verb) Attr(name string) string {
+	for _, a := range v.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// New returns a simulator for the server at serverURL that signs webhooks with the auth token,
+// and starts its notification receiver.  Close it when finished.
+func New(serverURL string, authToken string) *Twilio {
+	t := &Twilio{
+		URL:            strings.TrimRight(serverURL, "/"),
+		StatusCallback: "/status",
+		AccountSid:     "AC" + newSid(),
+		authToken:      authToken,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		received:       make(chan struct{}, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notify", t.receive)
+	mux.HandleFunc("/recordings/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3 simulated recording"))
+	})
+	t.receiver = httptest.NewServer(mux)
+	return t
+}
+
+// Close stops the notification receiver
+func (t *Twilio) Close() {
+	t.receiver.Close()
+}
+
+// NotifierURL is the URL to configure as a webhook notifier on the server, so that its
+// notifications are received by the simulator
+func (t *Twilio) NotifierURL() string {
+	return t.receiver.URL + "/notify"
+}
+
+// Notifications returns the notifications received so far
+func (t *Twilio) Notifications() []Notification {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Notification(nil), t.notifications...)
+}
+
+// WaitForNotifications waits until at least n notifications have been received, returning an
+// error with the ones received so far if they don't arrive within the timeout
+func (t *Twilio) WaitForNotifications(n int, timeout time.Duration) ([]Notification, error) {
+	deadline := time.After(timeout)
+	for {
+		received := t.Notifications()
+		if len(received) >= n {
+			return received, nil
+		}
+		select {
+		case <-t.received:
+		case <-deadline:
+			return received, fmt.Errorf("received %d notifications, expected %d", len(received), n)
+		}
+	}
+}
+
+func (t *Twilio) receive(w http.ResponseWriter, r *http.Request) {
+	var n Notification
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	t.mu.Lock()
+	t.notifications = append(t.notifications, n)
+	t.mu.Unlock()
+	select {
+	case t.received <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(200)
+}
+
+// Call runs a call through the server, starting with the incoming call webhook at /call/ and
+// following the TwiML until the call ends.  An error is returned if a webhook fails or the
+// TwiML can't be followed, along with the steps up to that point.
+func (t *Twilio) Call(c Call) (*Result, error) {
+	if c.TalkSeconds == 0 {
+		c.TalkSeconds = 60
+	}
+	if c.RecordingSeconds == 0 {
+		c.RecordingSeconds = 10
+	}
+	s := &session{
+		twilio: t,
+		call:   c,
+		result: &Result{CallSid: "CA" + newSid()},
+	}
+	s.params = url.Values{
+		"CallSid":     {s.result.CallSid},
+		"AccountSid":  {t.AccountSid},
+		"From":        {c.From},
+		"To":          {c.To},
+		"Direction":   {"inbound"},
+		"ApiVersion":  {"2010-04-01"},
+		"CallerName":  {c.CallerName},
+		"FromCity":    {c.FromCity},
+		"FromState":   {c.FromState},
+		"FromCountry": {c.FromCountry},
+	}
+	s.result.Status = "completed"
+	err := s.run(t.URL+"/call/", s.with("CallStatus", "ringing"))
+	if err == nil && len(t.StatusCallback) > 0 {
+		_, err = s.post(t.URL+t.StatusCallback, s.with(
+			"CallStatus", s.result.Status,
+			"CallDuration", strconv.Itoa(s.duration),
+		))
+	}
+	return s.result, err
+}
+
+// session is the state of a call in progress
+type session struct {
+	twilio   *Twilio
+	call     Call
+	params   url.Values
+	result   *Result
+	dials    int
+	digits   int
+	screens  int
+	duration int
+}
+
+// with returns the parameters of the call with extra parameters given as pairs of keys and
+// values
+func (s *session) with(kv ...string) url.Values {
+	v := url.Values{}
+	for k, values := range s.params {
+		v[k] = values
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		v.Set(kv[i], kv[i+1])
+	}
+	return v
+}
+
+// run posts a webhook and follows the TwiML it returns until the call ends
+func (s *session) run(u string, params url.Values) error {
+	for len(u) > 0 {
+		verbs, err := s.post(u, params)
+		if err != nil {
+			return err
+		}
+		u, params, err = s.follow(u, verbs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// follow goes through the verbs of a response, returning the webhook to send next, or an empty
+// URL when the call has ended
+func (s *session) follow(current string, verbs []Verb) (string, url.Values, error) {
+	for _, v := range verbs {
+		s.result.Verbs = append(s.result.Verbs, v.XMLName.Local)
+		switch v.XMLName.Local {
+		case "Say", "Play", "Pause":
+		case "Dial":
+			next, params, err := s.dial(current, v)
+			if err != nil || len(next) > 0 {
+				return next, params, err
+			}
+		case "Gather":
+			for _, child := range v.Children {
+				s.result.Verbs = append(s.result.Verbs, child.XMLName.Local)
+			}
+			if s.digits >= len(s.call.Digits) {
+				continue
+			}
+			digits := s.call.Digits[s.digits]
+			s.digits++
+			return resolve(current, v.Attr("action")), s.with("CallStatus", "in-progress", "Digits", digits), nil
+		case "Record":
+			return "", nil, s.record(current, v)
+		case "Redirect":
+			return resolve(current, strings.TrimSpace(v.Text)), s.with("CallStatus", "in-progress"), nil
+		case "Reject":
+			s.result.Status = "no-answer"
+			if v.Attr("reason") == "busy" {
+				s.result.Status = "busy"
+			}
+			return "", nil, nil
+		case "Hangup":
+			return "", nil, nil
+		default:
+			return "", nil, fmt.Errorf("simulator: %s is not supported", v.XMLName.Local)
+		}
+	}
+	return "", nil, nil
+}
+
+// dial rings the numbers of a Dial with the next scripted outcome, running the screening prompt
+// of the first number if it is answered, and returns the dial action to post if there is one.
+// The answered leg has the same sid in the screening prompt and the dial action, as it does
+// with Twilio.
+func (s *session) dial(current string, v Verb) (string, url.Values, error) {
+	status := "no-answer"
+	if s.dials < len(s.call.DialStatuses) {
+		status = s.call.DialStatuses[s.dials]
+	}
+	s.dials++
+	dialSid := "CA" + newSid()
+	duration := 0
+	if status == "completed" {
+		duration = s.call.TalkSeconds
+		s.duration += duration
+		for _, n := range v.Children {
+			if n.XMLName.Local != "Number" {
+				continue
+			}
+			if screen := n.Attr("url"); len(screen) > 0 {
+				if err := s.screen(current, screen, strings.TrimSpace(n.Text), dialSid); err != nil {
+					return "", nil, err
+				}
+			}
+			break
+		}
+	}
+	action := v.Attr("action")
+	if len(action) == 0 {
+		return "", nil, nil
+	}
+	return resolve(current, action), s.with(
+		"CallStatus", "in-progress",
+		"DialCallStatus", status,
+		"DialCallSid", dialSid,
+		"DialCallDuration", strconv.Itoa(duration),
+	), nil
+}
+
+// screen runs the TwiML for the forwarded leg of a call when the number answers, pressing the
+// scripted screening digits at each Gather
+func (s *session) screen(current string, screenURL string, number string, callSid string) error {
+	params := url.Values{
+		"CallSid":       {callSid},
+		"ParentCallSid": {s.result.CallSid},
+		"AccountSid":    {s.twilio.AccountSid},
+		"From":          {s.call.To},
+		"To":            {number},
+		"Direction":     {"outbound-dial"},
+		"CallStatus":    {"in-progress"},
+	}
+	u := resolve(current, screenURL)
+	for requests := 0; len(u) > 0; requests++ {
+		if requests > MaxRequests {
+			return fmt.Errorf("simulator: screening did not end after %d requests", MaxRequests)
+		}
+		verbs, err := s.post(u, params)
+		if err != nil {
+			return err
+		}
+		next := ""
+		for _, v := range verbs {
+			if v.XMLName.Local == "Gather" && s.screens < len(s.call.ScreenDigits) {
+				params.Set("Digits", s.call.ScreenDigits[s.screens])
+				s.screens++
+				next = resolve(u, v.Attr("action"))
+				break
+			}
+			if v.XMLName.Local == "Redirect" {
+				params.Del("Digits")
+				next = resolve(u, strings.TrimSpace(v.Text))
+				break
+			}
+			if v.XMLName.Local == "Hangup" {
+				break
+			}
+		}
+		u = next
+	}
+	return nil
+}
+
+// record leaves the scripted message and hangs up, sending the action, recording status and
+// transcription callbacks of the Record that are set
+func (s *session) record(current string, v Verb) error {
+	sid := "RE" + newSid()
+	recording := s.twilio.receiver.URL + "/recordings/" + sid
+	length := strconv.Itoa(s.call.RecordingSeconds)
+	s.duration += s.call.RecordingSeconds
+	if action := v.Attr("action"); len(action) > 0 {
+		_, err := s.post(resolve(current, action), s.with(
+			"CallStatus", "completed",
+			"RecordingUrl", recording,
+			"RecordingDuration", length,
+			"Digits", "hangup",
+		))
+		if err != nil {
+			return err
+		}
+	}
+	if callback := v.Attr("recordingStatusCallback"); len(callback) > 0 {
+		_, err := s.post(resolve(current, callback), url.Values{
+			"AccountSid":        {s.twilio.AccountSid},
+			"CallSid":           {s.result.CallSid},
+			"RecordingSid":      {sid},
+			"RecordingUrl":      {recording},
+			"RecordingStatus":   {"completed"},
+			"RecordingDuration": {length},
+			"RecordingChannels": {"1"},
+			"RecordingSource":   {"RecordVerb"},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	callback := v.Attr("transcribeCallback")
+	if len(callback) == 0 {
+		return nil
+	}
+	_, err := s.post(resolve(current, callback), s.with(
+		"CallStatus", "completed",
+		"TranscriptionSid", "TR"+newSid(),
+		"TranscriptionText", s.call.Transcript,
+		"TranscriptionStatus", "completed",
+		"RecordingSid", sid,
+		"RecordingUrl", recording,
+	))
+	return err
+}
+
+// post sends a signed webhook and parses the TwiML in the response, which is empty when the
+// server only acknowledged the webhook
+func (s *session) post(u string, params url.Values) ([]Verb, error) {
+	if len(s.result.Steps) >= MaxRequests {
+		return nil, fmt.Errorf("simulator: call did not end after %d requests", MaxRequests)
+	}
+	req, err := http.NewRequest("POST", u, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Twilio-Signature", Signature(s.twilio.authToken, u, params))
+	resp, err := s.twilio.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.result.Steps = append(s.result.Steps, Step{URL: u, Params: params, Status: resp.StatusCode, TwiML: string(body)})
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("simulator: %s returned %s", u, resp.Status)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var res struct {
+		Verbs []Verb `xml:",any"`
+	}
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("simulator: %s returned invalid TwiML: %s", u, err)
+	}
+	return res.Verbs, nil
+}
+
+// resolve returns the absolute URL of a URL in TwiML, which is relative to the URL of the
+// document it came from
+func resolve(current string, ref string) string {
+	base, err := url.Parse(current)
+	if err != nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// Signature computes the X-Twilio-Signature header for a webhook to the full URL u with the POST
+// parameters params
+func Signature(authToken string, u string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBufferString(u)
+	for _, k := range keys {
+		values := append([]string(nil), params[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			buf.WriteString(k)
+			buf.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write(buf.Bytes())
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newSid returns the random part of a Twilio SID
+func newSid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/BTBurke/twiml"
+)
+
+// MessageRequest represents the request Twilio makes to the messaging webhook when an SMS or MMS
+// is received by the virtual number
+type MessageRequest struct {
+	MessageSid          string
+	AccountSid          string
+	MessagingServiceSid string
+	From                string
+	To                  string
+	Body                string
+	NumMedia            int
+	FromCity            string
+	FromState           string
+	FromZip             string
+	FromCountry         string
+	MediaURLs           []string `schema:"-"`
+}
+
+// Correspondents remembers the last person who texted each virtual number so that replies from
+// the owner can be relayed back to them
+type Correspondents struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// NewCorrespondents returns an empty set of correspondents
+func NewCorrespondents() *Correspondents {
+	return &Correspondents{last: make(map[string]string)}
+}
+
+// Last returns the last correspondent of the virtual number
+func (c *Correspondents) Last(virtual string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	number, ok := c.last[virtual]
+	return number, ok
+}
+
+// Set records number as the last correspondent of the virtual number
+func (c *Correspondents) Set(virtual string, number string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last[virtual] = number
+}
+
+// addressedMessage matches a reply that names its recipient, like "@+15551234567: hello"
+var addressedMessage = regexp.MustCompile(`(?s)^\s*@([0-9+\-\(\)\. ]+):\s*(.*)$`)
+
+// Message handles incoming SMS and MMS.  Messages from other people are forwarded to the owner's
+// phone and email.  Messages from the owner are relayed to the last correspondent, or to the
+// correspondent addressed with a prefix like "@+15551234567:".
+func Message(cfg Config, contacts *Correspondents, outbox *Outbox) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg MessageRequest
+		if err := twiml.Bind(&msg, r); err != nil {
+			requestLog(r).Warn("Unable to read webhook", "error", err)
+			http.Error(w, http.StatusText(400), 400)
+			return
+		}
+		for i := 0; i < msg.NumMedia; i++ {
+			if u := r.PostForm.Get(fmt.Sprintf("MediaUrl%d", i)); len(u) > 0 {
+				msg.MediaURLs = append(msg.MediaURLs, u)
+			}
+		}
+
+		if cfg.IsOwner(msg.From) {
+			reply := relayReply(cfg, contacts, msg)
+			if len(reply.To) > 0 {
+				requestLog(r).Info("Relaying reply", "from", msg.From, "to", reply.To)
+			}
+			writeMessages(w, reply)
+			return
+		}
+
+		profile := cfg.Profile(msg.To)
+		contacts.Set(msg.To, msg.From)
+		requestLog(r).Info("Forwarding message", "from", msg.From, "to", profile.ForwardingNumbers[0], "body_length", utf8.RuneCountInString(msg.Body))
+		if err := outbox.SendMessage(cfg, profile, msg); err != nil {
+			requestLog(r).Error("Unable to queue message notification", "error", err)
+		}
+		writeMessages(w, &twiml.Sms{
+			To:   profile.ForwardingNumbers[0],
+			Text: withMedia(fmt.Sprintf("From %s: %s", msg.From, msg.Body), msg.MediaURLs),
+		})
+	}
+}
+
+// relayReply works out who the owner is replying to and builds the message to send them
+func relayReply(cfg Config, contacts *Correspondents, msg MessageRequest) *twiml.Sms {
+	body := msg.Body
+	to, ok := contacts.Last(msg.To)
+	if m := addressedMessage.FindStringSubmatch(msg.Body); m != nil {
+		number, err := NormalizeNumber(m[1], cfg.DefaultCountryCode)
+		if err != nil {
+			return &twiml.Sms{Text: fmt.Sprintf("Unable to send your message, %s", err)}
+		}
+		to, ok, body = number, true, m[2]
+		contacts.Set(msg.To, to)
+	}
+	if !ok {
+		return &twiml.Sms{Text: "There is no one to reply to. Start your message with @+15551234567: to send it to a new number."}
+	}
+	return &twiml.Sms{
+		To:   to,
+		Text: withMedia(body, msg.MediaURLs),
+	}
+}
+
+// withMedia appends links to any MMS media to the text of a message
+func withMedia(text string, mediaURLs []string) string {
+	if len(mediaURLs) == 0 {
+		return text
+	}
+	return text + "\n\n" + strings.Join(mediaURLs, "\n")
+}
+
+// messagingResponse is the TwiML response to a messaging webhook.  It is encoded separately from
+// twiml.Response which only accepts voice verbs.
+type messagingResponse struct {
+	XMLName  xml.Name `xml:"Response"`
+	Messages []*twiml.Sms
+}
+
+// writeMessages encodes the messages as a TwiML response and writes it back to Twilio
+func writeMessages(w http.ResponseWriter, msgs ...*twiml.Sms) {
+	for _, m := range msgs {
+		if err := m.Validate(); err != nil {
+			http.Error(w, http.StatusText(502), 502)
+			return
+		}
+	}
+	b, err := xml.MarshalIndent(messagingResponse{Messages: msgs}, "", "  ")
+	if err != nil {
+		http.Error(w, http.StatusText(502), 502)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(200)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
@@ -0,0 +1,93 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Text messages", func() {
+	var dir string
+	var cfg Config
+	var contacts *Correspondents
+	var outbox *Outbox
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sms")
+		Expect(err).ToNot(HaveOccurred())
+		cfg = testConfig()
+		cfg.ForwardingNumber = "+15551234567"
+		Expect(cfg.Validate()).To(BeEmpty())
+		contacts = NewCorrespondents()
+		outbox, err = NewOutbox(cfg, dir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// text posts a message to the virtual number and returns the TwiML response
+	text := func(form url.Values) string {
+		form.Set("MessageSid", "SM123")
+		form.Set("To", "+15550001111")
+		return postForm(Message(cfg, contacts, outbox), "/sms", form)
+	}
+
+	It("forwards a message to the owner's phone and queues a notification", func() {
+		twiml := text(url.Values{"From": {"+15557654321"}, "Body": {"Running late"}})
+		Expect(twiml).To(ContainSubstring(`<Message to="+15551234567">From +15557654321: Running late</Message>`))
+
+		queued, err := ReadOutbox(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queued).To(HaveLen(1))
+		Expect(queued[0].Notification.Kind).To(Equal(NotifyMessage))
+		Expect(queued[0].Notification.From).To(Equal("+15557654321"))
+	})
+
+	It("adds links to picture messages", func() {
+		twiml := text(url.Values{
+			"From":      {"+15557654321"},
+			"Body":      {"Look"},
+			"NumMedia":  {"2"},
+			"MediaUrl0": {"https://api.twilio.com/media/ME1"},
+			"MediaUrl1": {"https://api.twilio.com/media/ME2"},
+		})
+		Expect(twiml).To(ContainSubstring("From +15557654321: Look&#xA;&#xA;https://api.twilio.com/media/ME1&#xA;https://api.twilio.com/media/ME2</Message>"))
+
+		queued, err := ReadOutbox(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queued[0].Notification.MediaURLs).To(Equal([]string{"https://api.twilio.com/media/ME1", "https://api.twilio.com/media/ME2"}))
+	})
+
+	It("relays a reply from the owner to the last person who texted", func() {
+		text(url.Values{"From": {"+15557654321"}, "Body": {"Are you open?"}})
+		twiml := text(url.Values{"From": {"+15551234567"}, "Body": {"Yes, until 5"}})
+		Expect(twiml).To(ContainSubstring(`<Message to="+15557654321">Yes, until 5</Message>`))
+	})
+
+	It("sends a reply addressed to a number there and remembers it for the next reply", func() {
+		text(url.Values{"From": {"+15557654321"}, "Body": {"Are you open?"}})
+		twiml := text(url.Values{"From": {"+15551234567"}, "Body": {"@(555) 222-3333: Can you cover tomorrow?"}})
+		Expect(twiml).To(ContainSubstring(`<Message to="+15552223333">Can you cover tomorrow?</Message>`))
+		twiml = text(url.Values{"From": {"+15551234567"}, "Body": {"Thanks"}})
+		Expect(twiml).To(ContainSubstring(`<Message to="+15552223333">Thanks</Message>`))
+	})
+
+	It("tells the owner when there is no one to reply to or the number is invalid", func() {
+		twiml := text(url.Values{"From": {"+15551234567"}, "Body": {"Hello?"}})
+		Expect(twiml).To(ContainSubstring("<Message>There is no one to reply to."))
+		twiml = text(url.Values{"From": {"+15551234567"}, "Body": {"@123: Hello"}})
+		Expect(twiml).To(ContainSubstring("<Message>Unable to send your message, 123 is not a valid phone number</Message>"))
+
+		queued, err := ReadOutbox(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queued).To(BeEmpty())
+	})
+})
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP connection security
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// SMTP authentication mechanisms
+const (
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+// SMTPNotifier emails notifications through an SMTP server, as a text message with the HTML
+// version alongside when there is one
+type SMTPNotifier struct {
+	name      string
+	to        []string
+	host      string
+	port      int
+	security  string
+	auth      string
+	username  string
+	password  string
+	from      string
+	envelope  string
+	tlsConfig *tls.Config
+	now       func() time.Time
+}
+
+// newSMTPNotifier creates an SMTP notifier.  Settings missing from the notifier are taken from
+// the SMTP_ environment variables.
+func newSMTPNotifier(cfg *Config, nc NotifierConfig) (*SMTPNotifier, error) {
+	inherit := func(field *string, value string) {
+		if len(*field) == 0 {
+			*field = value
+		}
+	}
+	inherit(&nc.Host, cfg.SMTPHost)
+	inherit(&nc.Username, cfg.SMTPUsername)
+	inherit(&nc.Password, cfg.SMTPPassword)
+	inherit(&nc.From, cfg.SMTPFrom)
+	inherit(&nc.Security, cfg.SMTPSecurity)
+	inherit(&nc.Auth, cfg.SMTPAuth)
+	inherit(&nc.CAFile, cfg.SMTPCAFile)
+	if nc.Port == 0 {
+		nc.Port = cfg.SMTPPort
+	}
+
+	if len(nc.Host) == 0 || len(nc.From) == 0 {
+		return nil, cfg.missing(fmt.Sprintf("for the %s notifier", nc.Name), "SMTP_HOST", "SMTP_FROM")
+	}
+	from, err := mail.ParseAddress(nc.From)
+	if err != nil {
+		return nil, fmt.Errorf("%s: notifiers.%s.from: %q is not an email address", cfg.File, nc.Name, nc.From)
+	}
+	switch nc.Security {
+	case "":
+		nc.Security = SMTPStartTLS
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("%s: notifiers.%s.security: must be %s, %s or %s", cfg.File, nc.Name, SMTPStartTLS, SMTPTLS, SMTPNone)
+	}
+	switch nc.Auth {
+	case "":
+		nc.Auth = SMTPAuthPlain
+	case SMTPAuthPlain, SMTPAuthLogin:
+	default:
+		return nil, fmt.Errorf("%s: notifiers.%s.auth: must be %s or %s", cfg.File, nc.Name, SMTPAuthPlain, SMTPAuthLogin)
+	}
+	if nc.Port == 0 {
+		nc.Port = 587
+		if nc.Security == SMTPTLS {
+			nc.Port = 465
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: nc.Host}
+	if len(nc.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(nc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: notifiers.%s.ca_file: %s", cfg.File, nc.Name, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: notifiers.%s.ca_file: no certificates found in %s", cfg.File, nc.Name, nc.CAFile)
+		}
+	}
+	return &SMTPNotifier{
+		name:      nc.Name,
+		to:        nc.To,
+		host:      nc.Host,
+		port:      nc.Port,
+		security:  nc.Security,
+		auth:      nc.Auth,
+		username:  nc.Username,
+		password:  nc.Password,
+		from:      from.String(),
+		envelope:  from.Address,
+		tlsConfig: tlsConfig,
+		now:       cfg.now,
+	}, nil
+}
+
+func (s *SMTPNotifier) Name() string { return s.name }
+
+func (s *SMTPNotifier) Notify(n Notification) error {
+	to := recipients(s.to, n.Emails)
+	if len(to) == 0 {
+		return nil
+	}
+	msg, err := emailMessage(s.from, to, n, s.now())
+	if err != nil {
+		return err
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if s.security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", s.host)
+		}
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if len(s.username) > 0 {
+		var auth smtp.Auth
+		if s.auth == SMTPAuthLogin {
+			auth = &loginAuth{username: s.username, password: s.password, host: s.host}
+		} else {
+			auth = smtp.PlainAuth("", s.username, s.password, s.host)
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.envelope); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dial connects to the SMTP server, over TLS from the start when the security is tls
+func (s *SMTPNotifier) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.security == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// loginAuth implements the LOGIN mechanism, which some servers offer instead of PLAIN.  Like
+// smtp.PlainAuth, it won't send credentials unencrypted except to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+// emailMessage builds the MIME message for a notification, with the text and HTML versions as
+// alternatives when there is HTML, followed by any attachments
+func emailMessage(from string, to []string, n Notification, date time.Time) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: %s\r\n", messageID(from))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+
+	header, body, err := emailContent(n)
+	if err != nil {
+		return nil, err
+	}
+	if len(n.Attachments) == 0 {
+		for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if v := header.Get(key); len(v) > 0 {
+				fmt.Fprintf(buf, "%s: %s\r\n", key, v)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	for _, a := range n.Attachments {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(w, a.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// emailContent returns the headers and body of the text of a notification, as a
+// multipart/alternative body when there is HTML
+func emailContent(n Notification) (textproto.MIMEHeader, []byte, error) {
+	buf := new(bytes.Buffer)
+	if len(n.HTML) == 0 {
+		if err := writeQuotedPrintable(buf, n.Text); err != nil {
+			return nil, nil, err
+		}
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", n.Text},
+		{"text/html; charset=utf-8", n.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + mw.Boundary()},
+	}, buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+// writeQuotedPrintable writes the body quoted-printable encoded with CRLF line endings, whether
+// its lines end in LF or already in CRLF, as templates edited on Windows do
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	if _, err := qp.Write([]byte(strings.Replace(body, "\n", "\r\n", -1))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID returns a unique message ID at the domain of the from address
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,347 @@
+package main_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeSMTP is an in-process SMTP server that records the messages it receives
+type fakeSMTP struct {
+	listener net.Listener
+	tls      *tls.Config
+	implicit bool
+
+	mu       sync.Mutex
+	usedTLS  bool
+	mech     string
+	username string
+	password string
+	from     string
+	rcpts    []string
+	data     []byte
+}
+
+func newFakeSMTP(tlsConfig *tls.Config, implicit bool) *fakeSMTP {
+	var l net.Listener
+	var err error
+	if implicit {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	Expect(err).ToNot(HaveOccurred())
+	s := &fakeSMTP{listener: l, tls: tlsConfig, implicit: implicit}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	secure := s.implicit
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+		switch verb {
+		case "EHLO", "HELO":
+			ext := []string{"250-fake", "250-AUTH PLAIN LOGIN"}
+			if s.tls != nil && !secure {
+				ext = append(ext, "250-STARTTLS")
+			}
+			for _, e := range ext {
+				tp.PrintfLine("%s", e)
+			}
+			tp.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tc := tls.Server(conn, s.tls)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tc, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			fields := strings.Fields(arg)
+			s.mu.Lock()
+			s.mech = strings.ToUpper(fields[0])
+			s.mu.Unlock()
+			if s.mech == "PLAIN" {
+				b, _ := base64.StdEncoding.DecodeString(fields[1])
+				creds := strings.Split(string(b), "\x00")
+				s.mu.Lock()
+				s.username, s.password = creds[1], creds[2]
+				s.mu.Unlock()
+			} else {
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user, _ := tp.ReadLine()
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+				pass, _ := tp.ReadLine()
+				u, _ := base64.StdEncoding.DecodeString(user)
+				p, _ := base64.StdEncoding.DecodeString(pass)
+				s.mu.Lock()
+				s.username, s.password = string(u), string(p)
+				s.mu.Unlock()
+			}
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = address(arg)
+			s.usedTLS = secure
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, address(arg))
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = data
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+// address returns the address in the angle brackets of a MAIL or RCPT command
+func address(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1, written to a CA file
+func testCertificate(dir string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	caFile := filepath.Join(dir, "ca.pem")
+	Expect(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+var _ = Describe("SMTP notifier", func() {
+	var dir, caFile string
+	var tlsConfig *tls.Config
+	var cfg *Config
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "smtp")
+		Expect(err).ToNot(HaveOccurred())
+		var cert tls.Certificate
+		cert, caFile = testCertificate(dir)
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		c := testConfig()
+		// without channels listed the notifications are emailed through SMTP
+		c.Notifiers = nil
+		c.SMTPHost = "127.0.0.1"
+		c.SMTPFrom = "Voicemail <voicemail@example.com>"
+		c.SMTPUsername = "me"
+		c.SMTPPassword = "secret"
+		c.SMTPCAFile = caFile
+		cfg = &c
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("is used instead of Mailgun when SMTP_HOST is set", func() {
+		Expect(cfg.Validate()).To(BeEmpty())
+	})
+
+	It("sends a multipart voicemail over STARTTLS with PLAIN auth", func() {
+		server := newFakeSMTP(tlsConfig, false)
+		defer server.Close()
+		cfg.SMTPPort = server.port()
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		v := VoicemailRecord{From: "+15557654321", To: "+15550001111", Transcript: "Call me back", RecordingURL: "https://api.twilio.com/recording"}
+		Expect(Send(*cfg, profile, v, CallRecord{})).To(Succeed())
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		Expect(server.usedTLS).To(BeTrue())
+		Expect(server.mech).To(Equal("PLAIN"))
+		Expect(server.username).To(Equal("me"))
+		Expect(server.password).To(Equal("secret"))
+		Expect(server.from).To(Equal("voicemail@example.com"))
+		Expect(server.rcpts).To(Equal([]string{"me@example.com"}))
+
+		msg, err := mail.ReadMessage(strings.NewReader(string(server.data)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Header.Get("Subject")).To(Equal("New voicemail from +15557654321"))
+		Expect(msg.Header.Get("From")).To(Equal(`"Voicemail" <voicemail@example.com>`))
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mediaType).To(Equal("multipart/alternative"))
+
+		mr := multipart.NewReader(msg.Body, params["boundary"])
+		var types []string
+		var bodies []string
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := ioutil.ReadAll(part)
+			types = append(types, part.Header.Get("Content-Type"))
+			bodies = append(bodies, string(b))
+		}
+		Expect(types).To(Equal([]string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}))
+		Expect(bodies[0]).To(ContainSubstring("Call me back"))
+		Expect(bodies[1]).To(ContainSubstring("<html"))
+	})
+
+	It("sends over implicit TLS with LOGIN auth", func() {
+		server := newFakeSMTP(tlsConfig, true)
+		defer server.Close()
+		cfg.SMTPPort = server.port()
+		cfg.SMTPSecurity = SMTPTLS
+		cfg.SMTPAuth = SMTPAuthLogin
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		Expect(SendMessage(*cfg, profile, MessageRequest{From: "+15557654321", Body: "Running late"})).To(Succeed())
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		Expect(server.usedTLS).To(BeTrue())
+		Expect(server.mech).To(Equal("LOGIN"))
+		Expect(server.username).To(Equal("me"))
+		Expect(server.password).To(Equal("secret"))
+		msg, err := mail.ReadMessage(strings.NewReader(string(server.data)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		body, _ := ioutil.ReadAll(msg.Body)
+		Expect(string(body)).To(ContainSubstring("Running late"))
+	})
+
+	It("refuses to send when the server doesn't offer STARTTLS", func() {
+		server := newFakeSMTP(nil, false)
+		defer server.Close()
+		cfg.SMTPPort = server.port()
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		err := SendMessage(*cfg, profile, MessageRequest{From: "+15557654321"})
+		Expect(err).To(MatchError("smtp: 127.0.0.1 does not support STARTTLS"))
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		Expect(server.username).To(BeEmpty())
+		Expect(server.data).To(BeNil())
+	})
+
+	It("takes missing settings of smtp notifiers from the environment", func() {
+		server := newFakeSMTP(nil, false)
+		defer server.Close()
+		cfg.Notifiers = []NotifierConfig{{Type: NotifierSMTP, Name: "relay", Port: server.port(), Security: SMTPNone, To: []string{"office@example.com"}}}
+		cfg.SMTPUsername = ""
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		Expect(SendMessage(*cfg, profile, MessageRequest{From: "+15557654321"})).To(Succeed())
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		Expect(server.from).To(Equal("voicemail@example.com"))
+		Expect(server.rcpts).To(Equal([]string{"office@example.com"}))
+	})
+
+	It("doesn't double the carriage returns of templates with CRLF line endings", func() {
+		server := newFakeSMTP(nil, false)
+		defer server.Close()
+		cfg.SMTPPort, cfg.SMTPSecurity, cfg.SMTPUsername = server.port(), SMTPNone, ""
+		cfg.TemplateDir = dir
+		Expect(ioutil.WriteFile(filepath.Join(dir, "message.txt"), []byte("New text\r\nfrom {{.From}}\r\n"), 0644)).To(Succeed())
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		profile, _ := cfg.Mailbox("default")
+		Expect(SendMessage(*cfg, profile, MessageRequest{From: "+15557654321"})).To(Succeed())
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		// the server reads the CRLF line endings as LF
+		Expect(string(server.data)).To(ContainSubstring("New text\nfrom +15557654321\n"))
+		Expect(string(server.data)).ToNot(ContainSubstring("=0D"))
+	})
+
+	It("rejects bad settings", func() {
+		cfg.SMTPFrom = "not an address"
+		cfg.SMTPSecurity = "ssl"
+		errs := cfg.Validate()
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0]).To(MatchError(ContainSubstring("notifiers.smtp.from")))
+
+		cfg.SMTPFrom = "voicemail@example.com"
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("notifiers.smtp.security"))))
+	})
+})
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VoicemailRecord is the metadata kept for a voicemail, keyed by the sid of its recording
+type VoicemailRecord struct {
+	ID           string    `json:"id"`
+	CallSid      string    `json:"call_sid"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	Mailbox      string    `json:"mailbox,omitempty"`
+	ReceivedAt   time.Time `json:"received_at"`
+	Duration     int       `json:"duration"`
+	Transcript   string    `json:"transcript"`
+	RecordingURL string    `json:"recording_url"`
+	// Audio is the name of the audio file in the store, and is empty until it is downloaded
+	Audio         string    `json:"audio,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+	DownloadedAt  time.Time `json:"downloaded_at,omitempty"`
+	DownloadError string    `json:"download_error,omitempty"`
+	// Read is set once the voicemail has been marked as read in the inbox
+	Read bool `json:"read"`
+}
+
+// merge fills in the fields of the record that are set in update
+func (v *VoicemailRecord) merge(update VoicemailRecord) {
+	set := func(field *string, value string) {
+		if len(value) > 0 {
+			*field = value
+		}
+	}
+	set(&v.CallSid, update.CallSid)
+	set(&v.From, update.From)
+	set(&v.To, update.To)
+	set(&v.Mailbox, update.Mailbox)
+	set(&v.Transcript, update.Transcript)
+	set(&v.RecordingURL, update.RecordingURL)
+	if update.Duration > 0 {
+		v.Duration = update.Duration
+	}
+	if v.ReceivedAt.IsZero() {
+		v.ReceivedAt = update.ReceivedAt
+	}
+}
+
+// ErrVoicemailNotFound is returned by a VoicemailStore for a voicemail it doesn't have
+var ErrVoicemailNotFound = fmt.Errorf("voicemail not found")
+
+// VoicemailStore keeps voicemails and their audio
+type VoicemailStore interface {
+	// Put saves the metadata of a voicemail, replacing any saved before
+	Put(v VoicemailRecord) error
+	// Update changes the saved metadata of a voicemail, starting from an empty record with the
+	// ID set if there isn't one yet
+	Update(id string, change func(v *VoicemailRecord)) (VoicemailRecord, error)
+	// PutAudio saves the audio of a voicemail and returns the name it was saved as
+	PutAudio(id string, contentType string, audio io.Reader) (string, error)
+	// Get returns the metadata of a voicemail
+	Get(id string) (VoicemailRecord, error)
+	// Audio opens the audio of a voicemail
+	Audio(id string) (io.ReadCloser, error)
+	// List returns all voicemails, newest first
+	List() ([]VoicemailRecord, error)
+	// Delete removes a voicemail and its audio
+	Delete(id string) error
+}
+
+// validID matches the recording sids used as voicemail IDs, so that IDs are safe to use as file
+// names
+var validID = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// FileStore is a VoicemailStore that keeps each voicemail in a directory as its audio file and a
+// JSON sidecar with its metadata
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a store that keeps voicemails in dir, creating it if necessary
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string, ext string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("invalid voicemail id %q", id)
+	}
+	return filepath.Join(s.dir, id+ext), nil
+}
+
+// Put saves the metadata of a voicemail
+func (s *FileStore) Put(v VoicemailRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(v)
+}
+
+// Update changes the saved metadata of a voicemail
+func (s *FileStore) Update(id string, change func(v *VoicemailRecord)) (VoicemailRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.get(id)
+	if err == ErrVoicemailNotFound {
+		v, err = VoicemailRecord{ID: id}, nil
+	}
+	if err != nil {
+		return v, err
+	}
+	change(&v)
+	v.ID = id
+	return v, s.put(v)
+}
+
+func (s *FileStore) put(v VoicemailRecord) error {
+	p, err := s.path(v.ID, ".json")
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// PutAudio saves the audio of a voicemail
+func (s *FileStore) PutAudio(id string, contentType string, audio io.Reader) (string, error) {
+	p, err := s.path(id, audioExtension(contentType))
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(s.dir, id)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, audio); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return "", err
+	}
+	return filepath.Base(p), nil
+}
+
+// Get returns the metadata of a voicemail
+func (s *FileStore) Get(id string) (VoicemailRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+func (s *FileStore) get(id string) (VoicemailRecord, error) {
+	var v VoicemailRecord
+	p, err := s.path(id, ".json")
+	if err != nil {
+		return v, err
+	}
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return v, ErrVoicemailNotFound
+	}
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(b, &v)
+	return v, err
+}
+
+// Audio opens the audio of a voicemail
+func (s *FileStore) Audio(id string) (io.ReadCloser, error) {
+	v, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.Audio) == 0 {
+		return nil, ErrVoicemailNotFound
+	}
+	return os.Open(filepath.Join(s.dir, filepath.Base(v.Audio)))
+}
+
+// List returns all voicemails, newest first
+func (s *FileStore) List() ([]VoicemailRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var all []VoicemailRecord
+	for _, f := range files {
+		v, err := s.Get(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, v)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ReceivedAt.After(all[j].ReceivedAt) })
+	return all, nil
+}
+
+// Delete removes a voicemail and its audio
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if len(v.Audio) > 0 {
+		if err := os.Remove(filepath.Join(s.dir, filepath.Base(v.Audio))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	p, _ := s.path(id, ".json")
+	return os.Remove(p)
+}
+
+// audioExtension returns the file extension for audio of the content type Twilio sends
+func audioExtension(contentType string) string {
+	switch strings.TrimSpace(strings.Split(contentType, ";")[0]) {
+	case "audio/mpeg", "audio/mp3":
+		return ".mp3"
+	default:
+		return ".wav"
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// TemplateData is what notification templates are rendered with
+type TemplateData struct {
+	// Kind is voicemail, message or missed_call
+	Kind string
+	// Mailbox is the name of the profile that was called
+	Mailbox string
+	From    string
+	To      string
+	// Caller describes the caller by name, number and location, as far as they are known
+	Caller     string
+	CallerName string
+	City       string
+	State      string
+	Zip        string
+	Country    string
+	// Location is the caller's city, state and country, as far as they are known
+	Location string
+	// Time is when the call or message came in, in the time zone of the profile's schedule
+	Time time.Time
+	// Duration is the length of the voicemail or call in seconds
+	Duration     int
+	Transcript   string
+	RecordingURL string
+	Body         string
+	MediaURLs    []string
+}
+
+// notificationKinds are the kinds of notification that have templates
+var notificationKinds = []string{NotifyVoicemail, NotifyMessage, NotifyMissedCall}
+
+var templateFuncs = map[string]interface{}{
+	"duration": func(seconds int) string {
+		return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+	},
+}
+
+// kindTemplates are the templates for one kind of notification.  Notifications without an HTML
+// template are sent as text only.
+type kindTemplates struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *template.Template
+}
+
+// notificationTemplates are the templates for each kind of notification, keyed by kind
+type notificationTemplates map[string]*kindTemplates
+
+// defaultTemplates are the embedded templates, used for profiles that haven't been validated
+var defaultTemplates notificationTemplates
+
+func init() {
+	var err error
+	if defaultTemplates, err = loadTemplates(""); err != nil {
+		panic(err)
+	}
+}
+
+// loadTemplates parses the notification templates in dir, named for the kind of notification
+// with the extension .subject, .txt or .html, like voicemail.txt.  Templates missing from dir are
+// taken from the embedded defaults.
+func loadTemplates(dir string) (notificationTemplates, error) {
+	if len(dir) > 0 {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	templates := make(notificationTemplates)
+	for _, kind := range notificationKinds {
+		kt := &kindTemplates{}
+		for _, ext := range []string{"subject", "txt", "html"} {
+			name := kind + "." + ext
+			src, err := templateSource(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if src == nil {
+				continue
+			}
+			switch ext {
+			case "subject":
+				kt.subject, err = texttemplate.New(name).Funcs(texttemplate.FuncMap(templateFuncs)).Parse(string(src))
+			case "txt":
+				kt.text, err = texttemplate.New(name).Funcs(texttemplate.FuncMap(templateFuncs)).Parse(string(src))
+			case "html":
+				kt.html, err = template.New(name).Funcs(template.FuncMap(templateFuncs)).Parse(string(src))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		templates[kind] = kt
+	}
+	return templates, nil
+}
+
+// templateSource reads the template from dir, or the embedded default if dir doesn't have it.
+// It returns nil if neither has it.
+func templateSource(dir string, name string) ([]byte, error) {
+	if len(dir) > 0 {
+		src, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return src, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	src, err := Asset("templates/" + name)
+	if err != nil {
+		return nil, nil
+	}
+	return src, nil
+}
+
+// render fills in the subject and bodies of the notification from the templates for its kind
+func (t notificationTemplates) render(n *Notification, data TemplateData) error {
+	kt, ok := t[n.Kind]
+	if !ok {
+		return fmt.Errorf("no templates for %s notifications", n.Kind)
+	}
+	buf := new(bytes.Buffer)
+	if err := kt.subject.Execute(buf, data); err != nil {
+		return err
+	}
+	// a subject can't span lines, so a trailing newline in the file is dropped
+	n.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := kt.text.Execute(buf, data); err != nil {
+		return err
+	}
+	n.Text = buf.String()
+
+	n.HTML = ""
+	if kt.html != nil {
+		buf.Reset()
+		if err := kt.html.Execute(buf, data); err != nil {
+			return err
+		}
+		n.HTML = buf.String()
+	}
+	return nil
+}
+
+// templateData starts the template data for a notification to the owner of the profile
+func templateData(kind string, profile Profile, at time.Time) TemplateData {
+	return TemplateData{
+		Kind:    kind,
+		Mailbox: profile.Name,
+		Time:    at.In(profile.location()),
+	}
+}
+
+// caller fills in the caller's details
+func (d *TemplateData) caller(from string, name string, city string, state string, zip string, country string) {
+	d.From, d.CallerName = from, name
+	d.City, d.State, d.Zip, d.Country = city, state, zip, country
+	var place []string
+	for _, p := range []string{city, state, country} {
+		if len(p) > 0 {
+			place = append(place, p)
+		}
+	}
+	d.Location = strings.Join(place, ", ")
+
+	d.Caller = from
+	if len(d.Caller) == 0 {
+		d.Caller = "an unknown number"
+	}
+	if len(name) > 0 {
+		d.Caller = fmt.Sprintf("%s (%s)", name, d.Caller)
+	}
+	if len(d.Location) > 0 {
+		d.Caller += " in " + d.Location
+	}
+}
+
+// validateTemplates loads the notification templates of the config and its profiles.  It must
+// be called after the profiles have inherited their template directories.
+func (cfg *Config) validateTemplates() (errors []error) {
+	var err error
+	if cfg.templates, err = loadTemplates(cfg.TemplateDir); err != nil {
+		errors = append(errors, cfg.invalid("TEMPLATE_DIR", "%s", err))
+		cfg.templates = defaultTemplates
+	}
+	for number, p := range cfg.Profiles {
+		p.templates = cfg.templates
+		if p.TemplateDir != cfg.TemplateDir {
+			if p.templates, err = loadTemplates(p.TemplateDir); err != nil {
+				errors = append(errors, fmt.Errorf("%s: profiles.%s.template_dir: %s", cfg.File, number, err))
+				p.templates = cfg.templates
+			}
+		}
+		cfg.Profiles[number] = p
+	}
+	return
+}
+
+// notificationTemplates returns the templates for notifications to the owner of the profile
+func (p Profile) notificationTemplates() notificationTemplates {
+	if p.templates == nil {
+		return defaultTemplates
+	}
+	return p.templates
+}
+
+// location returns the time zone of the profile's schedule, or the local time zone if it
+// doesn't have one
+func (p Profile) location() *time.Location {
+	if p.Schedule != nil && p.Schedule.location != nil {
+		return p.Schedule.location
+	}
+	return time.Local
+}
+
+// RenderTemplate renders the templates of the mailbox for a kind of notification with sample
+// data, to preview them without waiting for a call
+func RenderTemplate(w io.Writer, cfg Config, kind string, mailbox string) error {
+	profile, ok := cfg.Mailbox(mailbox)
+	if !ok {
+		return fmt.Errorf("no profile %s", mailbox)
+	}
+	if len(profile.TemplateDir) == 0 {
+		profile.TemplateDir = cfg.TemplateDir
+	}
+	if profile.Schedule != nil {
+		s := *profile.Schedule
+		if errs := s.Compile(); len(errs) > 0 {
+			return fmt.Errorf("schedule.%s", errs[0])
+		}
+		profile.Schedule = &s
+	}
+	templates, err := loadTemplates(profile.TemplateDir)
+	if err != nil {
+		return err
+	}
+	profile.templates = templates
+
+	call := CallRecord{
+		From:        "+15557654321",
+		To:          "+15550001111",
+		CallerName:  "JANE DOE",
+		FromCity:    "PORTLAND",
+		FromState:   "OR",
+		FromZip:     "97201",
+		FromCountry: "US",
+		StartedAt:   cfg.now(),
+		Duration:    42,
+	}
+	var n Notification
+	switch kind {
+	case NotifyVoicemail:
+		n, err = VoicemailNotification(cfg, profile, VoicemailRecord{
+			From:         call.From,
+			To:           call.To,
+			Duration:     call.Duration,
+			Transcript:   "Hi, it's Jane. Call me back when you get a chance.",
+			RecordingURL: "https://api.twilio.com/2010-04-01/Accounts/AC123/Recordings/RE123",
+			ReceivedAt:   call.StartedAt,
+		}, call)
+	case NotifyMessage:
+		n, err = MessageNotification(cfg, profile, MessageRequest{
+			From:        call.From,
+			To:          call.To,
+			Body:        "Running ten minutes late",
+			FromCity:    call.FromCity,
+			FromState:   call.FromState,
+			FromZip:     call.FromZip,
+			FromCountry: call.FromCountry,
+		})
+	case NotifyMissedCall:
+		n, err = MissedCallNotification(cfg, profile, call)
+	default:
+		return fmt.Errorf("unknown notification kind %s, expected one of %s", kind, strings.Join(notificationKinds, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Subject: %s\n\n%s\n", n.Subject, n.Text)
+	if len(n.HTML) > 0 {
+		fmt.Fprintf(w, "\n%s\n", n.HTML)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/BTBurke/twilio-voice"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Notification templates", func() {
+	var dir string
+	var cfg *Config
+	at := time.Date(2018, 3, 5, 18, 30, 0, 0, time.UTC)
+	call := CallRecord{
+		From:        "+15557654321",
+		To:          "+15550001111",
+		CallerName:  "JANE DOE",
+		FromCity:    "PORTLAND",
+		FromState:   "OR",
+		FromCountry: "US",
+		StartedAt:   at,
+		Duration:    75,
+	}
+	write := func(name string, src string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "templates")
+		Expect(err).ToNot(HaveOccurred())
+		c := testConfig()
+		c.Now = func() time.Time { return at }
+		cfg = &c
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("renders the embedded templates by default", func() {
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		n, err := VoicemailNotification(*cfg, profile, VoicemailRecord{From: call.From, Transcript: "Call me back"}, call)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n.Subject).To(Equal("New voicemail from +15557654321"))
+		Expect(n.Text).To(ContainSubstring("JANE DOE (+15557654321) in PORTLAND, OR, US"))
+		Expect(n.Text).To(ContainSubstring("Call me back"))
+		Expect(n.HTML).To(ContainSubstring("<html"))
+
+		n, err = MissedCallNotification(*cfg, profile, call)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n.Subject).To(Equal("Missed call from +15557654321"))
+		Expect(n.HTML).To(BeEmpty())
+	})
+
+	It("overrides the defaults with the templates in the directory", func() {
+		write("voicemail.subject", "Nouveau message de {{.CallerName}}\n")
+		write("voicemail.txt", "{{.Mailbox}}: {{duration .Duration}} à {{.Time.Format \"15:04\"}}")
+		cfg.TemplateDir = dir
+		Expect(cfg.Validate()).To(BeEmpty())
+		profile, _ := cfg.Mailbox("default")
+		n, err := VoicemailNotification(*cfg, profile, VoicemailRecord{From: call.From, Duration: 75, ReceivedAt: at}, call)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n.Subject).To(Equal("Nouveau message de JANE DOE"))
+		Expect(n.Text).To(Equal("default: 1:15 à " + at.Local().Format("15:04")))
+		Expect(n.HTML).To(ContainSubstring("<html"))
+	})
+
+	It("loads the templates of each profile, in the time zone of its schedule", func() {
+		write("missed_call.txt", "{{.Mailbox}} missed {{.From}} at {{.Time.Format \"15:04 MST\"}}")
+		cfg.Profiles = map[string]Profile{
+			"+15550001111": {Name: "sales", TemplateDir: dir, Schedule: &Schedule{TimeZone: "America/New_York"}},
+			"+15550002222": {Name: "support"},
+		}
+		Expect(cfg.Validate()).To(BeEmpty())
+
+		n, err := MissedCallNotification(*cfg, cfg.Profile("+15550001111"), call)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n.Text).To(Equal("sales missed +15557654321 at 13:30 EST"))
+
+		n, err = MissedCallNotification(*cfg, cfg.Profile("+15550002222"), call)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n.Text).To(HavePrefix("You missed a call from JANE DOE"))
+	})
+
+	It("reports templates that don't parse", func() {
+		write("message.txt", "{{.Body")
+		cfg.TemplateDir = dir
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("TEMPLATE_DIR"))))
+
+		cfg.TemplateDir = filepath.Join(dir, "message.txt")
+		Expect(cfg.Validate()).To(ConsistOf(MatchError(ContainSubstring("is not a directory"))))
+	})
+
+	It("previews a template with sample data", func() {
+		write("message.subject", "Text from {{.Location}}")
+		cfg.Profiles = map[string]Profile{"+15550001111": {Name: "sales", TemplateDir: dir}}
+		var out bytes.Buffer
+		Expect(RenderTemplate(&out, *cfg, NotifyMessage, "sales")).To(Succeed())
+		Expect(out.String()).To(HavePrefix("Subject: Text from PORTLAND, OR, US\n\n"))
+		Expect(out.String()).To(ContainSubstring("Running ten minutes late"))
+
+		out.Reset()
+		Expect(RenderTemplate(&out, *cfg, NotifyVoicemail, "default")).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("<html"))
+
+		Expect(RenderTemplate(&out, *cfg, "fax", "default")).To(MatchError(ContainSubstring("unknown notification kind fax")))
+		Expect(RenderTemplate(&out, *cfg, NotifyMessage, "nobody")).To(MatchError("no profile nobody"))
+	})
+})
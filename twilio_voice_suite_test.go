@@ -1,9 +1,19 @@
-package main
+package main_test
 
 import (
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
+	. "github.com/BTBurke/twilio-voice"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -16,3 +26,58 @@ func TestTwilioVoice(t *testing.T) {
 var _ = BeforeSuite(func() {
 	log.SetOutput(GinkgoWriter)
 })
+
+// testConfig is the smallest config that validates, sending notifications to the log
+func testConfig() Config {
+	return Config{
+		ForwardingNumber:  "+15555555",
+		NotificationEmail: "me@example.com",
+		TwilioAuthToken:   "12345",
+		Notifiers:         []NotifierConfig{{Type: NotifierLog}},
+	}
+}
+
+// fixture is the config, temporary directory and call log the webhook handlers are tested with
+type fixture struct {
+	cfg   Config
+	dir   string
+	calls *CallLog
+}
+
+// newFixture validates the config and opens the call log in a new temporary directory
+func newFixture(cfg Config) *fixture {
+	Expect(cfg.Validate()).To(BeEmpty())
+	dir, err := ioutil.TempDir("", "twilio-voice")
+	Expect(err).ToNot(HaveOccurred())
+	calls, err := OpenCallLog(cfg, filepath.Join(dir, "calls.jsonl"))
+	Expect(err).ToNot(HaveOccurred())
+	return &fixture{cfg: cfg, dir: dir, calls: calls}
+}
+
+// close closes the call log and removes the temporary directory
+func (f *fixture) close() {
+	f.calls.Close()
+	os.RemoveAll(f.dir)
+}
+
+// trustServer makes the default HTTP transport trust the certificate of the TLS test server,
+// returning a func that puts the transport back
+func trustServer(s *httptest.Server) func() {
+	transport := http.DefaultTransport
+	http.DefaultTransport = s.Client().Transport
+	return func() { http.DefaultTransport = transport }
+}
+
+// indent is the whitespace between elements of a TwiML response
+var indent = regexp.MustCompile(`>\s+<`)
+
+// postForm sends the webhook form to the handler at target and returns the TwiML response without
+// the indenting
+func postForm(handler http.HandlerFunc, target string, form url.Values) string {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	Expect(rec.Code).To(Equal(200))
+	return indent.ReplaceAllString(rec.Body.String(), "><")
+}